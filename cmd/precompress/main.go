@@ -0,0 +1,83 @@
+// Command precompress writes gzip and brotli variants next to the frontend
+// assets so that they can be served without compressing on every request.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+var compressible = map[string]bool{
+	".css":  true,
+	".js":   true,
+	".json": true,
+	".map":  true,
+	".svg":  true,
+	".txt":  true,
+}
+
+type encoder struct {
+	ext string
+	new func(w io.Writer) io.WriteCloser
+}
+
+var encoders = []encoder{
+	{".gz", func(w io.Writer) io.WriteCloser {
+		zw, _ := gzip.NewWriterLevel(w, gzip.BestCompression)
+		return zw
+	}},
+	{".br", func(w io.Writer) io.WriteCloser {
+		return brotli.NewWriterLevel(w, brotli.BestCompression)
+	}},
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		log.Fatalln("usage: precompress DIR...")
+	}
+	for _, dir := range os.Args[1:] {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !compressible[filepath.Ext(path)] {
+				return err
+			}
+			return compress(path)
+		})
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+}
+
+func compress(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, enc := range encoders {
+		buf := &bytes.Buffer{}
+		w := enc.new(buf)
+		if _, err = w.Write(data); err != nil {
+			return err
+		}
+		if err = w.Close(); err != nil {
+			return err
+		}
+		// Not worth serving a variant that is no smaller than the original
+		if buf.Len() >= len(data) {
+			_ = os.Remove(path + enc.ext)
+			continue
+		}
+		if err = os.WriteFile(path+enc.ext, buf.Bytes(), 0o644); err != nil {
+			return err
+		}
+		log.Printf("%s%s: %d -> %d bytes", path, enc.ext, len(data), buf.Len())
+	}
+	return nil
+}
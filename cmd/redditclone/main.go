@@ -1,36 +1,143 @@
 package main
 
 import (
-	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/app"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/config"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/server"
 	"github.com/Benzogang-Tape/Reddit-clone/internal/storage"
-	"github.com/Benzogang-Tape/Reddit-clone/internal/transport/rest"
-	"go.uber.org/zap"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/tracing"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/transport/rpc"
 	"log"
-	"net/http"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	zapLogger, err := zap.NewProduction()
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if cfg.PrintConfig {
+		if err = cfg.Print(os.Stdout); err != nil {
+			log.Fatalln(err)
+		}
+		if err = cfg.Validate(); err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+	if err = cfg.Validate(); err != nil {
+		log.Fatalln(err)
+	}
+
+	zapLogger, err := config.NewLogger(cfg.Log)
 	if err != nil {
 		log.Fatalln("Logger init error")
 	}
 	defer zapLogger.Sync() //nolint:errcheck
 	logger := zapLogger.Sugar()
 
-	userStorage := storage.NewUserRepo()
-	userHandler := service.NewUserHandler(userStorage)
-	u := rest.NewUserHandler(userHandler, logger)
+	if err = configureSessions(cfg.Auth); err != nil {
+		logger.Fatalw("Sessions init error", "reason", err.Error())
+	}
+	if cfg.Auth.JWTSecret == "" {
+		logger.Warn("auth.jwtSecret is not set, using an ephemeral key: tokens will not survive a restart")
+	}
 
-	postStorage := storage.NewPostRepo()
-	postHandler := service.NewPostHandler(postStorage, postStorage)
-	p := rest.NewPostHandler(postHandler, logger)
+	tracerProvider, err := tracing.NewProvider(tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Output:      cfg.Tracing.Output,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		ServiceName: cfg.Tracing.ServiceName,
+	})
+	if err != nil {
+		logger.Fatalw("Tracing init error", "reason", err.Error())
+	}
 
-	router := rest.NewAppRouter(u, p).InitRouter(logger)
+	userStorage, postStorage := storage.NewUserRepo(), storage.NewPostRepo()
+	var persistence *storage.Persistence
+	if cfg.Storage.Backend == config.BackendFile {
+		persistence, err = storage.OpenPersistence(context.Background(), persistenceOptions(cfg.Storage), logger)
+		if err != nil {
+			logger.Fatalw("Storage init error", "reason", err.Error())
+		}
+		userStorage, postStorage = persistence.Users, persistence.Posts
+	}
 
-	addr := ":8080"
-	err = http.ListenAndServe(addr, router)
+	reddit, err := app.New(cfg, userStorage, postStorage, logger)
 	if err != nil {
-		log.Panicf("RUNTIME ERROR")
+		logger.Fatalw("App init error", "reason", err.Error())
+	}
+	if persistence != nil {
+		reddit.Health.AddCheck("storage.dir", persistence.Ping)
+	}
+
+	srv := server.New(cfg.HTTP, reddit.Handler, logger)
+	srv.OnDrain(reddit.Health.Drain)
+	srv.OnShutdown(reddit.Broker.Close)
+	if reddit.GRPC != nil {
+		listener, err := net.Listen("tcp", cfg.GRPC.Addr)
+		if err != nil {
+			logger.Fatalw("gRPC listener init error", "reason", err.Error())
+		}
+		go func() {
+			logger.Infow("Starting gRPC server", "addr", listener.Addr().String())
+			if err := reddit.GRPC.Serve(listener); err != nil {
+				logger.Errorw("gRPC server error", "reason", err.Error())
+			}
+		}()
+		srv.OnClose("grpc server", func(ctx context.Context) error {
+			return rpc.Stop(ctx, reddit.GRPC)
+		})
+	}
+	srv.OnClose("posts storage", postStorage.Close)
+	srv.OnClose("users storage", userStorage.Close)
+	if persistence != nil {
+		srv.OnClose("storage persistence", persistence.Close)
+	}
+	srv.OnClose("login attempts storage", reddit.Attempts.Close)
+	srv.OnClose("tracer provider", tracerProvider.Shutdown)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err = srv.Run(ctx); err != nil {
+		logger.Errorw("RUNTIME ERROR", "reason", err.Error())
+		zapLogger.Sync() //nolint:errcheck
+		os.Exit(1)
+	}
+}
+
+func persistenceOptions(cfg config.StorageConfig) storage.PersistenceOptions {
+	return storage.PersistenceOptions{
+		Dir:              cfg.DSN,
+		Fsync:            storage.FsyncPolicy(cfg.Fsync),
+		SnapshotInterval: cfg.SnapshotInterval.Duration,
+	}
+}
+
+func configureSessions(cfg config.AuthConfig) error {
+	secret := []byte(cfg.JWTSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return fmt.Errorf("ephemeral key generation: %w", err)
+		}
+	}
+	previous := make([][]byte, 0, len(cfg.JWTPreviousSecrets))
+	for _, key := range cfg.JWTPreviousSecrets {
+		previous = append(previous, []byte(key))
 	}
-	// log.Fatal(http.ListenAndServe(":8080", nil))
+	models.ConfigureSessions(secret, previous, cfg.TokenTTL.Duration)
+	return nil
 }
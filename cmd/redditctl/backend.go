@@ -0,0 +1,321 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/backup"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/config"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/storage"
+	"github.com/Benzogang-Tape/Reddit-clone/pkg/client"
+	"io"
+)
+
+// backend is what the commands operate on: the admin API of a running server
+// or the storage of a stopped one. Both speak the types of the Go client so
+// that the output does not depend on the mode.
+type backend interface {
+	Users(ctx context.Context) ([]client.UserInfo, error)
+	CreateUser(ctx context.Context, username, password, role string) (*client.UserInfo, error)
+	SetRole(ctx context.Context, username, role string) (*client.UserInfo, error)
+	ResetPassword(ctx context.Context, username, password string) (*client.UserInfo, error)
+	TopPosts(ctx context.Context, category string, limit int) ([]client.PostSummary, error)
+	Post(ctx context.Context, postID string) (*client.PostDetails, error)
+	DeletePost(ctx context.Context, postID string) error
+	RestorePost(ctx context.Context, postID string) (*client.PostDetails, error)
+	DeleteComment(ctx context.Context, postID, commentID string) (*client.PostDetails, error)
+	RestoreComment(ctx context.Context, postID, commentID string) (*client.PostDetails, error)
+	Export(ctx context.Context, w io.Writer) error
+	Import(ctx context.Context, r io.Reader, opts client.ImportOptions) (*client.ImportReport, error)
+	Close(ctx context.Context) error
+}
+
+type repos struct {
+	users *storage.UserRepo
+	posts *storage.PostRepo
+	// close is set when the backend holds more than the repos
+	close func(ctx context.Context) error
+}
+
+// openers open the storage of a backend for direct access. The memory backend
+// only lives inside the server process and has none.
+var openers = map[string]func(config.StorageConfig) (repos, error){
+	config.BackendFile: openFile,
+}
+
+// openFile loads the data directory of the file backend. Closing it writes a
+// snapshot with the changes of the command.
+func openFile(cfg config.StorageConfig) (repos, error) {
+	logger, err := config.NewLogger(config.LogConfig{Level: "warn", Format: "console"})
+	if err != nil {
+		return repos{}, err
+	}
+	p, err := storage.OpenPersistence(context.Background(), storage.PersistenceOptions{
+		Dir:              cfg.DSN,
+		Fsync:            storage.FsyncPolicy(cfg.Fsync),
+		SnapshotInterval: cfg.SnapshotInterval.Duration,
+	}, logger.Sugar())
+	if err != nil {
+		return repos{}, err
+	}
+	return repos{users: p.Users, posts: p.Posts, close: p.Close}, nil
+}
+
+func openBackend(ctx context.Context, opts options, lookupEnv func(string) (string, bool)) (backend, error) {
+	if opts.server != "" {
+		return openRemote(ctx, opts)
+	}
+
+	var args []string
+	if opts.config != "" {
+		args = []string{"-config", opts.config}
+	}
+	cfg, err := config.Load(args, lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	if err = cfg.Validate(); err != nil {
+		return nil, err
+	}
+	open, ok := openers[cfg.Storage.Backend]
+	if !ok {
+		return nil, fmt.Errorf("storage backend %q cannot be opened directly, pass -server to go through the admin API of the running server", cfg.Storage.Backend)
+	}
+	r, err := open(cfg.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("open storage: %w", err)
+	}
+	// The configured admins are left out: the commands do not check rights,
+	// and creating those accounts is how they are bootstrapped
+	admin, err := service.NewAdmin(r.users, r.posts, nil)
+	if err != nil {
+		r.close(ctx) //nolint:errcheck
+		return nil, err
+	}
+	return &local{
+		admin: admin,
+		repos: r,
+	}, nil
+}
+
+type remote struct {
+	*client.Client
+}
+
+func openRemote(ctx context.Context, opts options) (*remote, error) {
+	if opts.token == "" && opts.user == "" {
+		return nil, errors.New("-server needs the -token or the -user of an administrator")
+	}
+	c, err := client.New(opts.server, client.WithToken(opts.token))
+	if err != nil {
+		return nil, err
+	}
+	if opts.user != "" {
+		if err = c.Login(ctx, opts.user, opts.password); err != nil {
+			return nil, fmt.Errorf("log in as %s: %w", opts.user, err)
+		}
+	}
+	return &remote{Client: c}, nil
+}
+
+func (r *remote) Users(ctx context.Context) ([]client.UserInfo, error) {
+	return r.AdminUsers(ctx)
+}
+
+func (r *remote) CreateUser(ctx context.Context, username, password, role string) (*client.UserInfo, error) {
+	return r.AdminCreateUser(ctx, username, password, role)
+}
+
+func (r *remote) SetRole(ctx context.Context, username, role string) (*client.UserInfo, error) {
+	return r.AdminSetRole(ctx, username, role)
+}
+
+func (r *remote) ResetPassword(ctx context.Context, username, password string) (*client.UserInfo, error) {
+	return r.AdminResetPassword(ctx, username, password)
+}
+
+func (r *remote) TopPosts(ctx context.Context, category string, limit int) ([]client.PostSummary, error) {
+	return r.AdminTopPosts(ctx, category, limit)
+}
+
+func (r *remote) Post(ctx context.Context, postID string) (*client.PostDetails, error) {
+	return r.AdminPost(ctx, postID)
+}
+
+func (r *remote) DeletePost(ctx context.Context, postID string) error {
+	return r.AdminDeletePost(ctx, postID)
+}
+
+func (r *remote) RestorePost(ctx context.Context, postID string) (*client.PostDetails, error) {
+	return r.AdminRestorePost(ctx, postID)
+}
+
+func (r *remote) DeleteComment(ctx context.Context, postID, commentID string) (*client.PostDetails, error) {
+	return r.AdminDeleteComment(ctx, postID, commentID)
+}
+
+func (r *remote) RestoreComment(ctx context.Context, postID, commentID string) (*client.PostDetails, error) {
+	return r.AdminRestoreComment(ctx, postID, commentID)
+}
+
+func (r *remote) Export(ctx context.Context, w io.Writer) error {
+	return r.AdminExport(ctx, w)
+}
+
+func (r *remote) Import(ctx context.Context, rd io.Reader, opts client.ImportOptions) (*client.ImportReport, error) {
+	return r.AdminImport(ctx, rd, opts)
+}
+
+func (r *remote) Close(ctx context.Context) error {
+	return nil
+}
+
+// local runs the commands on the storage itself, which the server must not
+// be using at the same time.
+type local struct {
+	admin *service.Admin
+	repos repos
+}
+
+func (l *local) Users(ctx context.Context) ([]client.UserInfo, error) {
+	users, err := l.admin.Users()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]client.UserInfo, 0, len(users))
+	if err = convert(users, &infos); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+func (l *local) CreateUser(ctx context.Context, username, password, role string) (*client.UserInfo, error) {
+	parsedRole, err := models.StringToRole(role)
+	if err != nil {
+		return nil, err
+	}
+	return userInfo(l.admin.CreateUser(models.AuthUserInfo{Login: models.Username(username), Password: password}, parsedRole))
+}
+
+func (l *local) SetRole(ctx context.Context, username, role string) (*client.UserInfo, error) {
+	parsedRole, err := models.StringToRole(role)
+	if err != nil {
+		return nil, err
+	}
+	return userInfo(l.admin.SetRole(models.Username(username), parsedRole))
+}
+
+func (l *local) ResetPassword(ctx context.Context, username, password string) (*client.UserInfo, error) {
+	return userInfo(l.admin.ResetPassword(models.Username(username), password))
+}
+
+func (l *local) TopPosts(ctx context.Context, category string, limit int) ([]client.PostSummary, error) {
+	var (
+		posts []models.Post
+		err   error
+	)
+	if category == "" {
+		posts, err = l.admin.TopPosts(ctx, limit)
+	} else {
+		var postCategory models.PostCategory
+		if postCategory, err = models.StringToPostCategory(category); err != nil {
+			return nil, err
+		}
+		posts, err = l.admin.TopPostsByCategory(ctx, postCategory, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]client.PostSummary, 0, len(posts))
+	if err = convert(models.NewPostSummaries(posts, ""), &summaries); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+func (l *local) Post(ctx context.Context, postID string) (*client.PostDetails, error) {
+	return postDetails(l.admin.Post(ctx, models.ID(postID)))
+}
+
+func (l *local) DeletePost(ctx context.Context, postID string) error {
+	return l.admin.DeletePost(ctx, models.ID(postID))
+}
+
+func (l *local) RestorePost(ctx context.Context, postID string) (*client.PostDetails, error) {
+	return postDetails(l.admin.RestorePost(ctx, models.ID(postID)))
+}
+
+func (l *local) DeleteComment(ctx context.Context, postID, commentID string) (*client.PostDetails, error) {
+	return postDetails(l.admin.DeleteComment(ctx, models.ID(postID), models.ID(commentID)))
+}
+
+func (l *local) RestoreComment(ctx context.Context, postID, commentID string) (*client.PostDetails, error) {
+	return postDetails(l.admin.RestoreComment(ctx, models.ID(postID), models.ID(commentID)))
+}
+
+func (l *local) Export(ctx context.Context, w io.Writer) error {
+	snapshot, err := l.admin.Export(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = snapshot.WriteTo(w)
+	return err
+}
+
+// Import returns the report along with the conflicts that stop a merge, like
+// the admin API does.
+func (l *local) Import(ctx context.Context, r io.Reader, opts client.ImportOptions) (*client.ImportReport, error) {
+	mode, err := backup.StringToMode(opts.Mode)
+	if err != nil {
+		return nil, err
+	}
+	onConflict, err := backup.StringToOnConflict(opts.OnConflict)
+	if err != nil {
+		return nil, err
+	}
+	report, err := l.admin.Import(ctx, r, backup.Options{Mode: mode, OnConflict: onConflict, DryRun: opts.DryRun})
+	if err != nil && !errors.Is(err, models.ErrImportConflict) {
+		return nil, err
+	}
+	converted := &client.ImportReport{}
+	if cErr := convert(report, converted); cErr != nil {
+		return nil, cErr
+	}
+	return converted, err
+}
+
+func (l *local) Close(ctx context.Context) error {
+	err := errors.Join(l.repos.posts.Close(ctx), l.repos.users.Close(ctx))
+	if l.repos.close != nil {
+		err = errors.Join(err, l.repos.close(ctx))
+	}
+	return err
+}
+
+func userInfo(user service.UserInfo, err error) (*client.UserInfo, error) {
+	if err != nil {
+		return nil, err
+	}
+	info := &client.UserInfo{}
+	return info, convert(user, info)
+}
+
+func postDetails(post models.Post, err error) (*client.PostDetails, error) {
+	if err != nil {
+		return nil, err
+	}
+	details := &client.PostDetails{}
+	return details, convert(models.NewPostDetails(post, ""), details)
+}
+
+// convert goes through JSON so that both modes produce what the API serves.
+func convert(src, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
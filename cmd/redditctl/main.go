@@ -0,0 +1,512 @@
+// Command redditctl operates an instance of the reddit clone: it manages the
+// users, moderates the posts and exports or imports the data, either through
+// the admin API of a running server or directly on the storage of a stopped
+// one.
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/config"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/pkg/client"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const usage = `usage: redditctl [flags] <command> [command flags] [arguments]
+
+Commands:
+  users list
+  users create [-admin] [-password PASSWORD] USERNAME
+  users promote USERNAME
+  users demote USERNAME
+  users reset-password [-password PASSWORD] USERNAME
+  posts top [-category CATEGORY] [-limit N]
+  posts show POST_ID
+  posts delete POST_ID
+  posts restore POST_ID
+  comments delete POST_ID COMMENT_ID
+  comments restore POST_ID COMMENT_ID
+  data export [-file FILE]
+  data import [-mode merge|replace] [-on-conflict fail|skip|overwrite] FILE
+
+Passwords that are not given are generated and printed. Exports contain the
+passwords of the users, keep them private. FILE is - for the standard input. The commands talk to
+the server at -server with the token of an administrator, or open the storage
+configured in -config when -server is not set.
+
+Flags:
+`
+
+var errUsage = errors.New("invalid usage")
+
+type options struct {
+	server   string
+	token    string
+	user     string
+	password string
+	config   string
+	output   string
+	dryRun   bool
+	timeout  time.Duration
+}
+
+type cli struct {
+	backend backend
+	in      io.Reader
+	out     *printer
+	options *options
+}
+
+type command struct {
+	name string
+	run  func(ctx context.Context, c *cli, args []string) error
+}
+
+var commands = []command{
+	{"users list", listUsers},
+	{"users create", createUser},
+	{"users promote", setRole(models.RoleAdmin)},
+	{"users demote", setRole(models.RoleUser)},
+	{"users reset-password", resetPassword},
+	{"posts top", topPosts},
+	{"posts show", showPost},
+	{"posts delete", deletePost},
+	{"posts restore", restorePost},
+	{"comments delete", deleteComment},
+	{"comments restore", restoreComment},
+	{"data export", exportData},
+	{"data import", importData},
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("redditctl: ")
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.LookupEnv)
+	stop()
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		log.Println(err)
+		os.Exit(2)
+	case err != nil:
+		log.Fatalln(err)
+	}
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, lookupEnv func(string) (string, bool)) error {
+	getenv := func(key string) string {
+		value, _ := lookupEnv(key)
+		return value
+	}
+	opts := &options{
+		password: getenv("REDDITCTL_PASSWORD"),
+		output:   outputTable,
+	}
+	fs := flag.NewFlagSet("redditctl", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&opts.server, "server", getenv("REDDITCTL_SERVER"), "base URL of a running server, e.g. http://localhost:8080 (env REDDITCTL_SERVER)")
+	fs.StringVar(&opts.token, "token", getenv("REDDITCTL_TOKEN"), "token of an administrator (env REDDITCTL_TOKEN)")
+	fs.StringVar(&opts.user, "user", getenv("REDDITCTL_USER"), "administrator to log in as instead of passing a token, the password is read from REDDITCTL_PASSWORD (env REDDITCTL_USER)")
+	fs.StringVar(&opts.config, "config", getenv(config.EnvPrefix+"CONFIG"), "config file of the server whose storage is opened when -server is not set (env "+config.EnvPrefix+"CONFIG)")
+	fs.DurationVar(&opts.timeout, "timeout", 30*time.Second, "time limit of the command")
+	commonFlags(fs, opts)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	args = fs.Args()
+	if len(args) < 2 {
+		fs.Usage()
+		return fmt.Errorf("%w: missing command", errUsage)
+	}
+	name := args[0] + " " + args[1]
+	cmdIdx := slices.IndexFunc(commands, func(cmd command) bool {
+		return cmd.name == name
+	})
+	if cmdIdx == -1 {
+		fs.Usage()
+		return fmt.Errorf("%w: unknown command %q", errUsage, name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.timeout)
+	defer cancel()
+	b, err := openBackend(ctx, *opts, lookupEnv)
+	if err != nil {
+		return err
+	}
+	c := &cli{
+		backend: b,
+		in:      stdin,
+		out:     &printer{w: stdout},
+		options: opts,
+	}
+	err = commands[cmdIdx].run(ctx, c, args[2:])
+	return errors.Join(err, b.Close(ctx))
+}
+
+// commonFlags are accepted before and after the command, the values given
+// before are the defaults after.
+func commonFlags(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.output, "output", opts.output, "output format: table or json")
+	fs.BoolVar(&opts.dryRun, "dry-run", opts.dryRun, "check and print what a command would change without changing it")
+}
+
+// flags parses the arguments of a command, which takes exactly the named
+// positional arguments.
+func (c *cli) flags(name string, args []string, positional []string, define func(fs *flag.FlagSet)) ([]string, error) {
+	fs := flag.NewFlagSet("redditctl "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: redditctl %s [flags] %s\n\nFlags:\n", name, strings.Join(positional, " "))
+		fs.PrintDefaults()
+	}
+	commonFlags(fs, c.options)
+	if define != nil {
+		define(fs)
+	}
+	// Flags may follow the arguments, e.g. posts delete POST_ID -dry-run
+	var values []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		values = append(values, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(values) != len(positional) {
+		fs.Usage()
+		return nil, fmt.Errorf("%w: %s takes %d arguments", errUsage, name, len(positional))
+	}
+	if c.options.output != outputTable && c.options.output != outputJSON {
+		return nil, fmt.Errorf("%w: -output must be table or json", errUsage)
+	}
+	c.out.format = c.options.output
+	return values, nil
+}
+
+func listUsers(ctx context.Context, c *cli, args []string) error {
+	if _, err := c.flags("users list", args, nil, nil); err != nil {
+		return err
+	}
+	users, err := c.backend.Users(ctx)
+	if err != nil {
+		return err
+	}
+	return c.out.users(users)
+}
+
+func createUser(ctx context.Context, c *cli, args []string) error {
+	var (
+		admin    bool
+		password string
+	)
+	args, err := c.flags("users create", args, []string{"USERNAME"}, func(fs *flag.FlagSet) {
+		fs.BoolVar(&admin, "admin", false, "make the user an administrator")
+		fs.StringVar(&password, "password", "", "password of the user, generated when empty")
+	})
+	if err != nil {
+		return err
+	}
+
+	role := client.RoleUser
+	if admin {
+		role = client.RoleAdmin
+	}
+	generated := ""
+	if password == "" {
+		if password, err = generatePassword(); err != nil {
+			return err
+		}
+		generated = password
+	}
+	username := args[0]
+	result := change{Action: "create user", DryRun: c.options.dryRun}
+
+	if c.options.dryRun {
+		if err = (models.AuthUserInfo{Login: models.Username(username), Password: password}).Validate(); err != nil {
+			return err
+		}
+		if _, err = c.findUser(ctx, username); err == nil {
+			return fmt.Errorf("user %s already exists", username)
+		}
+		if !errors.Is(err, client.ErrUnknownUser) {
+			return err
+		}
+		result.Target = client.UserInfo{Username: username, Role: role}
+	} else {
+		if result.Target, err = c.backend.CreateUser(ctx, username, password, role); err != nil {
+			return err
+		}
+		result.Password = generated
+	}
+	return c.out.change(result, username+" ("+role+")")
+}
+
+func setRole(role models.Role) func(ctx context.Context, c *cli, args []string) error {
+	name := "users promote"
+	if role == models.RoleUser {
+		name = "users demote"
+	}
+	return func(ctx context.Context, c *cli, args []string) error {
+		args, err := c.flags(name, args, []string{"USERNAME"}, nil)
+		if err != nil {
+			return err
+		}
+		user, err := c.findUser(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		result := change{Action: "set role of", DryRun: c.options.dryRun, Target: user}
+		description := fmt.Sprintf("%s (%s -> %s)", user.Username, user.Role, role)
+
+		if !c.options.dryRun {
+			if result.Target, err = c.backend.SetRole(ctx, user.Username, string(role)); err != nil {
+				return err
+			}
+		}
+		return c.out.change(result, description)
+	}
+}
+
+func resetPassword(ctx context.Context, c *cli, args []string) error {
+	var password string
+	args, err := c.flags("users reset-password", args, []string{"USERNAME"}, func(fs *flag.FlagSet) {
+		fs.StringVar(&password, "password", "", "new password, generated when empty")
+	})
+	if err != nil {
+		return err
+	}
+	user, err := c.findUser(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	generated := ""
+	if password == "" {
+		if password, err = generatePassword(); err != nil {
+			return err
+		}
+		generated = password
+	}
+	result := change{Action: "reset password of", DryRun: c.options.dryRun, Target: user}
+	if !c.options.dryRun {
+		if result.Target, err = c.backend.ResetPassword(ctx, user.Username, password); err != nil {
+			return err
+		}
+		result.Password = generated
+	}
+	return c.out.change(result, user.Username)
+}
+
+func topPosts(ctx context.Context, c *cli, args []string) error {
+	var (
+		category string
+		limit    int
+	)
+	_, err := c.flags("posts top", args, nil, func(fs *flag.FlagSet) {
+		fs.StringVar(&category, "category", "", "only list the posts of this category")
+		fs.IntVar(&limit, "limit", 20, "number of posts to list, 0 lists every post")
+	})
+	if err != nil {
+		return err
+	}
+	posts, err := c.backend.TopPosts(ctx, category, limit)
+	if err != nil {
+		return err
+	}
+	return c.out.posts(posts)
+}
+
+func showPost(ctx context.Context, c *cli, args []string) error {
+	args, err := c.flags("posts show", args, []string{"POST_ID"}, nil)
+	if err != nil {
+		return err
+	}
+	post, err := c.backend.Post(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return c.out.post(post)
+}
+
+func deletePost(ctx context.Context, c *cli, args []string) error {
+	args, err := c.flags("posts delete", args, []string{"POST_ID"}, nil)
+	if err != nil {
+		return err
+	}
+	post, err := c.backend.Post(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if !c.options.dryRun {
+		if err = c.backend.DeletePost(ctx, post.ID); err != nil {
+			return err
+		}
+	}
+	description := fmt.Sprintf("%s %q by %s with %d comments", post.ID, cell(post.Title), post.Author.Username, len(post.Comments))
+	return c.out.change(change{Action: "delete post", DryRun: c.options.dryRun, Target: post}, description)
+}
+
+// restorePost cannot look deleted posts up, a dry run only checks the
+// arguments.
+func restorePost(ctx context.Context, c *cli, args []string) error {
+	args, err := c.flags("posts restore", args, []string{"POST_ID"}, nil)
+	if err != nil {
+		return err
+	}
+	result := change{Action: "restore post", DryRun: c.options.dryRun}
+	if !c.options.dryRun {
+		if result.Target, err = c.backend.RestorePost(ctx, args[0]); err != nil {
+			return err
+		}
+	}
+	return c.out.change(result, args[0])
+}
+
+func deleteComment(ctx context.Context, c *cli, args []string) error {
+	args, err := c.flags("comments delete", args, []string{"POST_ID", "COMMENT_ID"}, nil)
+	if err != nil {
+		return err
+	}
+	post, err := c.backend.Post(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	commentIdx := slices.IndexFunc(post.Comments, func(comment client.Comment) bool {
+		return comment.ID == args[1]
+	})
+	if commentIdx == -1 {
+		return client.ErrCommentNotFound
+	}
+	comment := post.Comments[commentIdx]
+
+	result := change{Action: "delete comment", DryRun: c.options.dryRun, Target: comment}
+	if !c.options.dryRun {
+		if result.Target, err = c.backend.DeleteComment(ctx, post.ID, comment.ID); err != nil {
+			return err
+		}
+	}
+	description := fmt.Sprintf("%s by %s on %q", comment.ID, comment.Author.Username, cell(post.Title))
+	return c.out.change(result, description)
+}
+
+func restoreComment(ctx context.Context, c *cli, args []string) error {
+	args, err := c.flags("comments restore", args, []string{"POST_ID", "COMMENT_ID"}, nil)
+	if err != nil {
+		return err
+	}
+	result := change{Action: "restore comment", DryRun: c.options.dryRun}
+	if !c.options.dryRun {
+		if result.Target, err = c.backend.RestoreComment(ctx, args[0], args[1]); err != nil {
+			return err
+		}
+	}
+	return c.out.change(result, args[1])
+}
+
+// exportData writes to the standard output unless -file is given. The file
+// only appears once the export is complete.
+func exportData(ctx context.Context, c *cli, args []string) error {
+	var file string
+	_, err := c.flags("data export", args, nil, func(fs *flag.FlagSet) {
+		fs.StringVar(&file, "file", "", "file to write the export to instead of the standard output")
+	})
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		return c.backend.Export(ctx, c.out.w)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = c.backend.Export(ctx, tmp); err == nil {
+		err = tmp.Sync()
+	}
+	if err = errors.Join(err, tmp.Close()); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), file); err != nil {
+		return err
+	}
+	return c.out.change(change{Action: "export to", Target: file}, file)
+}
+
+func importData(ctx context.Context, c *cli, args []string) error {
+	var opts client.ImportOptions
+	args, err := c.flags("data import", args, []string{"FILE"}, func(fs *flag.FlagSet) {
+		fs.StringVar(&opts.Mode, "mode", "merge", "merge adds to the stored data, replace also drops what the export does not contain")
+		fs.StringVar(&opts.OnConflict, "on-conflict", "fail", "what a merge does with a user or post that is stored with other data: fail, skip or overwrite")
+	})
+	if err != nil {
+		return err
+	}
+	switch {
+	case opts.Mode != "merge" && opts.Mode != "replace":
+		return fmt.Errorf("%w: -mode must be merge or replace", errUsage)
+	case !slices.Contains([]string{"fail", "skip", "overwrite"}, opts.OnConflict):
+		return fmt.Errorf("%w: -on-conflict must be fail, skip or overwrite", errUsage)
+	}
+	opts.DryRun = c.options.dryRun
+
+	r := c.in
+	if args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	report, err := c.backend.Import(ctx, r, opts)
+	if report != nil {
+		if pErr := c.out.importReport(report); pErr != nil {
+			return pErr
+		}
+	}
+	return err
+}
+
+func (c *cli) findUser(ctx context.Context, username string) (client.UserInfo, error) {
+	users, err := c.backend.Users(ctx)
+	if err != nil {
+		return client.UserInfo{}, err
+	}
+	userIdx := slices.IndexFunc(users, func(user client.UserInfo) bool {
+		return user.Username == username
+	})
+	if userIdx == -1 {
+		return client.UserInfo{}, fmt.Errorf("%s: %w", username, client.ErrUnknownUser)
+	}
+	return users[userIdx], nil
+}
+
+func generatePassword() (string, error) {
+	secret := make([]byte, 12)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("generate password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
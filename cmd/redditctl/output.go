@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/pkg/client"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+const (
+	outputTable   = "table"
+	outputJSON    = "json"
+	maxCellLength = 60
+)
+
+// change is the JSON output of the commands that modify something.
+type change struct {
+	Action string      `json:"action"`
+	DryRun bool        `json:"dryRun"`
+	Target interface{} `json:"target"`
+	// Password is only set when it was generated by the command
+	Password string `json:"password,omitempty"`
+}
+
+type printer struct {
+	w      io.Writer
+	format string
+}
+
+// print writes v as JSON or lets table lay it out in aligned columns.
+func (p *printer) print(v interface{}, table func(w io.Writer)) error {
+	if p.format == outputJSON {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+func (p *printer) users(users []client.UserInfo) error {
+	return p.print(users, func(w io.Writer) {
+		fmt.Fprintln(w, "USERNAME\tROLE\tID")
+		for _, user := range users {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", user.Username, user.Role, user.ID)
+		}
+	})
+}
+
+func (p *printer) posts(posts []client.PostSummary) error {
+	return p.print(posts, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tSCORE\tVIEWS\tCOMMENTS\tCATEGORY\tAUTHOR\tTITLE")
+		for _, post := range posts {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\t%s\n",
+				post.ID, post.Score, post.Views, post.CommentCount, post.Category, post.Author.Username, cell(post.Title))
+		}
+	})
+}
+
+func (p *printer) post(post *client.PostDetails) error {
+	return p.print(post, func(w io.Writer) {
+		fmt.Fprintf(w, "ID\t%s\n", post.ID)
+		fmt.Fprintf(w, "TITLE\t%s\n", post.Title)
+		fmt.Fprintf(w, "CATEGORY\t%s\n", post.Category)
+		fmt.Fprintf(w, "AUTHOR\t%s\n", post.Author.Username)
+		fmt.Fprintf(w, "SCORE\t%d (+%d/-%d)\n", post.Score, post.Upvotes, post.Downvotes)
+		fmt.Fprintf(w, "VIEWS\t%d\n", post.Views)
+		fmt.Fprintf(w, "CREATED\t%s\n", post.Created)
+		if post.URL != "" {
+			fmt.Fprintf(w, "URL\t%s\n", post.URL)
+		} else {
+			fmt.Fprintf(w, "TEXT\t%s\n", cell(post.Text))
+		}
+		if len(post.Comments) == 0 {
+			return
+		}
+		fmt.Fprintln(w, "\nCOMMENT\tAUTHOR\tCREATED\tBODY")
+		for _, comment := range post.Comments {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", comment.ID, comment.Author.Username, comment.Created, cell(comment.Body))
+		}
+	})
+}
+
+// change reports a modification, described in a few words for the table.
+func (p *printer) change(c change, description string) error {
+	return p.print(c, func(w io.Writer) {
+		status := "done"
+		if c.DryRun {
+			status = "dry run, nothing changed"
+		}
+		fmt.Fprintf(w, "%s %s: %s\n", c.Action, description, status)
+		if c.Password != "" {
+			fmt.Fprintf(w, "password: %s\n", c.Password)
+		}
+	})
+}
+
+func (p *printer) importReport(report *client.ImportReport) error {
+	return p.print(report, func(w io.Writer) {
+		status := "done"
+		switch {
+		case report.DryRun:
+			status = "dry run, nothing changed"
+		case !report.Applied:
+			status = "stopped by conflicts, nothing changed"
+		}
+		fmt.Fprintf(w, "import (%s, on conflict %s): %s\n\n", report.Mode, report.OnConflict, status)
+		fmt.Fprintln(w, "RECORDS\tUSERS\tPOSTS\tCOMMENTS\tVOTES")
+		fmt.Fprintf(w, "\t%d\t%d\t%d\t%d\n\n", report.Records.Users, report.Records.Posts, report.Records.Comments, report.Records.Votes)
+		fmt.Fprintln(w, "\tADDED\tOVERWRITTEN\tUNCHANGED\tSKIPPED\tREMOVED")
+		for _, row := range []struct {
+			name    string
+			changes client.ImportChanges
+		}{{"USERS", report.Users}, {"POSTS", report.Posts}} {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\n",
+				row.name, row.changes.Added, row.changes.Overwritten, row.changes.Unchanged, row.changes.Skipped, row.changes.Removed)
+		}
+		if len(report.Conflicts) == 0 {
+			return
+		}
+		fmt.Fprintln(w, "\nCONFLICT\tID\tREASON")
+		for _, conflict := range report.Conflicts {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", conflict.Type, conflict.ID, conflict.Reason)
+		}
+	})
+}
+
+// cell shortens the text to a single line that fits in a table column.
+func cell(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= maxCellLength {
+		return text
+	}
+	return string([]rune(text)[:maxCellLength-1]) + "…"
+}
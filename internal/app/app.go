@@ -0,0 +1,146 @@
+package app
+
+import (
+	"github.com/Benzogang-Tape/Reddit-clone/internal/config"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/events"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/metrics"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/ratelimit"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/storage"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/tracing"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/transport/gql"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/transport/rest"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/transport/rpc"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
+	"github.com/Benzogang-Tape/Reddit-clone/static"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"io/fs"
+	"net/http"
+	"os"
+)
+
+// App is the reddit clone wired over its storage: the services with their
+// metrics, traces and events, and the HTTP and gRPC fronts. The server binary
+// and the tests build it with New, so they run the same router.
+type App struct {
+	// Handler serves the whole HTTP API and the frontend
+	Handler http.Handler
+	Router  *rest.AppRouter
+	OpenAPI *rest.OpenAPIHandler
+	Health  *rest.HealthHandler
+	Broker  *events.Broker
+	// GRPC is nil unless cfg.GRPC.Addr is set, the caller serves it
+	GRPC     *grpc.Server
+	Attempts *storage.AttemptRepo
+}
+
+// New wires the app described by cfg over users and posts. Sessions and the
+// tracer provider are process-wide and are set up by the caller.
+func New(cfg *config.Config, users *storage.UserRepo, posts *storage.PostRepo, logger *zap.SugaredLogger) (*App, error) {
+	decoder := rest.NewRequestDecoder(cfg.HTTP.MaxBodyBytes)
+	m := metrics.New()
+
+	userHandler := service.NewUserHandler(m.UserStorage(users))
+	attempts := storage.NewAttemptRepo()
+	loginGuard := service.NewLoginGuard(attempts, service.DefaultUserLockout, service.DefaultIPLockout)
+	u := rest.NewUserHandler(userHandler, loginGuard, decoder, logger)
+
+	instrumentedPosts := m.PostStorage(tracing.WrapPosts("storage", posts))
+	broker := events.NewBroker()
+	postHandler := events.WrapPosts(broker, tracing.WrapPosts("service", service.NewPostHandler(instrumentedPosts, instrumentedPosts)))
+	p := rest.NewPostHandler(postHandler, decoder, logger)
+
+	admins := make([]models.Username, 0, len(cfg.Auth.Admins))
+	for _, login := range cfg.Auth.Admins {
+		admins = append(admins, models.Username(login))
+	}
+	adminService, err := service.NewAdmin(users, events.WrapAdminPosts(broker, posts), admins)
+	if err != nil {
+		return nil, errors.Wrap(err, "New: ")
+	}
+	a := rest.NewAdminHandler(adminService, decoder, logger)
+
+	h := rest.NewHealthHandler()
+	h.AddCheck("storage.posts", posts.Ping)
+	h.AddCheck("storage.users", users.Ping)
+
+	ipResolver, err := mdwr.NewIPResolver(cfg.HTTP.TrustedProxies)
+	if err != nil {
+		return nil, errors.Wrap(err, "New: ")
+	}
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		limiter = ratelimit.NewLimiter(ratelimit.NewMemoryStore(), cfg.RateLimitPolicies(), logger)
+	}
+
+	var assets fs.FS = static.FS
+	if cfg.Assets.StaticDir != "" {
+		assets = os.DirFS(cfg.Assets.StaticDir)
+	}
+	pg, err := rest.NewPageHandler(posts, assets, cfg.Assets.Templates, cfg.HTTP.PublicURL, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "New: ")
+	}
+	f := rest.NewFeedHandler(posts, cfg.HTTP.PublicURL, logger)
+
+	var graphQL *rest.GraphQLHandler
+	if cfg.GraphQL.Enabled {
+		executor, err := gql.NewExecutor(postHandler, rest.DefaultErrorRegistry(), gql.Options{
+			MaxDepth:      cfg.GraphQL.MaxDepth,
+			MaxComplexity: cfg.GraphQL.MaxComplexity,
+			MaxAliases:    cfg.GraphQL.MaxAliases,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "New: ")
+		}
+		graphQL = rest.NewGraphQLHandler(executor, decoder)
+	}
+
+	openAPI, err := rest.NewOpenAPIHandler(decoder, rest.OpenAPIOptions{
+		ValidateRequests:  cfg.OpenAPI.ValidateRequests,
+		ValidateResponses: cfg.OpenAPI.ValidateResponses,
+	}, logger)
+	if err != nil {
+		return nil, errors.Wrap(err, "New: ")
+	}
+
+	router := rest.NewAppRouter(u, p, h, pg, f, m, rest.RouterOptions{
+		Assets:               assets,
+		AccessLogSampleRates: cfg.Log.AccessSampleRates,
+		IPResolver:           ipResolver,
+		RateLimiter:          limiter,
+		GraphQL:              graphQL,
+		OpenAPI:              openAPI,
+		Admin:                a,
+		CORS: mdwr.CORSOptions{
+			AllowedOrigins:   cfg.Security.CORSAllowedOrigins,
+			AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodDelete},
+			AllowedHeaders:   []string{"Authorization", "Content-Type", mdwr.RequestIDHeader, mdwr.CSRFHeaderName},
+			ExposedHeaders:   []string{"ETag", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", mdwr.RequestIDHeader},
+			AllowCredentials: cfg.Security.CORSAllowCredentials,
+			MaxAge:           int(cfg.Security.CORSMaxAge.Seconds()),
+		},
+		Security: mdwr.SecurityOptions{
+			ContentSecurityPolicy: cfg.Security.ContentSecurityPolicy,
+			HSTSMaxAge:            int(cfg.Security.HSTSMaxAge.Seconds()),
+			FrameOptions:          cfg.Security.FrameOptions,
+		},
+		SessionCookie: cfg.Security.SessionCookie,
+	})
+
+	app := &App{
+		Handler:  router.InitRouter(logger),
+		Router:   router,
+		OpenAPI:  openAPI,
+		Health:   h,
+		Broker:   broker,
+		Attempts: attempts,
+	}
+	if cfg.GRPC.Addr != "" {
+		app.GRPC = rpc.NewGRPCServer(rpc.NewServer(postHandler, userHandler, loginGuard, broker, logger), limiter, logger)
+	}
+	return app, nil
+}
@@ -0,0 +1,267 @@
+// Package backup exports the users and the posts to a portable JSON Lines
+// file and imports them back.
+//
+// An export is a header line, the users, then every post followed by its
+// comments and votes, and a manifest line that counts the records and holds
+// the SHA-256 of every line before it. A file without its manifest has been
+// truncated and is rejected as a whole.
+package backup
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/pkg/errors"
+	"hash"
+	"io"
+	"time"
+)
+
+const (
+	Format = "reddit-clone"
+	// Version 2 replaced the passwords of the users with their bcrypt hashes
+	Version     = 2
+	ContentType = "application/x-ndjson"
+)
+
+const (
+	typeHeader   = "header"
+	typeUser     = "user"
+	typePost     = "post"
+	typeComment  = "comment"
+	typeVote     = "vote"
+	typeManifest = "manifest"
+)
+
+type UserStorage interface {
+	GetAllUsers() ([]models.User, error)
+	Replace(replace func(current []models.User) ([]models.User, error)) error
+}
+
+type PostStorage interface {
+	Snapshot(ctx context.Context) ([]models.Post, error)
+	Replace(ctx context.Context, replace func(current []models.Post) ([]models.Post, error)) error
+}
+
+// Counts is the number of records of each type in an export.
+type Counts struct {
+	Users    int `json:"users"`
+	Posts    int `json:"posts"`
+	Comments int `json:"comments"`
+	Votes    int `json:"votes"`
+}
+
+type headerRecord struct {
+	Type    string `json:"type"`
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Created string `json:"created"`
+}
+
+type userRecord struct {
+	Type         string          `json:"type"`
+	ID           models.ID       `json:"id"`
+	Username     models.Username `json:"username"`
+	PasswordHash string          `json:"passwordHash,omitempty"`
+	// Password is what version 1 exports hold instead of the hash
+	Password string      `json:"password,omitempty"`
+	Role     models.Role `json:"role"`
+}
+
+type postRecord struct {
+	Type     string              `json:"type"`
+	ID       models.ID           `json:"id"`
+	PostType models.PostType     `json:"postType"`
+	Category models.PostCategory `json:"category"`
+	Title    string              `json:"title"`
+	URL      string              `json:"url,omitempty"`
+	Text     string              `json:"text,omitempty"`
+	Author   models.TokenPayload `json:"author"`
+	Views    uint                `json:"views"`
+	Created  string              `json:"created"`
+}
+
+type commentRecord struct {
+	Type    string              `json:"type"`
+	ID      models.ID           `json:"id"`
+	Post    models.ID           `json:"post"`
+	Author  models.TokenPayload `json:"author"`
+	Body    string              `json:"body"`
+	Created string              `json:"created"`
+}
+
+type voteRecord struct {
+	Type string      `json:"type"`
+	Post models.ID   `json:"post"`
+	User models.ID   `json:"user"`
+	Vote models.Vote `json:"vote"`
+}
+
+type manifestRecord struct {
+	Type    string `json:"type"`
+	Records Counts `json:"records"`
+	SHA256  string `json:"sha256"`
+}
+
+// Snapshot is a copy of the stored data that can be written out while the
+// repositories keep changing.
+type Snapshot struct {
+	Created time.Time
+	users   []models.User
+	posts   []models.Post
+}
+
+// Take copies the posts, then the users: users are never removed by the
+// application, so every author and voter of the copied posts is still there.
+func Take(ctx context.Context, users UserStorage, posts PostStorage) (*Snapshot, error) {
+	postList, err := posts.Snapshot(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "Take: ")
+	}
+	userList, err := users.GetAllUsers()
+	if err != nil {
+		return nil, errors.Wrap(err, "Take: ")
+	}
+	return NewSnapshot(userList, postList), nil
+}
+
+// NewSnapshot wraps copies of the users and the posts the caller took itself.
+func NewSnapshot(users []models.User, posts []models.Post) *Snapshot {
+	return &Snapshot{
+		Created: time.Now().UTC(),
+		users:   users,
+		posts:   posts,
+	}
+}
+
+func (s *Snapshot) ContentType() string {
+	return ContentType
+}
+
+// Counts returns the number of records the export of s contains.
+func (s *Snapshot) Counts() Counts {
+	counts := Counts{Users: len(s.users), Posts: len(s.posts)}
+	for _, post := range s.posts {
+		counts.Comments += len(post.Comments)
+		counts.Votes += len(post.Votes)
+	}
+	return counts
+}
+
+// WriteTo writes the export of s to w.
+func (s *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	enc := newEncoder(w)
+	enc.encode(headerRecord{
+		Type:    typeHeader,
+		Format:  Format,
+		Version: Version,
+		Created: s.Created.Format(time.RFC3339Nano),
+	})
+	for _, user := range s.users {
+		enc.encode(newUserRecord(user))
+	}
+	for _, post := range s.posts {
+		enc.encode(newPostRecord(post))
+		for _, comment := range post.Comments {
+			enc.encode(newCommentRecord(post.ID, comment))
+		}
+		for _, vote := range post.Votes {
+			enc.encode(newVoteRecord(post.ID, vote))
+		}
+	}
+	sum := hex.EncodeToString(enc.hash.Sum(nil))
+	enc.hash = nil
+	enc.encode(manifestRecord{
+		Type:    typeManifest,
+		Records: s.Counts(),
+		SHA256:  sum,
+	})
+	if enc.err == nil {
+		enc.err = enc.w.Flush()
+	}
+	return enc.n, enc.err
+}
+
+// encoder writes one record per line and hashes them until hash is unset.
+type encoder struct {
+	w    *bufio.Writer
+	hash hash.Hash
+	n    int64
+	err  error
+}
+
+func newEncoder(w io.Writer) *encoder {
+	return &encoder{
+		w:    bufio.NewWriter(w),
+		hash: sha256.New(),
+	}
+}
+
+func (e *encoder) encode(record interface{}) {
+	if e.err != nil {
+		return
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		e.err = err
+		return
+	}
+	line = append(line, '\n')
+	n, err := e.w.Write(line)
+	e.n += int64(n)
+	if err != nil {
+		e.err = err
+		return
+	}
+	if e.hash != nil {
+		e.hash.Write(line)
+	}
+}
+
+func newUserRecord(user models.User) userRecord {
+	return userRecord{
+		Type:         typeUser,
+		ID:           user.ID,
+		Username:     user.Username,
+		PasswordHash: user.PasswordHash,
+		Role:         user.Role,
+	}
+}
+
+func newPostRecord(post models.Post) postRecord {
+	return postRecord{
+		Type:     typePost,
+		ID:       post.ID,
+		PostType: post.Type,
+		Category: post.Category,
+		Title:    post.Title,
+		URL:      post.URL,
+		Text:     post.Text,
+		Author:   post.Author,
+		Views:    post.Views,
+		Created:  post.Created,
+	}
+}
+
+func newCommentRecord(postID models.ID, comment *models.PostComment) commentRecord {
+	return commentRecord{
+		Type:    typeComment,
+		ID:      comment.ID,
+		Post:    postID,
+		Author:  comment.Author,
+		Body:    comment.Body,
+		Created: comment.Created,
+	}
+}
+
+func newVoteRecord(postID models.ID, vote *models.PostVote) voteRecord {
+	return voteRecord{
+		Type: typeVote,
+		Post: postID,
+		User: vote.UserID,
+		Vote: vote.Vote,
+	}
+}
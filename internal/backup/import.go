@@ -0,0 +1,585 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/pkg/errors"
+	"io"
+	"time"
+)
+
+type Mode string
+
+const (
+	// ModeMerge adds the imported records to the stored ones
+	ModeMerge Mode = "merge"
+	// ModeReplace drops the stored users and posts the export does not contain
+	ModeReplace Mode = "replace"
+)
+
+// OnConflict decides what a merge does with an imported user or post whose ID
+// or username is already taken by a different one.
+type OnConflict string
+
+const (
+	ConflictFail      OnConflict = "fail"
+	ConflictSkip      OnConflict = "skip"
+	ConflictOverwrite OnConflict = "overwrite"
+)
+
+type Options struct {
+	Mode       Mode
+	OnConflict OnConflict
+	// DryRun reports what the import would change without changing anything
+	DryRun bool
+}
+
+// Changes counts what an import does to the stored users or posts.
+type Changes struct {
+	Added       int `json:"added"`
+	Overwritten int `json:"overwritten"`
+	Unchanged   int `json:"unchanged"`
+	Skipped     int `json:"skipped"`
+	Removed     int `json:"removed"`
+}
+
+type Conflict struct {
+	Type   string    `json:"type"`
+	ID     models.ID `json:"id"`
+	Reason string    `json:"reason"`
+}
+
+type Report struct {
+	Mode       Mode       `json:"mode"`
+	OnConflict OnConflict `json:"onConflict"`
+	DryRun     bool       `json:"dryRun"`
+	Applied    bool       `json:"applied"`
+	Records    Counts     `json:"records"`
+	Users      Changes    `json:"users"`
+	Posts      Changes    `json:"posts"`
+	Conflicts  []Conflict `json:"conflicts"`
+}
+
+// FormatError is an export that cannot be imported. Line is zero when the
+// problem is not on a single line, such as a missing manifest.
+type FormatError struct {
+	Line int
+	Msg  string
+}
+
+func (e *FormatError) Error() string {
+	if e.Line == 0 {
+		return models.ErrInvalidExport.Error() + ": " + e.Msg
+	}
+	return fmt.Sprintf("%s: line %d: %s", models.ErrInvalidExport, e.Line, e.Msg)
+}
+
+func (e *FormatError) Unwrap() error {
+	return models.ErrInvalidExport
+}
+
+func StringToMode(mode string) (Mode, error) {
+	switch Mode(mode) {
+	case "":
+		return ModeMerge, nil
+	case ModeMerge, ModeReplace:
+		return Mode(mode), nil
+	}
+	return "", errors.Errorf("unknown import mode %q", mode)
+}
+
+func StringToOnConflict(onConflict string) (OnConflict, error) {
+	switch OnConflict(onConflict) {
+	case "":
+		return ConflictFail, nil
+	case ConflictFail, ConflictSkip, ConflictOverwrite:
+		return OnConflict(onConflict), nil
+	}
+	return "", errors.Errorf("unknown conflict policy %q", onConflict)
+}
+
+// Import reads the whole export from r, checks it against its manifest and
+// only then changes the repositories. The import is planned against the
+// current data first, so that conflicts are reported before anything is
+// written, and planned again under the locks of both repositories when
+// applied.
+func Import(ctx context.Context, r io.Reader, users UserStorage, posts PostStorage, opts Options) (Report, error) {
+	data, err := read(r)
+	if err != nil {
+		return Report{}, err
+	}
+	report := Report{
+		Mode:       opts.Mode,
+		OnConflict: opts.OnConflict,
+		DryRun:     opts.DryRun,
+		Records:    data.counts,
+		Conflicts:  make([]Conflict, 0),
+	}
+
+	currentUsers, err := users.GetAllUsers()
+	if err != nil {
+		return report, errors.Wrap(err, "Import: ")
+	}
+	currentPosts, err := posts.Snapshot(ctx)
+	if err != nil {
+		return report, errors.Wrap(err, "Import: ")
+	}
+	userPlan := mergeUsers(currentUsers, data.users, opts)
+	postPlan := mergePosts(currentPosts, data.posts, opts)
+	report.Users, report.Posts = userPlan.changes, postPlan.changes
+	report.Conflicts = append(append(report.Conflicts, userPlan.conflicts...), postPlan.conflicts...)
+	if err = opts.check(report.Conflicts); err != nil || opts.DryRun {
+		return report, err
+	}
+
+	// Both plans are checked again while both repositories are locked, posts
+	// first like the snapshots do, so that a conflict that appeared in the
+	// meantime leaves the users untouched too. Only the posts can then still
+	// fail to be stored after the users were replaced.
+	err = posts.Replace(ctx, func(currentPosts []models.Post) ([]models.Post, error) {
+		postPlan := mergePosts(currentPosts, data.posts, opts)
+		err := users.Replace(func(currentUsers []models.User) ([]models.User, error) {
+			userPlan := mergeUsers(currentUsers, data.users, opts)
+			conflicts := append(append(make([]Conflict, 0), userPlan.conflicts...), postPlan.conflicts...)
+			if err := opts.check(conflicts); err != nil {
+				return nil, err
+			}
+			report.Users = userPlan.changes
+			return userPlan.result, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		report.Posts = postPlan.changes
+		return postPlan.result, nil
+	})
+	if err != nil {
+		return report, errors.Wrap(err, "Import: ")
+	}
+	report.Applied = true
+	return report, nil
+}
+
+// check fails on the conflicts the options do not resolve. Overwriting never
+// resolves a comment ID that belongs to another post.
+func (opts Options) check(conflicts []Conflict) error {
+	unresolved := 0
+	for _, conflict := range conflicts {
+		if opts.OnConflict == ConflictFail || (opts.OnConflict == ConflictOverwrite && conflict.Type == typeComment) {
+			unresolved++
+		}
+	}
+	if unresolved > 0 {
+		return errors.Wrapf(models.ErrImportConflict, "%d unresolved conflicts", unresolved)
+	}
+	return nil
+}
+
+type plan[T any] struct {
+	result    []T
+	changes   Changes
+	conflicts []Conflict
+}
+
+func mergeUsers(current, imported []models.User, opts Options) plan[models.User] {
+	p := plan[models.User]{result: make([]models.User, 0, len(current)+len(imported))}
+	if opts.Mode == ModeReplace {
+		byID := make(map[models.ID]models.User, len(current))
+		for _, user := range current {
+			byID[user.ID] = user
+		}
+		for _, user := range imported {
+			old, ok := byID[user.ID]
+			switch {
+			case !ok:
+				p.changes.Added++
+			case old == user:
+				p.changes.Unchanged++
+			default:
+				p.changes.Overwritten++
+			}
+			delete(byID, user.ID)
+		}
+		p.changes.Removed = len(byID)
+		p.result = append(p.result, imported...)
+		return p
+	}
+
+	byID := make(map[models.ID]int, len(current))
+	byName := make(map[models.Username]int, len(current))
+	for i, user := range current {
+		byID[user.ID], byName[user.Username] = i, i
+	}
+	dropped := make(map[int]bool)
+	added := make([]models.User, 0, len(imported))
+	for _, user := range imported {
+		idIdx, idTaken := byID[user.ID]
+		nameIdx, nameTaken := byName[user.Username]
+		switch {
+		case !idTaken && !nameTaken:
+			p.changes.Added++
+			added = append(added, user)
+			continue
+		case idTaken && current[idIdx] == user:
+			p.changes.Unchanged++
+			continue
+		case nameTaken && (!idTaken || nameIdx != idIdx):
+			p.conflicts = append(p.conflicts, Conflict{
+				Type:   typeUser,
+				ID:     user.ID,
+				Reason: fmt.Sprintf("username %s is taken by user %s", user.Username, current[nameIdx].ID),
+			})
+		default:
+			p.conflicts = append(p.conflicts, Conflict{
+				Type:   typeUser,
+				ID:     user.ID,
+				Reason: "a different user has this id",
+			})
+		}
+		if opts.OnConflict != ConflictOverwrite {
+			p.changes.Skipped++
+			continue
+		}
+		p.changes.Overwritten++
+		if idTaken {
+			dropped[idIdx] = true
+		}
+		if nameTaken {
+			dropped[nameIdx] = true
+		}
+		added = append(added, user)
+	}
+	for i, user := range current {
+		if !dropped[i] {
+			p.result = append(p.result, user)
+		}
+	}
+	p.result = append(p.result, added...)
+	return p
+}
+
+func mergePosts(current, imported []models.Post, opts Options) plan[models.Post] {
+	p := plan[models.Post]{result: make([]models.Post, 0, len(current)+len(imported))}
+	if opts.Mode == ModeReplace {
+		byID := make(map[models.ID]models.Post, len(current))
+		for _, post := range current {
+			byID[post.ID] = post
+		}
+		for _, post := range imported {
+			old, ok := byID[post.ID]
+			switch {
+			case !ok:
+				p.changes.Added++
+			case samePost(old, post):
+				p.changes.Unchanged++
+			default:
+				p.changes.Overwritten++
+			}
+			delete(byID, post.ID)
+		}
+		p.changes.Removed = len(byID)
+		p.result = append(p.result, imported...)
+		return p
+	}
+
+	byID := make(map[models.ID]int, len(current))
+	commentPosts := make(map[models.ID]models.ID)
+	for i, post := range current {
+		byID[post.ID] = i
+		for _, comment := range post.Comments {
+			commentPosts[comment.ID] = post.ID
+		}
+	}
+	dropped := make(map[int]bool)
+	added := make([]models.Post, 0, len(imported))
+	for _, post := range imported {
+		if conflict, ok := commentConflict(post, commentPosts); ok {
+			p.conflicts = append(p.conflicts, conflict)
+			p.changes.Skipped++
+			continue
+		}
+		idx, taken := byID[post.ID]
+		switch {
+		case !taken:
+			p.changes.Added++
+			added = append(added, post)
+			continue
+		case samePost(current[idx], post):
+			p.changes.Unchanged++
+			continue
+		}
+		p.conflicts = append(p.conflicts, Conflict{
+			Type:   typePost,
+			ID:     post.ID,
+			Reason: "a different post has this id",
+		})
+		if opts.OnConflict != ConflictOverwrite {
+			p.changes.Skipped++
+			continue
+		}
+		p.changes.Overwritten++
+		dropped[idx] = true
+		added = append(added, post)
+	}
+	for i, post := range current {
+		if !dropped[i] {
+			p.result = append(p.result, post)
+		}
+	}
+	p.result = append(p.result, added...)
+	return p
+}
+
+// commentConflict finds a comment of post that is stored under another post.
+func commentConflict(post models.Post, commentPosts map[models.ID]models.ID) (Conflict, bool) {
+	for _, comment := range post.Comments {
+		if owner, ok := commentPosts[comment.ID]; ok && owner != post.ID {
+			return Conflict{
+				Type:   typeComment,
+				ID:     comment.ID,
+				Reason: fmt.Sprintf("the comment of post %s belongs to post %s", post.ID, owner),
+			}, true
+		}
+	}
+	return Conflict{}, false
+}
+
+// samePost compares what an export holds of the posts.
+func samePost(a, b models.Post) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aJSON, bJSON)
+}
+
+type exportData struct {
+	users  []models.User
+	posts  []models.Post
+	counts Counts
+}
+
+// read decodes and checks a whole export.
+func read(r io.Reader) (*exportData, error) {
+	data := &exportData{
+		users: make([]models.User, 0, 42),
+		posts: make([]models.Post, 0, 42),
+	}
+	var (
+		br        = bufio.NewReader(r)
+		hash      = sha256.New()
+		manifest  *manifestRecord
+		seenUsers = make(map[models.ID]bool)
+		seenNames = make(map[models.Username]bool)
+		postIdx   = make(map[models.ID]int)
+		comments  = make(map[models.ID]bool)
+		votes     = make(map[[2]models.ID]bool)
+		now       = time.Now()
+	)
+	header, version := false, 0
+	for lineNo := 1; ; lineNo++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrap(err, "read: ")
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			hash.Write(line)
+			if err == io.EOF {
+				break
+			}
+			continue
+		}
+		if manifest != nil {
+			return nil, &FormatError{Line: lineNo, Msg: "data after the manifest"}
+		}
+
+		var record struct {
+			Type string `json:"type"`
+		}
+		if jErr := json.Unmarshal(line, &record); jErr != nil {
+			return nil, &FormatError{Line: lineNo, Msg: jErr.Error()}
+		}
+		if !header && record.Type != typeHeader {
+			return nil, &FormatError{Line: lineNo, Msg: "the header must come first"}
+		}
+		if record.Type != typeManifest {
+			hash.Write(line)
+		}
+		fail := func(format string, args ...interface{}) error {
+			return &FormatError{Line: lineNo, Msg: fmt.Sprintf(format, args...)}
+		}
+
+		switch record.Type {
+		case typeHeader:
+			var h headerRecord
+			if dErr := decodeRecord(line, &h); dErr != nil {
+				return nil, fail("%s", dErr)
+			}
+			switch {
+			case header:
+				return nil, fail("duplicate header")
+			case h.Format != Format:
+				return nil, fail("format %q is not %q", h.Format, Format)
+			case h.Version < 1 || h.Version > Version:
+				return nil, fail("version %d is not supported, the latest is %d", h.Version, Version)
+			}
+			header, version = true, h.Version
+
+		case typeUser:
+			var u userRecord
+			if dErr := decodeRecord(line, &u); dErr != nil {
+				return nil, fail("%s", dErr)
+			}
+			role, rErr := models.StringToRole(string(u.Role))
+			if version == 1 && u.PasswordHash == "" && u.Password != "" {
+				var hErr error
+				if u.PasswordHash, hErr = models.HashPassword(u.Password); hErr != nil {
+					return nil, fail("user %s: %s", u.ID, hErr)
+				}
+			}
+			switch {
+			case u.ID == "" || u.Username == "" || u.PasswordHash == "":
+				return nil, fail("user needs an id, a username and a password hash")
+			case version > 1 && u.Password != "":
+				return nil, fail("user %s: version %d exports hold no passwords", u.ID, version)
+			case !models.ValidPasswordHash(u.PasswordHash):
+				return nil, fail("user %s: the password hash is not a bcrypt hash", u.ID)
+			case rErr != nil:
+				return nil, fail("user %s: %s", u.ID, rErr)
+			case seenUsers[u.ID]:
+				return nil, fail("duplicate user %s", u.ID)
+			case seenNames[u.Username]:
+				return nil, fail("duplicate username %s", u.Username)
+			}
+			seenUsers[u.ID], seenNames[u.Username] = true, true
+			data.users = append(data.users, models.User{
+				ID:           u.ID,
+				Username:     u.Username,
+				PasswordHash: u.PasswordHash,
+				Role:         role,
+			})
+			data.counts.Users++
+
+		case typePost:
+			var p postRecord
+			if dErr := decodeRecord(line, &p); dErr != nil {
+				return nil, fail("%s", dErr)
+			}
+			switch {
+			case p.ID == "" || p.Title == "" || p.Author.ID == "" || p.Author.Login == "":
+				return nil, fail("post needs an id, a title and an author")
+			case !validTime(p.Created):
+				return nil, fail("post %s: created is not an RFC 3339 time", p.ID)
+			case p.PostType == models.WithLink && p.URL == "":
+				return nil, fail("post %s: link post without a url", p.ID)
+			}
+			if _, ok := postIdx[p.ID]; ok {
+				return nil, fail("duplicate post %s", p.ID)
+			}
+			postIdx[p.ID] = len(data.posts)
+			data.posts = append(data.posts, models.Post{
+				ID:       p.ID,
+				Type:     p.PostType,
+				Category: p.Category,
+				Title:    p.Title,
+				URL:      p.URL,
+				Text:     p.Text,
+				Author:   p.Author,
+				Views:    p.Views,
+				Created:  p.Created,
+				Votes:    make([]*models.PostVote, 0),
+				Comments: make([]*models.PostComment, 0),
+				Version:  1,
+				Updated:  now,
+			})
+			data.counts.Posts++
+
+		case typeComment:
+			var c commentRecord
+			if dErr := decodeRecord(line, &c); dErr != nil {
+				return nil, fail("%s", dErr)
+			}
+			idx, ok := postIdx[c.Post]
+			switch {
+			case c.ID == "" || c.Body == "" || c.Author.ID == "" || c.Author.Login == "":
+				return nil, fail("comment needs an id, a body and an author")
+			case !ok:
+				return nil, fail("comment %s: post %s does not come before it", c.ID, c.Post)
+			case !validTime(c.Created):
+				return nil, fail("comment %s: created is not an RFC 3339 time", c.ID)
+			case comments[c.ID]:
+				return nil, fail("duplicate comment %s", c.ID)
+			}
+			comments[c.ID] = true
+			data.posts[idx].Comments = append(data.posts[idx].Comments, &models.PostComment{
+				ID:      c.ID,
+				Author:  c.Author,
+				Body:    c.Body,
+				Created: c.Created,
+			})
+			data.counts.Comments++
+
+		case typeVote:
+			var v voteRecord
+			if dErr := decodeRecord(line, &v); dErr != nil {
+				return nil, fail("%s", dErr)
+			}
+			idx, ok := postIdx[v.Post]
+			switch {
+			case v.User == "":
+				return nil, fail("vote needs a user")
+			case !ok:
+				return nil, fail("vote of %s: post %s does not come before it", v.User, v.Post)
+			case !v.Vote.Valid():
+				return nil, fail("vote of %s: %d is neither 1 nor -1", v.User, v.Vote)
+			case votes[[2]models.ID{v.Post, v.User}]:
+				return nil, fail("duplicate vote of %s on post %s", v.User, v.Post)
+			}
+			votes[[2]models.ID{v.Post, v.User}] = true
+			data.posts[idx].Votes = append(data.posts[idx].Votes, models.NewPostVote(v.User, v.Vote))
+			data.counts.Votes++
+
+		case typeManifest:
+			manifest = &manifestRecord{}
+			if dErr := decodeRecord(line, manifest); dErr != nil {
+				return nil, fail("%s", dErr)
+			}
+
+		default:
+			return nil, fail("unknown record type %q", record.Type)
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	switch {
+	case !header:
+		return nil, &FormatError{Msg: "empty export"}
+	case manifest == nil:
+		return nil, &FormatError{Msg: "the manifest is missing, the export is truncated"}
+	case manifest.Records != data.counts:
+		return nil, &FormatError{Msg: fmt.Sprintf("the manifest counts %+v records, the export has %+v", manifest.Records, data.counts)}
+	case manifest.SHA256 != hex.EncodeToString(hash.Sum(nil)):
+		return nil, &FormatError{Msg: "checksum mismatch, the export is corrupted"}
+	}
+	for i := range data.posts {
+		data.posts[i].Recount()
+	}
+	return data, nil
+}
+
+func decodeRecord(line []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func validTime(value string) bool {
+	_, err := time.Parse(time.RFC3339Nano, value)
+	return err == nil
+}
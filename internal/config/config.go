@@ -0,0 +1,388 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/ratelimit"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/tracing"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	EnvPrefix     = "REDDIT_"
+	redacted      = "[REDACTED]"
+	BackendMemory = "memory"
+	BackendFile   = "file"
+)
+
+var (
+	ErrInvalidConfig = errors.New("invalid config")
+	storageBackends  = []string{BackendMemory, BackendFile}
+	fsyncPolicies    = []string{"always", "interval", "never"}
+	logLevels        = []string{"debug", "info", "warn", "error"}
+	logFormats       = []string{"json", "console"}
+)
+
+type Config struct {
+	HTTP      HTTPConfig      `json:"http"`
+	Storage   StorageConfig   `json:"storage"`
+	Auth      AuthConfig      `json:"auth"`
+	Log       LogConfig       `json:"log"`
+	Assets    AssetsConfig    `json:"assets"`
+	Tracing   TracingConfig   `json:"tracing"`
+	RateLimit RateLimitConfig `json:"rateLimit"`
+	GRPC      GRPCConfig      `json:"grpc"`
+	GraphQL   GraphQLConfig   `json:"graphql"`
+	OpenAPI   OpenAPIConfig   `json:"openapi"`
+	Security  SecurityConfig  `json:"security"`
+
+	PrintConfig bool   `json:"-"`
+	File        string `json:"-"`
+}
+
+type HTTPConfig struct {
+	Addr              string   `json:"addr"`
+	ReadTimeout       Duration `json:"readTimeout"`
+	ReadHeaderTimeout Duration `json:"readHeaderTimeout"`
+	WriteTimeout      Duration `json:"writeTimeout"`
+	IdleTimeout       Duration `json:"idleTimeout"`
+	ShutdownTimeout   Duration `json:"shutdownTimeout"`
+	DrainDelay        Duration `json:"drainDelay"`
+	MaxHeaderBytes    int      `json:"maxHeaderBytes"`
+	MaxBodyBytes      int64    `json:"maxBodyBytes"`
+	TrustedProxies    []string `json:"trustedProxies"`
+	PublicURL         string   `json:"publicURL"`
+}
+
+type StorageConfig struct {
+	Backend string `json:"backend"`
+	// DSN is the data directory of the file backend
+	DSN              string   `json:"dsn"`
+	Fsync            string   `json:"fsync"`
+	SnapshotInterval Duration `json:"snapshotInterval"`
+}
+
+type AuthConfig struct {
+	JWTSecret          string   `json:"jwtSecret"`
+	JWTPreviousSecrets []string `json:"jwtPreviousSecrets"`
+	TokenTTL           Duration `json:"tokenTTL"`
+	// Admins are administrators whatever their stored role. They must be
+	// registered before the server starts
+	Admins []string `json:"admins"`
+}
+
+type LogConfig struct {
+	Level             string             `json:"level"`
+	Format            string             `json:"format"`
+	AccessSampleRates map[string]float64 `json:"accessSampleRates"`
+}
+
+type TracingConfig struct {
+	Exporter    string  `json:"exporter"`
+	Output      string  `json:"output"`
+	SampleRatio float64 `json:"sampleRatio"`
+	ServiceName string  `json:"serviceName"`
+}
+
+type RateLimitConfig struct {
+	Enabled  bool                        `json:"enabled"`
+	Policies map[string]ratelimit.Policy `json:"policies"`
+}
+
+type GRPCConfig struct {
+	// Addr is the listen address of the gRPC API, which is disabled when empty
+	Addr string `json:"addr"`
+}
+
+type GraphQLConfig struct {
+	Enabled       bool  `json:"enabled"`
+	MaxDepth      int   `json:"maxDepth"`
+	MaxComplexity int64 `json:"maxComplexity"`
+	MaxAliases    int   `json:"maxAliases"`
+}
+
+type OpenAPIConfig struct {
+	ValidateRequests  bool `json:"validateRequests"`
+	ValidateResponses bool `json:"validateResponses"`
+}
+
+type SecurityConfig struct {
+	CORSAllowedOrigins    []string `json:"corsAllowedOrigins"`
+	CORSAllowCredentials  bool     `json:"corsAllowCredentials"`
+	CORSMaxAge            Duration `json:"corsMaxAge"`
+	ContentSecurityPolicy string   `json:"contentSecurityPolicy"`
+	HSTSMaxAge            Duration `json:"hstsMaxAge"`
+	FrameOptions          string   `json:"frameOptions"`
+	SessionCookie         string   `json:"sessionCookie"`
+}
+
+type AssetsConfig struct {
+	// Templates is a glob inside the assets filesystem
+	Templates string `json:"templates"`
+	// StaticDir replaces the embedded frontend with a directory on disk,
+	// handy while working on the frontend
+	StaticDir string `json:"staticDir"`
+}
+
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return d.Set(s)
+}
+
+func (d *Duration) Set(s string) error {
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func Default() *Config {
+	return &Config{
+		HTTP: HTTPConfig{
+			Addr:              ":8080",
+			ReadTimeout:       Duration{time.Second * 10},
+			ReadHeaderTimeout: Duration{time.Second * 5},
+			WriteTimeout:      Duration{time.Second * 15},
+			IdleTimeout:       Duration{time.Minute},
+			ShutdownTimeout:   Duration{time.Second * 15},
+			MaxHeaderBytes:    1 << 16,
+			MaxBodyBytes:      1 << 20,
+		},
+		Storage: StorageConfig{
+			Backend:          BackendMemory,
+			Fsync:            "always",
+			SnapshotInterval: Duration{time.Minute * 5},
+		},
+		Auth: AuthConfig{
+			TokenTTL: Duration{time.Hour * 24 * 7},
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Assets: AssetsConfig{
+			Templates: "html/*.html",
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:  true,
+			Policies: defaultPolicies(),
+		},
+		GraphQL: GraphQLConfig{
+			Enabled:       true,
+			MaxDepth:      8,
+			MaxComplexity: 2000,
+			MaxAliases:    20,
+		},
+		Security: SecurityConfig{
+			CORSMaxAge: Duration{time.Hour},
+			// The bundled frontend relies on an inline webpack runtime and on
+			// styled-components injecting <style> elements
+			ContentSecurityPolicy: "default-src 'self'; script-src 'self' 'unsafe-inline'; " +
+				"style-src 'self' 'unsafe-inline'; img-src 'self' data: https:; object-src 'none'; " +
+				"base-uri 'self'; frame-ancestors 'none'",
+			FrameOptions: "DENY",
+		},
+		Tracing: TracingConfig{
+			Exporter:    tracing.ExporterNone,
+			SampleRatio: 1,
+			ServiceName: "redditclone",
+		},
+	}
+}
+
+// Load builds the effective configuration from, in increasing priority:
+// built-in defaults, the JSON config file, REDDIT_* environment variables
+// and command line flags. lookupEnv works like os.LookupEnv: a variable that
+// is set but empty clears a string or list setting, such as REDDIT_GRPC_ADDR=
+// disabling gRPC.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+	fs := flag.NewFlagSet("redditclone", flag.ContinueOnError)
+	configFile, _ := lookupEnv(EnvPrefix + "CONFIG")
+	fs.StringVar(&cfg.File, "config", configFile, "path to a JSON config file")
+	fs.BoolVar(&cfg.PrintConfig, "print-config", false, "print the effective config with secrets redacted and exit")
+	flagValues := make(map[string]*string)
+	for _, s := range cfg.settings() {
+		flagValues[s.name] = fs.String(s.name, "", s.usage+" (env "+s.env()+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if cfg.File != "" {
+		if err := cfg.loadFile(cfg.File); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range cfg.settings() {
+		if value, ok := lookupEnv(s.env()); ok {
+			if err := s.set(value); err != nil {
+				return nil, fmt.Errorf("%w: env %s: %v", ErrInvalidConfig, s.env(), err)
+			}
+		}
+	}
+
+	var errs []error
+	fs.Visit(func(f *flag.Flag) {
+		value, ok := flagValues[f.Name]
+		if !ok {
+			return
+		}
+		for _, s := range cfg.settings() {
+			if s.name == f.Name {
+				if err := s.set(*value); err != nil {
+					errs = append(errs, fmt.Errorf("%w: flag -%s: %v", ErrInvalidConfig, f.Name, err))
+				}
+			}
+		}
+	})
+	return cfg, errors.Join(errs...)
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidConfig, path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid value at once so that a misconfigured
+// deployment can be fixed in a single pass.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%w: "+format, append([]interface{}{ErrInvalidConfig}, args...)...))
+		}
+	}
+
+	_, _, err := net.SplitHostPort(c.HTTP.Addr)
+	check(err == nil, "http.addr %q must be in host:port form", c.HTTP.Addr)
+	for name, timeout := range map[string]Duration{
+		"http.readTimeout":       c.HTTP.ReadTimeout,
+		"http.readHeaderTimeout": c.HTTP.ReadHeaderTimeout,
+		"http.writeTimeout":      c.HTTP.WriteTimeout,
+		"http.idleTimeout":       c.HTTP.IdleTimeout,
+		"http.drainDelay":        c.HTTP.DrainDelay,
+	} {
+		check(timeout.Duration >= 0, "%s must not be negative", name)
+	}
+	check(c.HTTP.ShutdownTimeout.Duration > 0, "http.shutdownTimeout must be positive")
+	check(c.HTTP.MaxHeaderBytes > 0, "http.maxHeaderBytes must be positive")
+	check(c.HTTP.MaxBodyBytes > 0, "http.maxBodyBytes must be positive")
+	check(slices.Contains(storageBackends, c.Storage.Backend), "storage.backend %q must be one of %v", c.Storage.Backend, storageBackends)
+	check(c.Storage.Backend != BackendFile || c.Storage.DSN != "", "storage.dsn must be the data directory of the file backend")
+	check(slices.Contains(fsyncPolicies, c.Storage.Fsync), "storage.fsync %q must be one of %v", c.Storage.Fsync, fsyncPolicies)
+	check(c.Storage.SnapshotInterval.Duration > 0, "storage.snapshotInterval must be positive")
+	check(c.Auth.TokenTTL.Duration > 0, "auth.tokenTTL must be positive")
+	check(slices.Contains(logLevels, c.Log.Level), "log.level %q must be one of %v", c.Log.Level, logLevels)
+	check(slices.Contains(logFormats, c.Log.Format), "log.format %q must be one of %v", c.Log.Format, logFormats)
+	for prefix, rate := range c.Log.AccessSampleRates {
+		check(rate >= 0 && rate <= 1, "log.accessSampleRates[%q] must be between 0 and 1", prefix)
+	}
+	for _, proxy := range c.HTTP.TrustedProxies {
+		_, err := mdwr.NewIPResolver([]string{proxy})
+		check(err == nil, "http.trustedProxies entry %q must be an IP address or CIDR", proxy)
+	}
+	for class, policy := range c.RateLimit.Policies {
+		check(slices.Contains(ratelimit.Classes, ratelimit.Class(class)), "rateLimit.policies class %q must be one of %v", class, ratelimit.Classes)
+		check(policy.Rate > 0 && policy.Burst > 0, "rateLimit.policies[%q] rate and burst must be positive", class)
+	}
+	check(!c.Security.CORSAllowCredentials || !slices.Contains(c.Security.CORSAllowedOrigins, "*"),
+		"security.corsAllowCredentials cannot be combined with the * origin")
+	check(c.Security.CORSMaxAge.Duration >= 0 && c.Security.HSTSMaxAge.Duration >= 0, "security max ages must not be negative")
+	check(slices.Contains([]string{"", "DENY", "SAMEORIGIN"}, c.Security.FrameOptions), "security.frameOptions %q must be DENY or SAMEORIGIN", c.Security.FrameOptions)
+	check(c.GRPC.Addr == "" || c.GRPC.Addr != c.HTTP.Addr, "grpc.addr must differ from http.addr")
+	check(c.GraphQL.MaxDepth > 0 && c.GraphQL.MaxComplexity > 0 && c.GraphQL.MaxAliases > 0, "graphql limits must be positive")
+	check(c.Assets.Templates != "", "assets.templates must be set")
+	if c.HTTP.PublicURL != "" {
+		u, err := url.Parse(c.HTTP.PublicURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "http.publicURL %q must be an absolute http(s) URL", c.HTTP.PublicURL)
+	}
+	check(slices.Contains(tracing.Exporters, c.Tracing.Exporter), "tracing.exporter %q must be one of %v", c.Tracing.Exporter, tracing.Exporters)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sampleRatio must be between 0 and 1")
+	if c.Assets.StaticDir != "" {
+		if info, err := os.Stat(c.Assets.StaticDir); err != nil || !info.IsDir() {
+			check(false, "assets.staticDir %q must be an existing directory", c.Assets.StaticDir)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RateLimitPolicies returns the configured policies keyed by action class.
+func (c *Config) RateLimitPolicies() map[ratelimit.Class]ratelimit.Policy {
+	policies := make(map[ratelimit.Class]ratelimit.Policy, len(c.RateLimit.Policies))
+	for class, policy := range c.RateLimit.Policies {
+		policies[ratelimit.Class(class)] = policy
+	}
+	return policies
+}
+
+func defaultPolicies() map[string]ratelimit.Policy {
+	policies := make(map[string]ratelimit.Policy, len(ratelimit.DefaultPolicies))
+	for class, policy := range ratelimit.DefaultPolicies {
+		policies[string(class)] = policy
+	}
+	return policies
+}
+
+func (c *Config) Print(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(c.Redacted())
+}
+
+func (c *Config) Redacted() Config {
+	redactedCfg := *c
+	if redactedCfg.Auth.JWTSecret != "" {
+		redactedCfg.Auth.JWTSecret = redacted
+	}
+	previous := make([]string, 0, len(c.Auth.JWTPreviousSecrets))
+	for range c.Auth.JWTPreviousSecrets {
+		previous = append(previous, redacted)
+	}
+	redactedCfg.Auth.JWTPreviousSecrets = previous
+	redactedCfg.Storage.DSN = redactDSN(c.Storage.DSN)
+	return redactedCfg
+}
+
+func redactDSN(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil {
+		return dsn
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return strings.Replace(u.String(), url.QueryEscape(redacted), redacted, 1)
+}
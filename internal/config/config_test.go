@@ -0,0 +1,172 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	file := writeFile(t, `{"http":{"addr":":8000","maxBodyBytes":2048},"grpc":{"addr":":9090"},"auth":{"admins":["root"]}}`)
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		// check returns what is wrong with the loaded config
+		check   func(cfg *Config) string
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			check: func(cfg *Config) string {
+				if cfg.HTTP.Addr != Default().HTTP.Addr || cfg.GRPC.Addr != "" {
+					return "the defaults were changed"
+				}
+				return ""
+			},
+		},
+		{
+			name: "file over the defaults",
+			env:  map[string]string{"REDDIT_CONFIG": file},
+			check: func(cfg *Config) string {
+				if cfg.HTTP.Addr != ":8000" || cfg.HTTP.MaxBodyBytes != 2048 || cfg.GRPC.Addr != ":9090" {
+					return "the file was not applied"
+				}
+				if cfg.HTTP.ShutdownTimeout != Default().HTTP.ShutdownTimeout {
+					return "a setting missing from the file lost its default"
+				}
+				return ""
+			},
+		},
+		{
+			name: "env over the file",
+			env:  map[string]string{"REDDIT_CONFIG": file, "REDDIT_HTTP_ADDR": ":8001"},
+			check: func(cfg *Config) string {
+				if cfg.HTTP.Addr != ":8001" || cfg.HTTP.MaxBodyBytes != 2048 {
+					return "the env var did not override the file alone"
+				}
+				return ""
+			},
+		},
+		{
+			name: "empty env clears",
+			env:  map[string]string{"REDDIT_CONFIG": file, "REDDIT_GRPC_ADDR": "", "REDDIT_AUTH_ADMINS": ""},
+			check: func(cfg *Config) string {
+				if cfg.GRPC.Addr != "" || len(cfg.Auth.Admins) != 0 {
+					return "empty env vars did not clear the settings"
+				}
+				return ""
+			},
+		},
+		{
+			name: "flags over env",
+			args: []string{"-config", file, "-http-addr", ":8002", "-grpc-addr="},
+			env:  map[string]string{"REDDIT_HTTP_ADDR": ":8001", "REDDIT_GRPC_ADDR": ":9091"},
+			check: func(cfg *Config) string {
+				if cfg.HTTP.Addr != ":8002" || cfg.GRPC.Addr != "" {
+					return "the flags did not override the env vars"
+				}
+				return ""
+			},
+		},
+		{
+			name:    "invalid env value",
+			env:     map[string]string{"REDDIT_HTTP_MAX_BODY_BYTES": "lots"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown field in the file",
+			args:    []string{"-config", writeFile(t, `{"http":{"adress":":8000"}}`)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookupEnv := func(key string) (string, bool) {
+				value, ok := tt.env[key]
+				return value, ok
+			}
+			cfg, err := Load(tt.args, lookupEnv)
+			if gotErr := err != nil; gotErr != tt.wantErr {
+				t.Fatalf("Load() err = %v, want an error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidConfig) {
+					t.Errorf("Load() err = %v, want %v", err, ErrInvalidConfig)
+				}
+				return
+			}
+			if problem := tt.check(cfg); problem != "" {
+				t.Errorf("%s: %+v", problem, cfg)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(cfg *Config)
+		// want are the settings the error has to name
+		want []string
+	}{
+		{name: "defaults", change: func(cfg *Config) {}},
+		{
+			name:   "memory trace exporter is for tests",
+			change: func(cfg *Config) { cfg.Tracing.Exporter = "memory" },
+			want:   []string{"tracing.exporter"},
+		},
+		{
+			name:   "file backend without a directory",
+			change: func(cfg *Config) { cfg.Storage.Backend = BackendFile },
+			want:   []string{"storage.dsn"},
+		},
+		{
+			name:   "gRPC on the HTTP address",
+			change: func(cfg *Config) { cfg.GRPC.Addr = cfg.HTTP.Addr },
+			want:   []string{"grpc.addr"},
+		},
+		{
+			name: "every violation at once",
+			change: func(cfg *Config) {
+				cfg.HTTP.MaxBodyBytes = 0
+				cfg.Log.Level = "loud"
+				cfg.GraphQL.MaxAliases = 0
+				cfg.Tracing.SampleRatio = 2
+			},
+			want: []string{"http.maxBodyBytes", "log.level", "graphql limits", "tracing.sampleRatio"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(cfg)
+			err := cfg.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("Validate() = %v, want %v", err, ErrInvalidConfig)
+			}
+			for _, setting := range tt.want {
+				if !strings.Contains(err.Error(), setting) {
+					t.Errorf("Validate() = %v, want it to name %s", err, setting)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/ratelimit"
+	"strconv"
+	"strings"
+)
+
+type setting struct {
+	name  string
+	usage string
+	set   func(string) error
+}
+
+func (s setting) env() string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(s.name, "-", "_"))
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		stringSetting("http-addr", "listen address", &c.HTTP.Addr),
+		durationSetting("http-read-timeout", "maximum duration for reading a request", &c.HTTP.ReadTimeout),
+		durationSetting("http-read-header-timeout", "maximum duration for reading request headers", &c.HTTP.ReadHeaderTimeout),
+		durationSetting("http-write-timeout", "maximum duration before timing out response writes", &c.HTTP.WriteTimeout),
+		durationSetting("http-idle-timeout", "maximum keep-alive idle time", &c.HTTP.IdleTimeout),
+		durationSetting("http-shutdown-timeout", "maximum time to drain connections on shutdown", &c.HTTP.ShutdownTimeout),
+		durationSetting("http-drain-delay", "time between failing readiness and closing the listener on shutdown", &c.HTTP.DrainDelay),
+		intSetting("http-max-header-bytes", "maximum size of request headers", &c.HTTP.MaxHeaderBytes),
+		int64Setting("http-max-body-bytes", "maximum request body size", &c.HTTP.MaxBodyBytes),
+		stringSetting("http-public-url", "external base URL used in page links, the sitemap and feeds", &c.HTTP.PublicURL),
+		listSetting("http-trusted-proxies", "comma separated proxy addresses or CIDRs whose X-Forwarded-For is honoured", &c.HTTP.TrustedProxies),
+		stringSetting("storage-backend", "storage backend: memory or file", &c.Storage.Backend),
+		stringSetting("storage-dsn", "storage backend DSN, the data directory of the file backend", &c.Storage.DSN),
+		stringSetting("storage-fsync", "when the file backend syncs its log: always, interval (every second) or never", &c.Storage.Fsync),
+		durationSetting("storage-snapshot-interval", "how often the file backend compacts its log into a snapshot", &c.Storage.SnapshotInterval),
+		stringSetting("auth-jwt-secret", "JWT signing secret", &c.Auth.JWTSecret),
+		listSetting("auth-jwt-previous-secrets", "comma separated JWT secrets still accepted for verification", &c.Auth.JWTPreviousSecrets),
+		durationSetting("auth-token-ttl", "lifetime of issued tokens", &c.Auth.TokenTTL),
+		listSetting("auth-admins", "comma separated registered usernames that are always administrators", &c.Auth.Admins),
+		stringSetting("log-level", "log level: debug, info, warn or error", &c.Log.Level),
+		stringSetting("log-format", "log format: json or console", &c.Log.Format),
+		rateMapSetting("log-access-sample-rates", "comma separated path-prefix=rate pairs sampling the access log", &c.Log.AccessSampleRates),
+		stringSetting("assets-templates", "glob of the HTML templates inside the assets", &c.Assets.Templates),
+		stringSetting("assets-static-dir", "serve the frontend from this directory instead of the embedded copy", &c.Assets.StaticDir),
+		boolSetting("rate-limit-enabled", "enable per-user and per-IP rate limiting", &c.RateLimit.Enabled),
+		policiesSetting("rate-limit-policies", "comma separated class=rate:burst token bucket policies", &c.RateLimit.Policies),
+		stringSetting("grpc-addr", "gRPC listen address, empty disables the gRPC API", &c.GRPC.Addr),
+		boolSetting("graphql-enabled", "serve the GraphQL API at /graphql", &c.GraphQL.Enabled),
+		intSetting("graphql-max-depth", "maximum nesting of a GraphQL query", &c.GraphQL.MaxDepth),
+		int64Setting("graphql-max-complexity", "maximum number of objects a GraphQL request may resolve", &c.GraphQL.MaxComplexity),
+		intSetting("graphql-max-aliases", "maximum number of aliased fields in a GraphQL query", &c.GraphQL.MaxAliases),
+		boolSetting("openapi-validate-requests", "reject API requests that do not match /api/openapi.json", &c.OpenAPI.ValidateRequests),
+		boolSetting("openapi-validate-responses", "log API responses that do not match /api/openapi.json", &c.OpenAPI.ValidateResponses),
+		listSetting("security-cors-allowed-origins", "comma separated origins allowed to call the API, * for any", &c.Security.CORSAllowedOrigins),
+		boolSetting("security-cors-allow-credentials", "allow credentialed cross-origin requests", &c.Security.CORSAllowCredentials),
+		durationSetting("security-cors-max-age", "how long browsers may cache preflight responses", &c.Security.CORSMaxAge),
+		stringSetting("security-content-security-policy", "Content-Security-Policy header value", &c.Security.ContentSecurityPolicy),
+		durationSetting("security-hsts-max-age", "Strict-Transport-Security max-age, 0 disables the header", &c.Security.HSTSMaxAge),
+		stringSetting("security-frame-options", "X-Frame-Options header value", &c.Security.FrameOptions),
+		stringSetting("security-session-cookie", "session cookie whose requests require a CSRF token", &c.Security.SessionCookie),
+		stringSetting("tracing-exporter", "trace exporter: none or stdout", &c.Tracing.Exporter),
+		stringSetting("tracing-output", "file the stdout exporter writes to instead of standard output", &c.Tracing.Output),
+		float64Setting("tracing-sample-ratio", "fraction of new traces that are sampled", &c.Tracing.SampleRatio),
+		stringSetting("tracing-service-name", "service.name resource attribute", &c.Tracing.ServiceName),
+	}
+}
+
+func stringSetting(name, usage string, dst *string) setting {
+	return setting{name: name, usage: usage, set: func(value string) error {
+		*dst = value
+		return nil
+	}}
+}
+
+func durationSetting(name, usage string, dst *Duration) setting {
+	return setting{name: name, usage: usage, set: dst.Set}
+}
+
+func int64Setting(name, usage string, dst *int64) setting {
+	return setting{name: name, usage: usage, set: func(value string) error {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*dst = parsed
+		return nil
+	}}
+}
+
+// listSetting takes an empty value as the empty list.
+func listSetting(name, usage string, dst *[]string) setting {
+	return setting{name: name, usage: usage, set: func(value string) error {
+		*dst = nil
+		if value != "" {
+			*dst = strings.Split(value, ",")
+		}
+		return nil
+	}}
+}
+
+func intSetting(name, usage string, dst *int) setting {
+	return setting{name: name, usage: usage, set: func(value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*dst = parsed
+		return nil
+	}}
+}
+
+func float64Setting(name, usage string, dst *float64) setting {
+	return setting{name: name, usage: usage, set: func(value string) error {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*dst = parsed
+		return nil
+	}}
+}
+
+// rateMapSetting takes an empty value as no rates.
+func rateMapSetting(name, usage string, dst *map[string]float64) setting {
+	return setting{name: name, usage: usage, set: func(value string) error {
+		rates := make(map[string]float64)
+		if value == "" {
+			*dst = rates
+			return nil
+		}
+		for _, pair := range strings.Split(value, ",") {
+			prefix, rate, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("%q is not a prefix=rate pair", pair)
+			}
+			parsed, err := strconv.ParseFloat(rate, 64)
+			if err != nil {
+				return err
+			}
+			rates[prefix] = parsed
+		}
+		*dst = rates
+		return nil
+	}}
+}
+
+func boolSetting(name, usage string, dst *bool) setting {
+	return setting{name: name, usage: usage, set: func(value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*dst = parsed
+		return nil
+	}}
+}
+
+func policiesSetting(name, usage string, dst *map[string]ratelimit.Policy) setting {
+	return setting{name: name, usage: usage, set: func(value string) error {
+		policies := make(map[string]ratelimit.Policy)
+		for _, pair := range strings.Split(value, ",") {
+			class, limits, ok := strings.Cut(pair, "=")
+			rate, burst, ok2 := strings.Cut(limits, ":")
+			if !ok || !ok2 {
+				return fmt.Errorf("%q is not a class=rate:burst triple", pair)
+			}
+			parsedRate, err := strconv.ParseFloat(rate, 64)
+			if err != nil {
+				return err
+			}
+			parsedBurst, err := strconv.Atoi(burst)
+			if err != nil {
+				return err
+			}
+			policies[class] = ratelimit.Policy{Rate: parsedRate, Burst: parsedBurst}
+		}
+		// Classes that are not mentioned keep their previous policy
+		if *dst == nil {
+			*dst = make(map[string]ratelimit.Policy, len(policies))
+		}
+		for class, policy := range policies {
+			(*dst)[class] = policy
+		}
+		return nil
+	}}
+}
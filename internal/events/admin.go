@@ -0,0 +1,69 @@
+package events
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+)
+
+// AdminPosts publishes the deletions and restorations made by the
+// administrators, which skip the ownership checks of Posts.
+type AdminPosts struct {
+	next   service.AdminPostStorage
+	broker *Broker
+}
+
+func WrapAdminPosts(broker *Broker, next service.AdminPostStorage) *AdminPosts {
+	return &AdminPosts{
+		next:   next,
+		broker: broker,
+	}
+}
+
+func (p *AdminPosts) publish(eventType Type, post models.Post, err error) (models.Post, error) {
+	if err == nil {
+		p.broker.Publish(PostEvent{Type: eventType, Post: post})
+	}
+	return post, err
+}
+
+func (p *AdminPosts) GetAllPosts(ctx context.Context) ([]models.Post, error) {
+	return p.next.GetAllPosts(ctx)
+}
+
+func (p *AdminPosts) GetPostsByCategory(ctx context.Context, postCategory models.PostCategory) ([]models.Post, error) {
+	return p.next.GetPostsByCategory(ctx, postCategory)
+}
+
+func (p *AdminPosts) FindPost(ctx context.Context, postID models.ID) (models.Post, error) {
+	return p.next.FindPost(ctx, postID)
+}
+
+func (p *AdminPosts) DeletePost(ctx context.Context, postID models.ID) error {
+	err := p.next.DeletePost(ctx, postID)
+	_, err = p.publish(PostDeleted, models.Post{ID: postID}, err)
+	return err
+}
+
+func (p *AdminPosts) RestorePost(ctx context.Context, postID models.ID) (models.Post, error) {
+	post, err := p.next.RestorePost(ctx, postID)
+	return p.publish(PostCreated, post, err)
+}
+
+func (p *AdminPosts) DeleteComment(ctx context.Context, postID, commentID models.ID) (models.Post, error) {
+	post, err := p.next.DeleteComment(ctx, postID, commentID)
+	return p.publish(PostUpdated, post, err)
+}
+
+func (p *AdminPosts) RestoreComment(ctx context.Context, postID, commentID models.ID) (models.Post, error) {
+	post, err := p.next.RestoreComment(ctx, postID, commentID)
+	return p.publish(PostUpdated, post, err)
+}
+
+func (p *AdminPosts) Snapshot(ctx context.Context) ([]models.Post, error) {
+	return p.next.Snapshot(ctx)
+}
+
+func (p *AdminPosts) Replace(ctx context.Context, replace func(current []models.Post) ([]models.Post, error)) error {
+	return p.next.Replace(ctx, replace)
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"slices"
+	"sync"
+)
+
+type Type int
+
+const (
+	PostCreated Type = iota + 1
+	PostUpdated
+	PostDeleted
+)
+
+// PostEvent carries a snapshot of the post after the change. Only the ID is
+// set for deleted posts.
+type PostEvent struct {
+	Type Type
+	Post models.Post
+}
+
+// Broker fans post events out to the live subscribers. Publishing never
+// blocks: a subscriber that falls a full buffer behind is disconnected.
+type Broker struct {
+	mu     sync.Mutex
+	subs   map[chan PostEvent]struct{}
+	closed bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subs: make(map[chan PostEvent]struct{}),
+	}
+}
+
+// Subscribe returns a channel of events that is closed when ctx is done, the
+// subscriber is too slow or the broker is closed.
+func (b *Broker) Subscribe(ctx context.Context, buffer int) <-chan PostEvent {
+	ch := make(chan PostEvent, buffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch
+	}
+	b.subs[ch] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+		b.unsubscribe(ch)
+	}()
+	return ch
+}
+
+func (b *Broker) unsubscribe(ch chan PostEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+func (b *Broker) Publish(event PostEvent) {
+	event.Post = snapshot(event.Post)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- event:
+		default:
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close disconnects every subscriber, it is meant to be called when the
+// server starts shutting down so that streams do not hold up the drain.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// snapshot copies the votes and comments, which the storage keeps mutating
+// after the event has been published.
+func snapshot(post models.Post) models.Post {
+	post.Votes = slices.Clone(post.Votes)
+	for i, vote := range post.Votes {
+		v := *vote
+		post.Votes[i] = &v
+	}
+	post.Comments = slices.Clone(post.Comments)
+	for i, comment := range post.Comments {
+		c := *comment
+		post.Comments[i] = &c
+	}
+	return post
+}
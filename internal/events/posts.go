@@ -0,0 +1,89 @@
+package events
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	"time"
+)
+
+type PostRepo interface {
+	service.PostStorage
+	service.PostActions
+}
+
+// Posts publishes an event for every successful change made through next.
+type Posts struct {
+	next   PostRepo
+	broker *Broker
+}
+
+func WrapPosts(broker *Broker, next PostRepo) *Posts {
+	return &Posts{
+		next:   next,
+		broker: broker,
+	}
+}
+
+func (p *Posts) publish(eventType Type, post models.Post, err error) (models.Post, error) {
+	if err == nil {
+		p.broker.Publish(PostEvent{Type: eventType, Post: post})
+	}
+	return post, err
+}
+
+func (p *Posts) GetAllPosts(ctx context.Context) ([]models.Post, error) {
+	return p.next.GetAllPosts(ctx)
+}
+
+func (p *Posts) GetPostsByCategory(ctx context.Context, postCategory models.PostCategory) ([]models.Post, error) {
+	return p.next.GetPostsByCategory(ctx, postCategory)
+}
+
+func (p *Posts) GetPostsByUser(ctx context.Context, userLogin models.Username) ([]models.Post, error) {
+	return p.next.GetPostsByUser(ctx, userLogin)
+}
+
+func (p *Posts) GetPostByID(ctx context.Context, postID models.ID) (models.Post, error) {
+	return p.next.GetPostByID(ctx, postID)
+}
+
+func (p *Posts) CreatePost(ctx context.Context, postPayload models.PostPayload) (models.Post, error) {
+	post, err := p.next.CreatePost(ctx, postPayload)
+	return p.publish(PostCreated, post, err)
+}
+
+func (p *Posts) DeletePost(ctx context.Context, postID models.ID) error {
+	err := p.next.DeletePost(ctx, postID)
+	_, err = p.publish(PostDeleted, models.Post{ID: postID}, err)
+	return err
+}
+
+func (p *Posts) LastModified(ctx context.Context) (time.Time, error) {
+	return p.next.LastModified(ctx)
+}
+
+func (p *Posts) AddComment(ctx context.Context, postID models.ID, comment models.Comment) (models.Post, error) {
+	post, err := p.next.AddComment(ctx, postID, comment)
+	return p.publish(PostUpdated, post, err)
+}
+
+func (p *Posts) DeleteComment(ctx context.Context, postID, commentID models.ID) (models.Post, error) {
+	post, err := p.next.DeleteComment(ctx, postID, commentID)
+	return p.publish(PostUpdated, post, err)
+}
+
+func (p *Posts) Upvote(ctx context.Context, postID models.ID) (models.Post, error) {
+	post, err := p.next.Upvote(ctx, postID)
+	return p.publish(PostUpdated, post, err)
+}
+
+func (p *Posts) Downvote(ctx context.Context, postID models.ID) (models.Post, error) {
+	post, err := p.next.Downvote(ctx, postID)
+	return p.publish(PostUpdated, post, err)
+}
+
+func (p *Posts) Unvote(ctx context.Context, postID models.ID) (models.Post, error) {
+	post, err := p.next.Unvote(ctx, postID)
+	return p.publish(PostUpdated, post, err)
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"context"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const routeUnmatched = "unmatched"
+
+type routeKey struct{}
+
+// Middleware wraps the handler around the mux, so that the requests the mux
+// answers with 404 or 405 and the ones stopped before it are counted too, as
+// "unmatched". RouteLabel names the route of the others.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeUnmatched
+		start := time.Now()
+		rec := mdwr.NewResponseRecorder(w)
+		defer func() {
+			status := rec.Status()
+			// The panic is answered further out, with a 500
+			p := recover()
+			if p != nil {
+				status = http.StatusInternalServerError
+			}
+			code := strconv.Itoa(status)
+			m.httpRequests.WithLabelValues(route, r.Method, code).Inc()
+			m.httpDuration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+			if p != nil {
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), routeKey{}, &route)))
+	})
+}
+
+// RouteLabel has to be installed with mux.Router.Use: it labels requests with
+// the matched route template instead of the raw path, which would give every
+// post ID a series of its own.
+func (m *Metrics) RouteLabel(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := r.Context().Value(routeKey{}).(*string); ok {
+			if current := mux.CurrentRoute(r); current != nil {
+				if template, err := current.GetPathTemplate(); err == nil {
+					*route = template
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
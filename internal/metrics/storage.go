@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	"time"
+)
+
+const (
+	resultOK    = "ok"
+	resultError = "error"
+)
+
+type PostRepo interface {
+	service.PostStorage
+	service.PostActions
+}
+
+// PostStorage records the latency of every call to the wrapped repository and
+// counts the domain events behind the successful ones.
+type PostStorage struct {
+	next    PostRepo
+	metrics *Metrics
+}
+
+type UserStorage struct {
+	next    service.UserStorage
+	metrics *Metrics
+}
+
+func (m *Metrics) PostStorage(next PostRepo) *PostStorage {
+	return &PostStorage{
+		next:    next,
+		metrics: m,
+	}
+}
+
+func (m *Metrics) UserStorage(next service.UserStorage) *UserStorage {
+	return &UserStorage{
+		next:    next,
+		metrics: m,
+	}
+}
+
+func (m *Metrics) timer(repo, operation string) func(err error) {
+	start := time.Now()
+	return func(err error) {
+		result := resultOK
+		if err != nil {
+			result = resultError
+		}
+		m.storageDuration.WithLabelValues(repo, operation, result).Observe(time.Since(start).Seconds())
+	}
+}
+
+func (s *PostStorage) GetAllPosts(ctx context.Context) ([]models.Post, error) {
+	done := s.metrics.timer("posts", "GetAllPosts")
+	resp, err := s.next.GetAllPosts(ctx)
+	done(err)
+	return resp, err
+}
+
+func (s *PostStorage) GetPostsByCategory(ctx context.Context, postCategory models.PostCategory) ([]models.Post, error) {
+	done := s.metrics.timer("posts", "GetPostsByCategory")
+	resp, err := s.next.GetPostsByCategory(ctx, postCategory)
+	done(err)
+	return resp, err
+}
+
+func (s *PostStorage) GetPostsByUser(ctx context.Context, userLogin models.Username) ([]models.Post, error) {
+	done := s.metrics.timer("posts", "GetPostsByUser")
+	resp, err := s.next.GetPostsByUser(ctx, userLogin)
+	done(err)
+	return resp, err
+}
+
+func (s *PostStorage) GetPostByID(ctx context.Context, postID models.ID) (models.Post, error) {
+	done := s.metrics.timer("posts", "GetPostByID")
+	resp, err := s.next.GetPostByID(ctx, postID)
+	done(err)
+	return resp, err
+}
+
+func (s *PostStorage) CreatePost(ctx context.Context, postPayload models.PostPayload) (models.Post, error) {
+	done := s.metrics.timer("posts", "CreatePost")
+	resp, err := s.next.CreatePost(ctx, postPayload)
+	done(err)
+	if err == nil {
+		s.metrics.postsCreated.Inc()
+	}
+	return resp, err
+}
+
+func (s *PostStorage) DeletePost(ctx context.Context, postID models.ID) error {
+	done := s.metrics.timer("posts", "DeletePost")
+	err := s.next.DeletePost(ctx, postID)
+	done(err)
+	return err
+}
+
+func (s *PostStorage) LastModified(ctx context.Context) (time.Time, error) {
+	done := s.metrics.timer("posts", "LastModified")
+	modified, err := s.next.LastModified(ctx)
+	done(err)
+	return modified, err
+}
+
+func (s *PostStorage) AddComment(ctx context.Context, postID models.ID, comment models.Comment) (models.Post, error) {
+	done := s.metrics.timer("posts", "AddComment")
+	resp, err := s.next.AddComment(ctx, postID, comment)
+	done(err)
+	if err == nil {
+		s.metrics.comments.Inc()
+	}
+	return resp, err
+}
+
+func (s *PostStorage) DeleteComment(ctx context.Context, postID, commentID models.ID) (models.Post, error) {
+	done := s.metrics.timer("posts", "DeleteComment")
+	resp, err := s.next.DeleteComment(ctx, postID, commentID)
+	done(err)
+	return resp, err
+}
+
+func (s *PostStorage) Upvote(ctx context.Context, postID models.ID) (models.Post, error) {
+	done := s.metrics.timer("posts", "Upvote")
+	resp, err := s.next.Upvote(ctx, postID)
+	done(err)
+	if err == nil {
+		s.metrics.votesCast.WithLabelValues("up").Inc()
+	}
+	return resp, err
+}
+
+func (s *PostStorage) Downvote(ctx context.Context, postID models.ID) (models.Post, error) {
+	done := s.metrics.timer("posts", "Downvote")
+	resp, err := s.next.Downvote(ctx, postID)
+	done(err)
+	if err == nil {
+		s.metrics.votesCast.WithLabelValues("down").Inc()
+	}
+	return resp, err
+}
+
+func (s *PostStorage) Unvote(ctx context.Context, postID models.ID) (models.Post, error) {
+	done := s.metrics.timer("posts", "Unvote")
+	resp, err := s.next.Unvote(ctx, postID)
+	done(err)
+	if err == nil {
+		s.metrics.votesCast.WithLabelValues("retracted").Inc()
+	}
+	return resp, err
+}
+
+func (s *UserStorage) RegisterUser(authData models.AuthUserInfo) (*models.User, error) {
+	done := s.metrics.timer("users", "RegisterUser")
+	user, err := s.next.RegisterUser(authData)
+	done(err)
+	if err == nil {
+		s.metrics.registrations.Inc()
+	}
+	return user, err
+}
+
+// Authorize treats a rejected login as a successful storage operation: only
+// the logins counter reflects whether the credentials were valid.
+func (s *UserStorage) Authorize(authData models.AuthUserInfo) (*models.User, error) {
+	done := s.metrics.timer("users", "Authorize")
+	user, err := s.next.Authorize(authData)
+	switch {
+	case err == nil:
+		done(nil)
+		s.metrics.logins.WithLabelValues("succeeded").Inc()
+	case errors.Is(err, models.ErrNoUser), errors.Is(err, models.ErrBadPass):
+		done(nil)
+		s.metrics.logins.WithLabelValues("failed").Inc()
+	default:
+		done(err)
+	}
+	return user, err
+}
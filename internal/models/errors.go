@@ -24,6 +24,15 @@ var (
 	ErrBadCommentBody      = errors.New("comment body is required")
 	ErrUnknownPayload      = errors.New("unknown payload")
 	ErrUnknownError        = errors.New("unknown error")
+	ErrBadCredentials      = errors.New("invalid credentials")
+	ErrTooManyAttempts     = errors.New("too many login attempts")
+	ErrBodyTooLarge        = errors.New("request body too large")
+	ErrTooManyRequests     = errors.New("too many requests")
+	ErrForbidden           = errors.New("forbidden")
+	ErrUnknownUser         = errors.New("no such user")
+	ErrInvalidRole         = errors.New("invalid role")
+	ErrInvalidExport       = errors.New("invalid export")
+	ErrImportConflict      = errors.New("import conflicts with the stored data")
 )
 
 type SimpleErr struct {
@@ -41,6 +50,17 @@ type ComplexErrArr struct {
 	Errs []ComplexErr `json:"errors"`
 }
 
+// Problem is an RFC 7807 problem details object. Field-level validation
+// failures are carried in the "errors" extension member.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errs     []ComplexErr `json:"errors,omitempty"`
+}
+
 func NewSimpleErr(message interface{}) SimpleErr {
 	return SimpleErr{
 		Message: message,
@@ -52,3 +72,13 @@ func NewComplexErr(err ...ComplexErr) ComplexErrArr {
 		Errs: err,
 	}
 }
+
+func NewProblem(problemType, title string, status int, detail, instance string) Problem {
+	return Problem{
+		Type:     problemType,
+		Title:    title,
+		Status:   status,
+		Detail:   detail,
+		Instance: instance,
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type LoginAttempts struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+type Lockout struct {
+	Key      string
+	Failures int
+	Until    time.Time
+}
+
+func (a LoginAttempts) IsLocked(now time.Time) bool {
+	return now.Before(a.LockedUntil)
+}
@@ -21,37 +21,54 @@ type Post struct {
 	Created          string         `json:"created"`
 	UpvotePercentage int            `json:"upvotePercentage"`
 	ID               ID             `json:"id"`
+	Version          uint64         `json:"-"`
+	Updated          time.Time      `json:"-"`
 }
 
+// PostPayload is a post as submitted. Type and Category keep the names the
+// client sent, Validate checks them along with the other fields.
 type PostPayload struct {
-	Type     PostType     `json:"type"`
-	Title    string       `json:"title"`
-	URL      string       `json:"url,omitempty"`
-	Category PostCategory `json:"category"`
-	Text     string       `json:"text,omitempty"`
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	URL      string `json:"url,omitempty"`
+	Category string `json:"category"`
+	Text     string `json:"text,omitempty"`
 }
 
 func NewPost(author TokenPayload, payload PostPayload) (*Post, error) {
+	postType, err := StringToPostType(payload.Type)
+	if err != nil {
+		return nil, err
+	}
+	category, err := StringToPostCategory(payload.Category)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
 	newPost := &Post{
 		Score:            1,
 		Views:            0,
-		Type:             payload.Type,
+		Type:             postType,
 		Title:            payload.Title,
 		Author:           author,
-		Category:         payload.Category,
-		Text:             payload.Text,
+		Category:         category,
 		Votes:            append(make([]*PostVote, 0, 42), NewPostVote(author.ID, upVote)),
 		Comments:         make([]*PostComment, 0, 42),
-		Created:          time.Now().Format(time.RFC3339Nano),
+		Created:          now.Format(time.RFC3339Nano),
 		UpvotePercentage: 100,
+		Version:          1,
+		Updated:          now,
 	}
 	newPostID, err := uuid.GenerateUUID()
 	if err != nil {
 		return nil, err
 	}
 	newPost.ID = ID(newPostID)
-	if newPost.Type == WithLink {
+	switch newPost.Type {
+	case WithLink:
 		newPost.URL = payload.URL
+	case WithText:
+		newPost.Text = payload.Text
 	}
 	return newPost, nil
 }
@@ -62,6 +79,7 @@ func (p *Post) AddComment(author TokenPayload, commentBody string) error {
 		return errors.Wrap(err, "AddComment: ")
 	}
 	p.Comments = append(p.Comments, newComment)
+	p.touch()
 	return nil
 }
 
@@ -73,18 +91,35 @@ func (p *Post) DeleteComment(commentID ID) error {
 	if lenBeforeDelete == len(p.Comments) {
 		return ErrCommentNotFound
 	}
+	p.touch()
 	return nil
 }
 
+// RestoreComment puts a deleted comment back in its place in the thread.
+func (p *Post) RestoreComment(comment *PostComment) {
+	created, _ := time.Parse(time.RFC3339Nano, comment.Created)
+	commentIdx := slices.IndexFunc(p.Comments, func(c *PostComment) bool {
+		t, _ := time.Parse(time.RFC3339Nano, c.Created)
+		return t.After(created)
+	})
+	if commentIdx == -1 {
+		commentIdx = len(p.Comments)
+	}
+	p.Comments = slices.Insert(p.Comments, commentIdx, comment)
+	p.touch()
+}
+
 func (p *Post) Upvote(userID ID) error {
 	vote, err := p.getVoteByUserID(userID)
 	if errors.Is(err, ErrVoteNotFound) {
 		p.Votes = append(p.Votes, NewPostVote(userID, upVote))
 		p.Score++
+		p.touch()
 	} else if err == nil {
 		if vote.Vote == downVote {
 			vote.Vote = upVote
 			p.Score += 2
+			p.touch()
 		}
 	}
 	p.updateUpvotePercentage()
@@ -96,10 +131,12 @@ func (p *Post) Downvote(userID ID) error {
 	if errors.Is(err, ErrVoteNotFound) {
 		p.Votes = append(p.Votes, NewPostVote(userID, downVote))
 		p.Score--
+		p.touch()
 	} else if err == nil {
 		if vote.Vote == upVote {
 			vote.Vote = downVote
 			p.Score -= 2
+			p.touch()
 		}
 	}
 	p.updateUpvotePercentage()
@@ -121,9 +158,36 @@ func (p *Post) Unvote(userID ID) error {
 	}
 	p.Votes = slices.Delete(p.Votes, voteIdx, voteIdx+1)
 	p.updateUpvotePercentage()
+	p.touch()
 	return nil
 }
 
+// Clone returns a deep copy of the post that later changes to p do not affect.
+func (p *Post) Clone() Post {
+	clone := *p
+	clone.Votes = make([]*PostVote, 0, len(p.Votes))
+	for _, vote := range p.Votes {
+		voteCopy := *vote
+		clone.Votes = append(clone.Votes, &voteCopy)
+	}
+	clone.Comments = make([]*PostComment, 0, len(p.Comments))
+	for _, comment := range p.Comments {
+		commentCopy := *comment
+		clone.Comments = append(clone.Comments, &commentCopy)
+	}
+	return clone
+}
+
+// Recount derives the score and the upvote percentage from the votes, for
+// posts that are rebuilt instead of voted on.
+func (p *Post) Recount() {
+	p.Score = 0
+	for _, vote := range p.Votes {
+		p.Score += int(vote.Vote)
+	}
+	p.updateUpvotePercentage()
+}
+
 func (p *Post) updateUpvotePercentage() {
 	totalVotes := len(p.Votes)
 	if totalVotes == 0 {
@@ -133,8 +197,16 @@ func (p *Post) updateUpvotePercentage() {
 	p.UpvotePercentage = (p.Score + totalVotes) / (totalVotes * 2) * 100
 }
 
+// touch marks the post as modified. Views count too: they are part of the
+// representation, and the version backs strong ETags.
+func (p *Post) touch() {
+	p.Version++
+	p.Updated = time.Now()
+}
+
 func (p *Post) UpdateViews() *Post {
 	p.Views++
+	p.touch()
 	return p
 }
 
@@ -113,14 +113,11 @@ func (pt *PostType) UnmarshalJSON(postType []byte) error {
 		return err
 	}
 
-	switch s {
-	case withLink:
-		*pt = WithLink
-	case withText:
-		*pt = WithText
-	default:
-		return ErrInvalidPostType
+	typ, err := StringToPostType(s)
+	if err != nil {
+		return err
 	}
+	*pt = typ
 	return nil
 }
 
@@ -128,6 +125,17 @@ func (pt PostType) MarshalJSON() ([]byte, error) {
 	return json.Marshal(pt.String())
 }
 
+func StringToPostType(s string) (PostType, error) {
+	switch s {
+	case withLink:
+		return WithLink, nil
+	case withText:
+		return WithText, nil
+	default:
+		return WithLink, ErrInvalidPostType
+	}
+}
+
 func NewPostComment(author TokenPayload, commentBody string) (*PostComment, error) {
 	if commentBody == "" {
 		return nil, ErrBadCommentBody
@@ -152,3 +160,8 @@ func NewPostVote(userID ID, vote Vote) *PostVote {
 		Vote:   vote,
 	}
 }
+
+// Valid reports whether v is an upvote or a downvote.
+func (v Vote) Valid() bool {
+	return v == upVote || v == downVote
+}
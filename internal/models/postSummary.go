@@ -0,0 +1,96 @@
+package models
+
+import "time"
+
+// PostSummary is the listing representation of a post. It carries counters
+// and the viewer's own vote instead of the comments and the whole vote list.
+type PostSummary struct {
+	ID           ID           `json:"id"`
+	Type         PostType     `json:"type"`
+	Category     PostCategory `json:"category"`
+	Title        string       `json:"title"`
+	URL          string       `json:"url,omitempty"`
+	Author       TokenPayload `json:"author"`
+	Score        int          `json:"score"`
+	Upvotes      int          `json:"upvotes"`
+	Downvotes    int          `json:"downvotes"`
+	Views        uint         `json:"views"`
+	CommentCount int          `json:"commentCount"`
+	Vote         Vote         `json:"vote"`
+	Created      string       `json:"created"`
+	Version      uint64       `json:"-"`
+	Updated      time.Time    `json:"-"`
+}
+
+// PostDetails adds the text and the comments to the summary.
+type PostDetails struct {
+	PostSummary
+	Text             string         `json:"text,omitempty"`
+	UpvotePercentage int            `json:"upvotePercentage"`
+	Comments         []*PostComment `json:"comments"`
+}
+
+// NewPostSummary projects the post as seen by viewer, anonymous callers pass
+// an empty ID and get no vote.
+func NewPostSummary(post Post, viewer ID) PostSummary {
+	upvotes, downvotes := post.Tally()
+	return PostSummary{
+		ID:           post.ID,
+		Type:         post.Type,
+		Category:     post.Category,
+		Title:        post.Title,
+		URL:          post.URL,
+		Author:       post.Author,
+		Score:        post.Score,
+		Upvotes:      upvotes,
+		Downvotes:    downvotes,
+		Views:        post.Views,
+		CommentCount: len(post.Comments),
+		Vote:         post.VoteOf(viewer),
+		Created:      post.Created,
+		Version:      post.Version,
+		Updated:      post.Updated,
+	}
+}
+
+func NewPostSummaries(posts []Post, viewer ID) []PostSummary {
+	summaries := make([]PostSummary, 0, len(posts))
+	for _, post := range posts {
+		summaries = append(summaries, NewPostSummary(post, viewer))
+	}
+	return summaries
+}
+
+func NewPostDetails(post Post, viewer ID) PostDetails {
+	return PostDetails{
+		PostSummary:      NewPostSummary(post, viewer),
+		Text:             post.Text,
+		UpvotePercentage: post.UpvotePercentage,
+		Comments:         post.Comments,
+	}
+}
+
+// VoteOf returns the vote of the user, zero when they have not voted.
+func (p *Post) VoteOf(userID ID) Vote {
+	if userID == "" {
+		return 0
+	}
+	vote, err := p.getVoteByUserID(userID)
+	if err != nil {
+		return 0
+	}
+	return vote.Vote
+}
+
+// Tally counts the up and down votes of the post.
+func (p *Post) Tally() (upvotes, downvotes int) {
+	for _, vote := range p.Votes {
+		switch vote.Vote {
+		case upVote:
+			upvotes++
+		case downVote:
+			downvotes++
+		}
+	}
+	return upvotes, downvotes
+}
@@ -22,14 +22,25 @@ const (
 )
 
 var (
-	secretKey = []byte("super secret key")
+	secretKey        = []byte("super secret key")
+	verificationKeys [][]byte
+	tokenTTL         = time.Hour * 24 * 7
 )
 
+// ConfigureSessions sets the key new tokens are signed with. Tokens signed with
+// any of the previous keys are still accepted, which allows rotating the secret
+// without logging everybody out.
+func ConfigureSessions(secret []byte, previous [][]byte, ttl time.Duration) {
+	secretKey = secret
+	verificationKeys = previous
+	tokenTTL = ttl
+}
+
 func NewSession(payload TokenPayload) (*Session, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user": payload,
 		"iat":  time.Now().Unix(),
-		"exp":  time.Now().AddDate(0, 0, 7).Unix(),
+		"exp":  time.Now().Add(tokenTTL).Unix(),
 	})
 
 	tokenString, err := token.SignedString(secretKey)
@@ -46,14 +57,13 @@ func (s *Session) InitWithToken(token string) {
 }
 
 func (s *Session) ValidateToken() (*TokenPayload, error) {
-	hashSecretGetter := func(token *jwt.Token) (interface{}, error) {
-		method, ok := token.Method.(*jwt.SigningMethodHMAC)
-		if !ok || method.Alg() != "HS256" {
-			return nil, fmt.Errorf("bad sign method")
+	token, err := parseToken(s.Token, secretKey)
+	for _, key := range verificationKeys {
+		if err == nil {
+			break
 		}
-		return secretKey, nil
+		token, err = parseToken(s.Token, key)
 	}
-	token, err := jwt.Parse(s.Token, hashSecretGetter)
 	if err != nil || !token.Valid {
 		return nil, ErrBadToken
 	}
@@ -72,3 +82,13 @@ func (s *Session) ValidateToken() (*TokenPayload, error) {
 		ID:    ID(dataFromToken["id"].(string)),
 	}, nil
 }
+
+func parseToken(tokenString string, key []byte) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		method, ok := token.Method.(*jwt.SigningMethodHMAC)
+		if !ok || method.Alg() != "HS256" {
+			return nil, fmt.Errorf("bad sign method")
+		}
+		return key, nil
+	})
+}
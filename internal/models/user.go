@@ -1,14 +1,26 @@
 package models
 
-import "github.com/hashicorp/go-uuid"
+import (
+	"github.com/hashicorp/go-uuid"
+	"golang.org/x/crypto/bcrypt"
+)
 
 type Username string
 type ID string
 
+type Role string
+
+const (
+	RoleUser  Role = "user"
+	RoleAdmin Role = "admin"
+)
+
 type User struct {
 	ID       ID       `schema:"-" json:"-"`
 	Username Username `schema:"username,required" json:"username,required"`
-	Password string   `schema:"password,required" json:"password,required"`
+	// PasswordHash is the bcrypt hash of the password, which is never stored
+	PasswordHash string `schema:"-" json:"-"`
+	Role         Role   `schema:"-" json:"-"`
 }
 
 type AuthUserInfo struct {
@@ -21,9 +33,43 @@ func NewUser(authInfo AuthUserInfo) (*User, error) {
 	if err != nil {
 		return nil, err
 	}
+	passwordHash, err := HashPassword(authInfo.Password)
+	if err != nil {
+		return nil, err
+	}
 	return &User{
-		ID:       ID(newUserID),
-		Username: authInfo.Login,
-		Password: authInfo.Password,
+		ID:           ID(newUserID),
+		Username:     authInfo.Login,
+		PasswordHash: passwordHash,
+		Role:         RoleUser,
 	}, nil
 }
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password is the one the user's hash was made
+// from.
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// ValidPasswordHash reports whether hash is a bcrypt hash, as an imported one
+// has to be.
+func ValidPasswordHash(hash string) bool {
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
+
+func StringToRole(role string) (Role, error) {
+	switch Role(role) {
+	case RoleUser, RoleAdmin:
+		return Role(role), nil
+	}
+	return "", ErrInvalidRole
+}
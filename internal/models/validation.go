@@ -0,0 +1,133 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaxUsernameLength = 32
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+	MaxTitleLength    = 300
+	MaxTextLength     = 40000
+	MaxURLLength      = 2048
+	MaxCommentLength  = 10000
+	bodyLocation      = "body"
+)
+
+var (
+	UsernameTemplate = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+type ValidationErr struct {
+	errs []ComplexErr
+}
+
+func NewValidationErr(errs ...ComplexErr) *ValidationErr {
+	return &ValidationErr{errs: errs}
+}
+
+func (e *ValidationErr) Error() string {
+	msgs := make([]string, 0, len(e.errs))
+	for _, err := range e.errs {
+		msgs = append(msgs, fmt.Sprint(err.Param, " ", err.Msg))
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationErr) ComplexErrArr() ComplexErrArr {
+	return NewComplexErr(e.errs...)
+}
+
+// Validator collects every violation instead of stopping at the first one,
+// so that clients can highlight all the invalid fields at once.
+type Validator struct {
+	errs []ComplexErr
+}
+
+func (v *Validator) Check(ok bool, param string, value interface{}, msg string) {
+	if ok {
+		return
+	}
+	v.errs = append(v.errs, ComplexErr{
+		Location: bodyLocation,
+		Param:    param,
+		Value:    value,
+		Msg:      msg,
+	})
+}
+
+func (v *Validator) Required(param, value string) bool {
+	present := strings.TrimSpace(value) != ""
+	v.Check(present, param, nil, "is required")
+	return present
+}
+
+func (v *Validator) MaxLength(param, value string, limit int) {
+	v.Check(utf8.RuneCountInString(value) <= limit, param, nil, "must be at most "+strconv.Itoa(limit)+" characters")
+}
+
+func (v *Validator) MinLength(param, value string, limit int) {
+	v.Check(utf8.RuneCountInString(value) >= limit, param, nil, "must be at least "+strconv.Itoa(limit)+" characters")
+}
+
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return NewValidationErr(v.errs...)
+}
+
+func (a AuthUserInfo) Validate() error {
+	v := &Validator{}
+	login := string(a.Login)
+	if v.Required("username", login) {
+		v.MaxLength("username", login, MaxUsernameLength)
+		v.Check(UsernameTemplate.MatchString(login), "username", login, "contains invalid characters")
+	}
+	if v.Required("password", a.Password) {
+		v.MinLength("password", a.Password, MinPasswordLength)
+		v.MaxLength("password", a.Password, MaxPasswordLength)
+	}
+	return v.Err()
+}
+
+func (p PostPayload) Validate() error {
+	v := &Validator{}
+	if v.Required("title", p.Title) {
+		v.MaxLength("title", p.Title, MaxTitleLength)
+		v.Check(strings.TrimSpace(p.Title) == p.Title, "title", p.Title, "cannot start or end with whitespace")
+	}
+	postType, err := StringToPostType(p.Type)
+	switch {
+	case !v.Required("type", p.Type):
+	case err != nil:
+		v.Check(false, "type", p.Type, "is invalid")
+	case postType == WithLink:
+		if v.Required("url", p.URL) {
+			v.MaxLength("url", p.URL, MaxURLLength)
+			v.Check(URLTemplate.MatchString(p.URL), "url", p.URL, "is invalid")
+		}
+	case postType == WithText:
+		if v.Required("text", p.Text) {
+			v.MaxLength("text", p.Text, MaxTextLength)
+		}
+	}
+	if v.Required("category", p.Category) {
+		_, err = StringToPostCategory(p.Category)
+		v.Check(err == nil, "category", p.Category, "is invalid")
+	}
+	return v.Err()
+}
+
+func (c Comment) Validate() error {
+	v := &Validator{}
+	if v.Required("comment", c.Body) {
+		v.MaxLength("comment", c.Body, MaxCommentLength)
+	}
+	return v.Err()
+}
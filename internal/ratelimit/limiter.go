@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+type Class string
+
+const (
+	ClassRead  Class = "read"
+	ClassWrite Class = "write"
+	ClassVote  Class = "vote"
+	ClassAuth  Class = "auth"
+)
+
+var (
+	Classes      = []Class{ClassRead, ClassWrite, ClassVote, ClassAuth}
+	voteTemplate = regexp.MustCompile(`/(upvote|downvote|unvote)$`)
+	authTemplate = regexp.MustCompile(`^/api/(login|register)$`)
+
+	DefaultPolicies = map[Class]Policy{
+		ClassRead:  {Rate: 20, Burst: 60},
+		ClassWrite: {Rate: 0.2, Burst: 10},
+		ClassVote:  {Rate: 1, Burst: 30},
+		ClassAuth:  {Rate: 0.1, Burst: 10},
+	}
+)
+
+// ErrorWriter writes an error response the way the API handlers do.
+type ErrorWriter interface {
+	WriteError(w http.ResponseWriter, r *http.Request, err error)
+}
+
+type Limiter struct {
+	store    Store
+	policies map[Class]Policy
+	logger   *zap.SugaredLogger
+	now      func() time.Time
+}
+
+func NewLimiter(store Store, policies map[Class]Policy, logger *zap.SugaredLogger) *Limiter {
+	return &Limiter{
+		store:    store,
+		policies: policies,
+		logger:   logger,
+		now:      time.Now,
+	}
+}
+
+func Classify(r *http.Request) Class {
+	switch {
+	case authTemplate.MatchString(r.URL.Path):
+		return ClassAuth
+	case voteTemplate.MatchString(r.URL.Path):
+		return ClassVote
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return ClassRead
+	default:
+		return ClassWrite
+	}
+}
+
+// Middleware limits authenticated requests per user and anonymous ones per
+// client IP. It has to run after authentication to see the user. Rejected
+// requests are answered through errs.
+func (l *Limiter) Middleware(errs ErrorWriter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return l.middleware(next, errs)
+	}
+}
+
+func (l *Limiter) middleware(next http.Handler, errs ErrorWriter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision, ok := l.Take(r.Context(), Classify(r), mdwr.ClientIP(r))
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+		if !decision.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(RetryAfterSeconds(decision)))
+			errs.WriteError(w, r, models.ErrTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Take charges a call of class to the authenticated user of ctx, or to
+// clientIP for anonymous callers. ok is false when the call is not limited:
+// its class has no policy or the store failed.
+func (l *Limiter) Take(ctx context.Context, class Class, clientIP string) (decision Decision, ok bool) {
+	policy, ok := l.policies[class]
+	if !ok {
+		return Decision{}, false
+	}
+
+	key := string(class) + ":ip:" + clientIP
+	if payload, ok := ctx.Value(models.Payload).(*models.TokenPayload); ok {
+		key = string(class) + ":user:" + string(payload.ID)
+	}
+	decision, err := l.store.Take(ctx, key, policy, l.now())
+	if err != nil {
+		// Failing open keeps the site up when a shared store is unreachable
+		mdwr.Logger(ctx, l.logger).Errorw("Rate limiter failed", "reason", err.Error(), "key", key)
+		return Decision{}, false
+	}
+	if !decision.Allowed {
+		mdwr.Logger(ctx, l.logger).Warnw("Rate limit exceeded", "class", class, "key", key)
+	}
+	return decision, true
+}
+
+// RetryAfterSeconds is the whole number of seconds a denied caller waits.
+func RetryAfterSeconds(decision Decision) int {
+	return max(ceilSeconds(decision.RetryAfter), 1)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
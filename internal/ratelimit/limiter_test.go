@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// recordedErr keeps the error the limiter answered with.
+type recordedErr struct {
+	err error
+}
+
+func (e *recordedErr) WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	e.err = err
+	w.WriteHeader(http.StatusTooManyRequests)
+}
+
+func TestLimiterMiddleware(t *testing.T) {
+	now := time.Now()
+	limiter := NewLimiter(NewMemoryStore(), map[Class]Policy{ClassWrite: {Rate: 1, Burst: 2}}, zap.NewNop().Sugar())
+	limiter.now = func() time.Time { return now }
+	errs := &recordedErr{}
+	handler := limiter.Middleware(errs)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name           string
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{name: "first token", wantStatus: http.StatusOK},
+		{name: "second token", wantStatus: http.StatusOK},
+		{name: "bucket empty", wantStatus: http.StatusTooManyRequests, wantRetryAfter: "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs.err = nil
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/posts", nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if tt.wantStatus == http.StatusTooManyRequests && !errors.Is(errs.err, models.ErrTooManyRequests) {
+				t.Errorf("WriteError() got %v, want %v", errs.err, models.ErrTooManyRequests)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	policy := Policy{Rate: 1, Burst: 10}
+	tests := []struct {
+		name  string
+		after time.Duration
+		want  int
+	}{
+		{name: "before the interval", after: sweepInterval / 2, want: 101},
+		{name: "refilled buckets go", after: sweepInterval, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryStore()
+			start := time.Now()
+			store.lastSweep = start
+			for i := 0; i < 100; i++ {
+				if _, err := store.Take(ctx, fmt.Sprintf("read:ip:%d", i), policy, start); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := store.Take(ctx, "read:ip:last", policy, start.Add(tt.after)); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(store.buckets); got != tt.want {
+				t.Errorf("%d buckets kept, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/config"
+	"go.uber.org/zap"
+	"net"
+	"net/http"
+	"time"
+)
+
+type closer struct {
+	name  string
+	close func(ctx context.Context) error
+}
+
+type Server struct {
+	http            *http.Server
+	logger          *zap.SugaredLogger
+	shutdownTimeout time.Duration
+	drainDelay      time.Duration
+	drainHooks      []func()
+	closers         []closer
+}
+
+func New(cfg config.HTTPConfig, handler http.Handler, logger *zap.SugaredLogger) *Server {
+	return &Server{
+		http: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           handler,
+			ReadTimeout:       cfg.ReadTimeout.Duration,
+			ReadHeaderTimeout: cfg.ReadHeaderTimeout.Duration,
+			WriteTimeout:      cfg.WriteTimeout.Duration,
+			IdleTimeout:       cfg.IdleTimeout.Duration,
+			MaxHeaderBytes:    cfg.MaxHeaderBytes,
+			ErrorLog:          zap.NewStdLog(logger.Desugar()),
+		},
+		logger:          logger,
+		shutdownTimeout: cfg.ShutdownTimeout.Duration,
+		drainDelay:      cfg.DrainDelay.Duration,
+		drainHooks:      make([]func(), 0, 2),
+		closers:         make([]closer, 0, 4),
+	}
+}
+
+// OnDrain registers a hook that is run when a shutdown signal is received, one
+// drain delay before the listener is closed.
+func (s *Server) OnDrain(f func()) {
+	s.drainHooks = append(s.drainHooks, f)
+}
+
+// OnShutdown registers a hook that is run as soon as draining starts. Long-lived
+// connections such as realtime streams are not tracked by http.Server.Shutdown
+// and have to be closed through it.
+func (s *Server) OnShutdown(f func()) {
+	s.http.RegisterOnShutdown(f)
+}
+
+// OnClose registers a resource to be closed after all connections have drained.
+// Resources are closed in the order they were registered.
+func (s *Server) OnClose(name string, close func(ctx context.Context) error) {
+	s.closers = append(s.closers, closer{name: name, close: close})
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.http.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve accepts connections on listener until ctx is cancelled, then drains
+// in-flight requests within the shutdown timeout and closes the registered
+// resources.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		s.logger.Infow("Starting server", "addr", listener.Addr().String())
+		serveErr <- s.http.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.logger.Infow("Shutting down", "drain_delay", s.drainDelay, "timeout", s.shutdownTimeout)
+	for _, hook := range s.drainHooks {
+		hook()
+	}
+	time.Sleep(s.drainDelay)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	errs := make([]error, 0, len(s.closers)+1)
+	if err := s.http.Shutdown(shutdownCtx); err != nil {
+		s.logger.Errorw("Connections were not drained in time", "reason", err.Error())
+		errs = append(errs, err)
+		// Cut the remaining connections so that their handlers fail instead of
+		// using the resources closed below
+		if err = s.http.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, err)
+	}
+	// The closers get their own deadline, the drain may have used it all up
+	closeCtx, cancelClose := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancelClose()
+	for _, c := range s.closers {
+		if err := c.close(closeCtx); err != nil {
+			s.logger.Errorw("Close failed", "resource", c.name, "reason", err.Error())
+			errs = append(errs, err)
+		}
+	}
+	s.logger.Info("Server stopped")
+	return errors.Join(errs...)
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/config"
+	"go.uber.org/zap"
+	"io"
+	"net"
+	"net/http"
+	"os/signal"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// inFlight is a handler that blocks until release is closed, so that the
+// signal arrives while its requests are being served.
+type inFlight struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h *inFlight) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/slow" {
+		io.WriteString(w, "fast") //nolint:errcheck
+		return
+	}
+	h.started <- struct{}{}
+	<-h.release
+	io.WriteString(w, "done") //nolint:errcheck
+}
+
+type result struct {
+	body string
+	err  error
+}
+
+func TestServeDrainsOnSignal(t *testing.T) {
+	tests := []struct {
+		name            string
+		shutdownTimeout time.Duration
+		// releaseAfter lets the in-flight requests finish once the server has
+		// stopped accepting, or never when it is false
+		releaseAfter bool
+		wantDrained  bool
+	}{
+		{name: "in-flight requests finish", shutdownTimeout: 5 * time.Second, releaseAfter: true, wantDrained: true},
+		{name: "connections are cut at the deadline", shutdownTimeout: 200 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const requests = 3
+			handler := &inFlight{started: make(chan struct{}, requests), release: make(chan struct{})}
+			cfg := config.Default().HTTP
+			cfg.ShutdownTimeout = config.Duration{Duration: tt.shutdownTimeout}
+			srv := New(cfg, handler, zap.NewNop().Sugar())
+
+			var mu sync.Mutex
+			var closedAt time.Time
+			srv.OnClose("storage", func(ctx context.Context) error {
+				if err := ctx.Err(); err != nil {
+					t.Errorf("closer got a done context: %v", err)
+				}
+				mu.Lock()
+				closedAt = time.Now()
+				mu.Unlock()
+				return nil
+			})
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			base := "http://" + listener.Addr().String()
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+			defer stop()
+			served := make(chan error, 1)
+			go func() {
+				served <- srv.Serve(ctx, listener)
+			}()
+
+			results := make(chan result, requests)
+			for i := 0; i < requests; i++ {
+				go func() {
+					body, err := get(base + "/slow")
+					results <- result{body, err}
+				}()
+			}
+			for i := 0; i < requests; i++ {
+				<-handler.started
+			}
+
+			if err = syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+				t.Fatal(err)
+			}
+			<-ctx.Done()
+			if !refused(base + "/fast") {
+				t.Fatal("new requests are still accepted after the signal")
+			}
+
+			var releasedAt time.Time
+			if tt.releaseAfter {
+				releasedAt = time.Now()
+				close(handler.release)
+			}
+			for i := 0; i < requests; i++ {
+				var res result
+				select {
+				case res = <-results:
+				case <-time.After(5 * time.Second):
+					close(handler.release)
+					t.Fatal("the in-flight requests are still running after the shutdown deadline")
+				}
+				switch {
+				case tt.wantDrained && (res.err != nil || res.body != "done"):
+					t.Errorf("in-flight request = %q, %v, want it to finish", res.body, res.err)
+				case !tt.wantDrained && res.err == nil:
+					t.Errorf("in-flight request = %q, want its connection cut", res.body)
+				}
+			}
+
+			err = <-served
+			if tt.wantDrained && err != nil {
+				t.Errorf("Serve() = %v, want nil", err)
+			}
+			if !tt.wantDrained && !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Serve() = %v, want %v", err, context.DeadlineExceeded)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if closedAt.IsZero() {
+				t.Fatal("the closer did not run")
+			}
+			if tt.wantDrained && closedAt.Before(releasedAt) {
+				t.Error("the closer ran before the in-flight requests finished")
+			}
+			if !tt.releaseAfter {
+				close(handler.release)
+			}
+		})
+	}
+}
+
+func get(url string) (string, error) {
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+// refused waits for the listener to be closed, which Shutdown does first.
+func refused(url string) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := get(url); err != nil {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/backup"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/pkg/errors"
+	"io"
+	"slices"
+)
+
+type AdminUserStorage interface {
+	UserStorage
+	GetUser(login models.Username) (models.User, error)
+	GetAllUsers() ([]models.User, error)
+	SetRole(login models.Username, role models.Role) (models.User, error)
+	SetPassword(login models.Username, password string) (models.User, error)
+	Replace(replace func(current []models.User) ([]models.User, error)) error
+}
+
+// AdminPostStorage works on the repository without the ownership checks of
+// PostHandler. Wrap it with events.WrapAdminPosts so that the deletions and
+// restorations reach the event subscribers.
+type AdminPostStorage interface {
+	GetAllPosts(ctx context.Context) ([]models.Post, error)
+	GetPostsByCategory(ctx context.Context, postCategory models.PostCategory) ([]models.Post, error)
+	FindPost(ctx context.Context, postID models.ID) (models.Post, error)
+	DeletePost(ctx context.Context, postID models.ID) error
+	RestorePost(ctx context.Context, postID models.ID) (models.Post, error)
+	DeleteComment(ctx context.Context, postID, commentID models.ID) (models.Post, error)
+	RestoreComment(ctx context.Context, postID, commentID models.ID) (models.Post, error)
+	Snapshot(ctx context.Context) ([]models.Post, error)
+	Replace(ctx context.Context, replace func(current []models.Post) ([]models.Post, error)) error
+}
+
+// UserInfo is a user as shown to the administrators, without the password.
+type UserInfo struct {
+	Username models.Username `json:"username"`
+	ID       models.ID       `json:"id"`
+	Role     models.Role     `json:"role"`
+}
+
+// Admin implements the operations of the administrators. The accounts
+// registered as admins when it is created are administrators whatever their
+// stored role. They are tied to their IDs, so registering a name after a
+// configured admin was removed gives no rights.
+type Admin struct {
+	users    AdminUserStorage
+	posts    AdminPostStorage
+	adminIDs []models.ID
+}
+
+// NewAdmin fails when one of admins is not registered, since anyone could
+// otherwise claim the name through the registration.
+func NewAdmin(users AdminUserStorage, posts AdminPostStorage, admins []models.Username) (*Admin, error) {
+	adminIDs := make([]models.ID, 0, len(admins))
+	for _, login := range admins {
+		user, err := users.GetUser(login)
+		if errors.Is(err, models.ErrNoUser) {
+			return nil, errors.Errorf("NewAdmin: configured admin %q is not registered", login)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "NewAdmin: ")
+		}
+		adminIDs = append(adminIDs, user.ID)
+	}
+	return &Admin{
+		users:    users,
+		posts:    posts,
+		adminIDs: adminIDs,
+	}, nil
+}
+
+func (a *Admin) IsAdmin(login models.Username) (bool, error) {
+	user, err := a.users.GetUser(login)
+	if errors.Is(err, models.ErrNoUser) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "IsAdmin: ")
+	}
+	return user.Role == models.RoleAdmin || slices.Contains(a.adminIDs, user.ID), nil
+}
+
+func (a *Admin) Users() ([]UserInfo, error) {
+	users, err := a.users.GetAllUsers()
+	if err != nil {
+		return nil, errors.Wrap(err, "Users: ")
+	}
+	infos := make([]UserInfo, 0, len(users))
+	for _, user := range users {
+		infos = append(infos, a.userInfo(user))
+	}
+	return infos, nil
+}
+
+func (a *Admin) CreateUser(authData models.AuthUserInfo, role models.Role) (UserInfo, error) {
+	if err := authData.Validate(); err != nil {
+		return UserInfo{}, errors.Wrap(err, "CreateUser: ")
+	}
+	user, err := a.users.RegisterUser(authData)
+	if err != nil {
+		return UserInfo{}, errors.Wrap(err, "CreateUser: ")
+	}
+	if role != user.Role {
+		return a.SetRole(user.Username, role)
+	}
+	return a.userInfo(*user), nil
+}
+
+func (a *Admin) SetRole(login models.Username, role models.Role) (UserInfo, error) {
+	user, err := a.users.SetRole(login, role)
+	if err != nil {
+		return UserInfo{}, errors.Wrap(unknownUser(err), "SetRole: ")
+	}
+	return a.userInfo(user), nil
+}
+
+func (a *Admin) ResetPassword(login models.Username, password string) (UserInfo, error) {
+	v := &models.Validator{}
+	if v.Required("password", password) {
+		v.MinLength("password", password, models.MinPasswordLength)
+		v.MaxLength("password", password, models.MaxPasswordLength)
+	}
+	if err := v.Err(); err != nil {
+		return UserInfo{}, errors.Wrap(err, "ResetPassword: ")
+	}
+	user, err := a.users.SetPassword(login, password)
+	if err != nil {
+		return UserInfo{}, errors.Wrap(unknownUser(err), "ResetPassword: ")
+	}
+	return a.userInfo(user), nil
+}
+
+// TopPosts returns the limit most popular posts, every post when limit is not
+// positive.
+func (a *Admin) TopPosts(ctx context.Context, limit int) ([]models.Post, error) {
+	posts, err := a.posts.GetAllPosts(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "TopPosts: ")
+	}
+	return top(posts, limit), nil
+}
+
+func (a *Admin) TopPostsByCategory(ctx context.Context, postCategory models.PostCategory, limit int) ([]models.Post, error) {
+	posts, err := a.posts.GetPostsByCategory(ctx, postCategory)
+	if err != nil {
+		return nil, errors.Wrap(err, "TopPostsByCategory: ")
+	}
+	return top(posts, limit), nil
+}
+
+// Post returns the post without counting a view.
+func (a *Admin) Post(ctx context.Context, postID models.ID) (models.Post, error) {
+	post, err := a.posts.FindPost(ctx, postID)
+	if err != nil {
+		return models.Post{}, errors.Wrap(err, "Post: ")
+	}
+	return post, nil
+}
+
+func (a *Admin) DeletePost(ctx context.Context, postID models.ID) error {
+	if err := a.posts.DeletePost(ctx, postID); err != nil {
+		return errors.Wrap(err, "DeletePost: ")
+	}
+	return nil
+}
+
+func (a *Admin) RestorePost(ctx context.Context, postID models.ID) (models.Post, error) {
+	post, err := a.posts.RestorePost(ctx, postID)
+	if err != nil {
+		return models.Post{}, errors.Wrap(err, "RestorePost: ")
+	}
+	return post, nil
+}
+
+func (a *Admin) DeleteComment(ctx context.Context, postID, commentID models.ID) (models.Post, error) {
+	post, err := a.posts.DeleteComment(ctx, postID, commentID)
+	if err != nil {
+		return models.Post{}, errors.Wrap(err, "DeleteComment: ")
+	}
+	return post, nil
+}
+
+func (a *Admin) RestoreComment(ctx context.Context, postID, commentID models.ID) (models.Post, error) {
+	post, err := a.posts.RestoreComment(ctx, postID, commentID)
+	if err != nil {
+		return models.Post{}, errors.Wrap(err, "RestoreComment: ")
+	}
+	return post, nil
+}
+
+// Export takes a consistent copy of the users and the posts to be written out
+// in the backup format.
+func (a *Admin) Export(ctx context.Context) (*backup.Snapshot, error) {
+	snapshot, err := backup.Take(ctx, a.users, a.posts)
+	if err != nil {
+		return nil, errors.Wrap(err, "Export: ")
+	}
+	return snapshot, nil
+}
+
+func (a *Admin) Import(ctx context.Context, r io.Reader, opts backup.Options) (backup.Report, error) {
+	report, err := backup.Import(ctx, r, a.users, a.posts, opts)
+	if err != nil {
+		return report, errors.Wrap(err, "Import: ")
+	}
+	return report, nil
+}
+
+func (a *Admin) userInfo(user models.User) UserInfo {
+	info := UserInfo{
+		Username: user.Username,
+		ID:       user.ID,
+		Role:     user.Role,
+	}
+	if slices.Contains(a.adminIDs, user.ID) {
+		info.Role = models.RoleAdmin
+	}
+	return info
+}
+
+func top(posts []models.Post, limit int) []models.Post {
+	if limit > 0 && len(posts) > limit {
+		return posts[:limit]
+	}
+	return posts
+}
+
+// unknownUser tells a missing user apart from the failed logins ErrNoUser
+// stands for elsewhere.
+func unknownUser(err error) error {
+	if errors.Is(err, models.ErrNoUser) {
+		return models.ErrUnknownUser
+	}
+	return err
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/pkg/errors"
+	"time"
+)
+
+type AttemptStore interface {
+	GetAttempts(ctx context.Context, key string) (models.LoginAttempts, error)
+	UpdateAttempts(ctx context.Context, key string, ttl time.Duration, update func(*models.LoginAttempts)) (models.LoginAttempts, error)
+	ResetAttempts(ctx context.Context, key string) error
+}
+
+// LockoutPolicy describes how many failures are tolerated within Window before
+// the key is locked. Every failure past FreeAttempts doubles the lock duration,
+// starting at BaseDelay and capped at MaxDelay.
+type LockoutPolicy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	Window       time.Duration
+}
+
+var (
+	DefaultUserLockout = LockoutPolicy{
+		FreeAttempts: 5,
+		BaseDelay:    time.Second * 30,
+		MaxDelay:     time.Minute * 30,
+		Window:       time.Hour,
+	}
+	DefaultIPLockout = LockoutPolicy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}
+)
+
+type LoginGuard struct {
+	store      AttemptStore
+	userPolicy LockoutPolicy
+	ipPolicy   LockoutPolicy
+	now        func() time.Time
+}
+
+func NewLoginGuard(store AttemptStore, userPolicy, ipPolicy LockoutPolicy) *LoginGuard {
+	return &LoginGuard{
+		store:      store,
+		userPolicy: userPolicy,
+		ipPolicy:   ipPolicy,
+		now:        time.Now,
+	}
+}
+
+func (g *LoginGuard) Check(ctx context.Context, login models.Username, ip string) (time.Duration, error) {
+	var retryAfter time.Duration
+	now := g.now()
+	for _, key := range []string{userKey(login), ipKey(ip)} {
+		attempts, err := g.store.GetAttempts(ctx, key)
+		if err != nil {
+			return 0, errors.Wrap(err, "Check: ")
+		}
+		if attempts.IsLocked(now) {
+			retryAfter = max(retryAfter, attempts.LockedUntil.Sub(now))
+		}
+	}
+	if retryAfter > 0 {
+		return retryAfter, models.ErrTooManyAttempts
+	}
+	return 0, nil
+}
+
+func (g *LoginGuard) Fail(ctx context.Context, login models.Username, ip string) ([]models.Lockout, error) {
+	lockouts := make([]models.Lockout, 0, 2)
+	for key, policy := range map[string]LockoutPolicy{userKey(login): g.userPolicy, ipKey(ip): g.ipPolicy} {
+		attempts, err := g.registerFailure(ctx, key, policy)
+		if err != nil {
+			return lockouts, errors.Wrap(err, "Fail: ")
+		}
+		if attempts.IsLocked(g.now()) {
+			lockouts = append(lockouts, models.Lockout{
+				Key:      key,
+				Failures: attempts.Failures,
+				Until:    attempts.LockedUntil,
+			})
+		}
+	}
+	return lockouts, nil
+}
+
+// Succeed only clears the username counter: an attacker holding one valid
+// account must not be able to reset the per-IP counter by logging into it.
+func (g *LoginGuard) Succeed(ctx context.Context, login models.Username, ip string) error {
+	if err := g.store.ResetAttempts(ctx, userKey(login)); err != nil {
+		return errors.Wrap(err, "Succeed: ")
+	}
+	return nil
+}
+
+func (g *LoginGuard) registerFailure(ctx context.Context, key string, policy LockoutPolicy) (models.LoginAttempts, error) {
+	now := g.now()
+	return g.store.UpdateAttempts(ctx, key, policy.Window+policy.MaxDelay, func(attempts *models.LoginAttempts) {
+		if now.Sub(attempts.LastFailure) > policy.Window {
+			attempts.Failures = 0
+		}
+		attempts.Failures++
+		attempts.LastFailure = now
+		if attempts.Failures > policy.FreeAttempts {
+			attempts.LockedUntil = now.Add(policy.delay(attempts.Failures - policy.FreeAttempts))
+		}
+	})
+}
+
+func (p LockoutPolicy) delay(excess int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < excess && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, p.MaxDelay)
+}
+
+func userKey(login models.Username) string {
+	return "user:" + string(login)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
 	"github.com/pkg/errors"
+	"time"
 )
 
 type PostStorage interface {
@@ -13,6 +14,8 @@ type PostStorage interface {
 	GetPostByID(ctx context.Context, postID models.ID) (models.Post, error)
 	CreatePost(ctx context.Context, postPayload models.PostPayload) (models.Post, error)
 	DeletePost(ctx context.Context, postID models.ID) error
+	// LastModified returns when a post was last created, changed or deleted
+	LastModified(ctx context.Context) (time.Time, error)
 }
 
 type PostActions interface {
@@ -68,8 +71,8 @@ func (p *PostHandler) GetPostByID(ctx context.Context, postID models.ID) (models
 }
 
 func (p *PostHandler) CreatePost(ctx context.Context, postPayload models.PostPayload) (models.Post, error) {
-	if postPayload.Type == models.WithLink && !models.URLTemplate.MatchString(postPayload.URL) {
-		return models.Post{}, errors.Wrap(models.ErrInvalidURL, "CreatePost: ")
+	if err := postPayload.Validate(); err != nil {
+		return models.Post{}, errors.Wrap(err, "CreatePost: ")
 	}
 	return p.repo.CreatePost(ctx, postPayload)
 }
@@ -81,6 +84,14 @@ func (p *PostHandler) DeletePost(ctx context.Context, postID models.ID) error {
 	return nil
 }
 
+func (p *PostHandler) LastModified(ctx context.Context) (time.Time, error) {
+	modified, err := p.repo.LastModified(ctx)
+	if err != nil {
+		return modified, errors.Wrap(err, "LastModified: ")
+	}
+	return modified, nil
+}
+
 func (p *PostHandler) Upvote(ctx context.Context, postID models.ID) (models.Post, error) {
 	post, err := p.actionController.Upvote(ctx, postID)
 	if err != nil {
@@ -106,6 +117,9 @@ func (p *PostHandler) Unvote(ctx context.Context, postID models.ID) (models.Post
 }
 
 func (p *PostHandler) AddComment(ctx context.Context, postID models.ID, comment models.Comment) (models.Post, error) {
+	if err := comment.Validate(); err != nil {
+		return models.Post{}, errors.Wrap(err, "AddComment: ")
+	}
 	post, err := p.actionController.AddComment(ctx, postID, comment)
 	if err != nil {
 		return post, errors.Wrap(err, "AddComment: ")
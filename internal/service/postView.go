@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+)
+
+// PublicPost is a post as API callers see it. The vote ledger stays internal:
+// Votes only holds the caller's own vote, every other vote just counts
+// towards the totals.
+type PublicPost struct {
+	models.Post
+	Upvotes   int `json:"upvotes"`
+	Downvotes int `json:"downvotes"`
+}
+
+// ViewerID returns the ID of the authenticated caller, or an empty ID for
+// anonymous ones.
+func ViewerID(ctx context.Context) models.ID {
+	if payload, ok := ctx.Value(models.Payload).(*models.TokenPayload); ok {
+		return payload.ID
+	}
+	return ""
+}
+
+// NewPublicPost serializes post for the caller found in ctx.
+func NewPublicPost(ctx context.Context, post models.Post) PublicPost {
+	public := PublicPost{Post: post}
+	public.Upvotes, public.Downvotes = post.Tally()
+	public.Votes = make([]*models.PostVote, 0, 1)
+	if viewer := ViewerID(ctx); viewer != "" {
+		if vote := post.VoteOf(viewer); vote != 0 {
+			public.Votes = append(public.Votes, &models.PostVote{UserID: viewer, Vote: vote})
+		}
+	}
+	return public
+}
+
+func NewPublicPosts(ctx context.Context, posts []models.Post) []PublicPost {
+	public := make([]PublicPost, 0, len(posts))
+	for _, post := range posts {
+		public = append(public, NewPublicPost(ctx, post))
+	}
+	return public
+}
+
+// OwnVote is the vote of the caller the post was serialized for.
+func (p PublicPost) OwnVote() models.Vote {
+	if len(p.Votes) == 0 {
+		return 0
+	}
+	return p.Votes[0].Vote
+}
@@ -21,6 +21,9 @@ func NewUserHandler(u UserStorage) *UserHandler {
 }
 
 func (h *UserHandler) Register(authData models.AuthUserInfo) (models.TokenPayload, error) {
+	if err := authData.Validate(); err != nil {
+		return models.TokenPayload{}, errors.Wrap(err, "Register: ")
+	}
 	user, err := h.Repo.RegisterUser(authData)
 	if err != nil {
 		err = errors.Wrap(err, "Register: ")
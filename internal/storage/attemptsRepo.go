@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"sync"
+	"time"
+)
+
+const (
+	// attemptsSweepInterval is how often UpdateAttempts looks for expired
+	// entries: at most one scan per interval, however many keys fail
+	attemptsSweepInterval = time.Minute
+	// maxAttemptEntries bounds the keys a flood of made-up usernames can add
+	maxAttemptEntries = 100_000
+)
+
+type attemptEntry struct {
+	attempts models.LoginAttempts
+	expires  time.Time
+}
+
+type AttemptRepo struct {
+	storage    map[string]*attemptEntry
+	mu         *sync.Mutex
+	maxEntries int
+	lastSweep  time.Time
+}
+
+func NewAttemptRepo() *AttemptRepo {
+	return &AttemptRepo{
+		storage:    make(map[string]*attemptEntry, 42),
+		mu:         &sync.Mutex{},
+		maxEntries: maxAttemptEntries,
+		lastSweep:  time.Now(),
+	}
+}
+
+func (a *AttemptRepo) GetAttempts(ctx context.Context, key string) (models.LoginAttempts, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry, ok := a.storage[key]
+	if !ok || time.Now().After(entry.expires) {
+		return models.LoginAttempts{}, nil
+	}
+	return entry.attempts, nil
+}
+
+func (a *AttemptRepo) UpdateAttempts(ctx context.Context, key string, ttl time.Duration, update func(*models.LoginAttempts)) (models.LoginAttempts, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if now.Sub(a.lastSweep) >= attemptsSweepInterval {
+		a.sweep(now)
+		a.lastSweep = now
+	}
+
+	entry, ok := a.storage[key]
+	if !ok || now.After(entry.expires) {
+		if !ok && len(a.storage) >= a.maxEntries {
+			a.evictOne()
+		}
+		entry = &attemptEntry{}
+		a.storage[key] = entry
+	}
+	update(&entry.attempts)
+	entry.expires = now.Add(ttl)
+	return entry.attempts, nil
+}
+
+func (a *AttemptRepo) ResetAttempts(ctx context.Context, key string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.storage, key)
+	return nil
+}
+
+func (a *AttemptRepo) sweep(now time.Time) {
+	for key, entry := range a.storage {
+		if now.After(entry.expires) {
+			delete(a.storage, key)
+		}
+	}
+}
+
+// evictOne makes room for a new key once the repository is full of live
+// entries. It drops an arbitrary one: memory stays bounded, at the price of
+// forgetting some failures while the flood lasts.
+func (a *AttemptRepo) evictOne() {
+	for key := range a.storage {
+		delete(a.storage, key)
+		return
+	}
+}
+
+func (a *AttemptRepo) Close(ctx context.Context) error {
+	return nil
+}
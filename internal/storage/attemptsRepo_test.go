@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"testing"
+	"time"
+)
+
+func TestAttemptRepoBounds(t *testing.T) {
+	fail := func(attempts *models.LoginAttempts) {
+		attempts.Failures++
+	}
+	tests := []struct {
+		name string
+		// ttl is the lifetime of the failures of the flood
+		ttl time.Duration
+		// sinceSweep is how long ago the last sweep ran
+		sinceSweep time.Duration
+		wantMax    int
+	}{
+		{name: "the cap holds live entries", ttl: time.Hour, wantMax: 10},
+		{name: "expired entries wait for the next sweep", ttl: time.Nanosecond, wantMax: 10},
+		{name: "a due sweep drops expired entries", ttl: time.Nanosecond, sinceSweep: attemptsSweepInterval, wantMax: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := NewAttemptRepo()
+			repo.maxEntries = 10
+			for i := 0; i < 50; i++ {
+				if _, err := repo.UpdateAttempts(ctx, fmt.Sprintf("user:%d", i), tt.ttl, fail); err != nil {
+					t.Fatal(err)
+				}
+			}
+			repo.lastSweep = time.Now().Add(-tt.sinceSweep)
+			if _, err := repo.UpdateAttempts(ctx, "user:last", time.Hour, fail); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(repo.storage); got > tt.wantMax {
+				t.Errorf("%d entries kept, want at most %d", got, tt.wantMax)
+			}
+			attempts, err := repo.GetAttempts(ctx, "user:last")
+			if err != nil || attempts.Failures != 1 {
+				t.Errorf("GetAttempts() of the newest key = %+v, %v, want 1 failure", attempts, err)
+			}
+		})
+	}
+}
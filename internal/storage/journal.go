@@ -0,0 +1,355 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/pkg/errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FsyncPolicy tells the journal when its writes are flushed to the disk.
+type FsyncPolicy string
+
+const (
+	// FsyncAlways syncs every change before it is acknowledged
+	FsyncAlways FsyncPolicy = "always"
+	// FsyncInterval syncs once a second and may lose the last second of changes
+	FsyncInterval FsyncPolicy = "interval"
+	// FsyncNever leaves the flushing to the operating system
+	FsyncNever FsyncPolicy = "never"
+)
+
+const fsyncInterval = time.Second
+
+const (
+	opRegister       = "register"
+	opSetRole        = "setRole"
+	opSetPassword    = "setPassword"
+	opReplaceUsers   = "replaceUsers"
+	opCreatePost     = "createPost"
+	opDeletePost     = "deletePost"
+	opRestorePost    = "restorePost"
+	opAddComment     = "addComment"
+	opDeleteComment  = "deleteComment"
+	opRestoreComment = "restoreComment"
+	opVote           = "vote"
+	opReplacePosts   = "replacePosts"
+	// A segment starts with the deleted posts and comments that can still be
+	// restored, which the snapshot before it does not hold
+	opDeletedPost    = "deletedPost"
+	opDeletedComment = "deletedComment"
+)
+
+var (
+	errCorruptJournal = errors.New("corrupt journal")
+	errJournalClosed  = errors.New("journal is closed")
+)
+
+// journalRecord is a change of a repository. Replaying a record sets the
+// state it describes, so records already contained in the loaded data do no
+// harm.
+type journalRecord struct {
+	Op        string              `json:"op"`
+	User      *journalUser        `json:"user,omitempty"`
+	Users     []journalUser       `json:"users,omitempty"`
+	Post      *models.Post        `json:"post,omitempty"`
+	Posts     []models.Post       `json:"posts,omitempty"`
+	PostID    models.ID           `json:"postId,omitempty"`
+	Comment   *models.PostComment `json:"comment,omitempty"`
+	CommentID models.ID           `json:"commentId,omitempty"`
+	UserID    models.ID           `json:"userId,omitempty"`
+	// Vote is 0 when the user took the vote back
+	Vote models.Vote `json:"vote,omitempty"`
+	// At is when a post or comment was deleted
+	At *time.Time `json:"at,omitempty"`
+}
+
+// deletedAt returns At, taking the records written without it as deleted
+// now.
+func (r journalRecord) deletedAt() time.Time {
+	if r.At == nil {
+		return time.Now()
+	}
+	return *r.At
+}
+
+// journalUser holds the fields models.User keeps out of its JSON.
+type journalUser struct {
+	ID           models.ID       `json:"id"`
+	Username     models.Username `json:"username"`
+	PasswordHash string          `json:"passwordHash"`
+	Role         models.Role     `json:"role"`
+}
+
+func newJournalUser(user models.User) *journalUser {
+	return &journalUser{
+		ID:           user.ID,
+		Username:     user.Username,
+		PasswordHash: user.PasswordHash,
+		Role:         user.Role,
+	}
+}
+
+func (u journalUser) user() models.User {
+	return models.User{
+		ID:           u.ID,
+		Username:     u.Username,
+		PasswordHash: u.PasswordHash,
+		Role:         u.Role,
+	}
+}
+
+// newVoteRecord records the vote userID holds on post after a change.
+func newVoteRecord(post *models.Post, userID models.ID) journalRecord {
+	record := journalRecord{Op: opVote, PostID: post.ID, UserID: userID}
+	for _, vote := range post.Votes {
+		if vote.UserID == userID {
+			record.Vote = vote.Vote
+		}
+	}
+	return record
+}
+
+// Journal is the write-ahead log of the persisted repositories. It is split
+// into numbered segment files, each line of which is a record as JSON after
+// the CRC-32 of that JSON in hex.
+type Journal struct {
+	dir     string
+	fsync   FsyncPolicy
+	mu      sync.Mutex
+	file    *os.File
+	segment uint64
+	size    int64
+	// appended counts the records of the current segment, dirty tells
+	// whether some of them are not synced yet
+	appended int
+	dirty    bool
+}
+
+func openJournal(dir string, segment uint64, fsync FsyncPolicy) (*Journal, error) {
+	j := &Journal{dir: dir, fsync: fsync}
+	file, err := j.openSegment(segment)
+	if err != nil {
+		return nil, err
+	}
+	j.file, j.segment = file, segment
+	return j, nil
+}
+
+// append writes the record to the current segment. A nil journal and a
+// record without an operation write nothing.
+func (j *Journal) append(record journalRecord) error {
+	if j == nil || record.Op == "" {
+		return nil
+	}
+	line, err := encodeRecord(record)
+	if err != nil {
+		return errors.Wrap(err, "append: ")
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return errJournalClosed
+	}
+	if _, err = j.file.Write(line); err != nil {
+		// Drop a partial line so that the next records do not follow garbage
+		j.file.Truncate(j.size) //nolint:errcheck
+		return errors.Wrap(err, "append: ")
+	}
+	j.size += int64(len(line))
+	j.appended++
+	if j.fsync != FsyncAlways {
+		j.dirty = true
+		return nil
+	}
+	if err = j.file.Sync(); err != nil {
+		return errors.Wrap(err, "append: ")
+	}
+	return nil
+}
+
+// pending returns the number of records written since the last rotation.
+func (j *Journal) pending() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.appended
+}
+
+// sync flushes the records written since the last sync.
+func (j *Journal) sync() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil || !j.dirty {
+		return nil
+	}
+	j.dirty = false
+	return errors.Wrap(j.file.Sync(), "sync: ")
+}
+
+// rotate starts the next segment and returns its number. The current one is
+// kept when the next one cannot be created. The next segment starts with
+// carry, records that restate the state of the previous segments and so do
+// not count as pending changes.
+func (j *Journal) rotate(carry ...journalRecord) (uint64, error) {
+	var lines []byte
+	for _, record := range carry {
+		line, err := encodeRecord(record)
+		if err != nil {
+			return 0, errors.Wrap(err, "rotate: ")
+		}
+		lines = append(lines, line...)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return 0, errJournalClosed
+	}
+	file, err := j.openSegment(j.segment + 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(lines) > 0 {
+		if _, err = file.Write(lines); err == nil {
+			err = file.Sync()
+		}
+		if err != nil {
+			// A retry must not append to a half-written segment
+			file.Close()                               //nolint:errcheck
+			os.Remove(segmentPath(j.dir, j.segment+1)) //nolint:errcheck
+			return 0, errors.Wrap(err, "rotate: ")
+		}
+	}
+	if err = j.closeSegment(); err != nil {
+		file.Close() //nolint:errcheck
+		return 0, err
+	}
+	j.file, j.segment, j.size, j.appended = file, j.segment+1, int64(len(lines)), 0
+	return j.segment, nil
+}
+
+// encodeRecord returns the journal line of record.
+func encodeRecord(record journalRecord) ([]byte, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	line := make([]byte, 0, len(data)+10)
+	line = fmt.Appendf(line, "%08x ", crc32.ChecksumIEEE(data))
+	line = append(line, data...)
+	return append(line, '\n'), nil
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.closeSegment()
+	j.file = nil
+	return err
+}
+
+// openSegment and closeSegment expect the caller to hold the lock.
+func (j *Journal) openSegment(segment uint64) (*os.File, error) {
+	file, err := os.OpenFile(segmentPath(j.dir, segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, errors.Wrap(err, "openSegment: ")
+	}
+	if err = syncDir(j.dir); err != nil {
+		file.Close() //nolint:errcheck
+		return nil, errors.Wrap(err, "openSegment: ")
+	}
+	return file, nil
+}
+
+func (j *Journal) closeSegment() error {
+	if j.fsync != FsyncNever {
+		if err := j.file.Sync(); err != nil {
+			return errors.Wrap(err, "closeSegment: ")
+		}
+	}
+	j.dirty = false
+	return errors.Wrap(j.file.Close(), "closeSegment: ")
+}
+
+// replaySegment passes the records of a segment to apply. A damaged end, the
+// record that was being written when the process stopped, is cut off and
+// reported in torn as the number of bytes dropped. A damaged record followed
+// by intact ones is an error.
+func replaySegment(path string, apply func(journalRecord) error) (replayed int, torn int64, err error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "replaySegment: ")
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) == 0 && err == io.EOF {
+			return replayed, 0, nil
+		}
+		if err != nil && err != io.EOF {
+			return replayed, 0, errors.Wrap(err, "replaySegment: ")
+		}
+		record, ok := decodeJournalLine(line)
+		if !ok {
+			rest, err := io.ReadAll(r)
+			if err != nil {
+				return replayed, 0, errors.Wrap(err, "replaySegment: ")
+			}
+			if intactRecords(rest) {
+				return replayed, 0, errors.Wrapf(errCorruptJournal, "%s: damaged record at offset %d", path, offset)
+			}
+			if err = file.Truncate(offset); err != nil {
+				return replayed, 0, errors.Wrap(err, "replaySegment: ")
+			}
+			if err = file.Sync(); err != nil {
+				return replayed, 0, errors.Wrap(err, "replaySegment: ")
+			}
+			return replayed, int64(len(line) + len(rest)), nil
+		}
+		if err = apply(record); err != nil {
+			return replayed, 0, errors.Wrapf(err, "%s: record at offset %d", path, offset)
+		}
+		offset += int64(len(line))
+		replayed++
+	}
+}
+
+func decodeJournalLine(line []byte) (journalRecord, bool) {
+	var record journalRecord
+	data, ok := bytes.CutSuffix(line, []byte("\n"))
+	if !ok || len(data) < 9 || data[8] != ' ' {
+		return record, false
+	}
+	sum, err := strconv.ParseUint(string(data[:8]), 16, 32)
+	if err != nil || uint32(sum) != crc32.ChecksumIEEE(data[9:]) {
+		return record, false
+	}
+	if err = json.Unmarshal(data[9:], &record); err != nil || record.Op == "" {
+		return record, false
+	}
+	return record, true
+}
+
+func intactRecords(data []byte) bool {
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if _, ok := decodeJournalLine(line); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"bytes"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/pkg/errors"
+	"os"
+	"testing"
+)
+
+// writeSegment journals records into segment 1 of dir and returns its
+// contents.
+func writeSegment(t *testing.T, dir string, records ...journalRecord) []byte {
+	t.Helper()
+	journal, err := openJournal(dir, 1, FsyncNever)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, record := range records {
+		if err = journal.append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(segmentPath(dir, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReplaySegment(t *testing.T) {
+	tests := []struct {
+		name string
+		// damage builds the replayed segment from the lines of an intact one
+		damage       func(lines [][]byte) []byte
+		wantReplayed int
+		wantErr      error
+	}{
+		{
+			name:         "intact",
+			damage:       func(lines [][]byte) []byte { return bytes.Join(lines, nil) },
+			wantReplayed: 3,
+		},
+		{
+			name: "last record cut short",
+			damage: func(lines [][]byte) []byte {
+				return bytes.Join([][]byte{lines[0], lines[1], lines[2][:len(lines[2])/2]}, nil)
+			},
+			wantReplayed: 2,
+		},
+		{
+			name: "checksum mismatch in the last record",
+			damage: func(lines [][]byte) []byte {
+				return bytes.Join([][]byte{lines[0], lines[1], flipByte(lines[2], 12)}, nil)
+			},
+			wantReplayed: 2,
+		},
+		{
+			name: "garbage after the records",
+			damage: func(lines [][]byte) []byte {
+				return bytes.Join(append(lines, []byte("0000")), nil)
+			},
+			wantReplayed: 3,
+		},
+		{
+			name: "damaged record before intact ones",
+			damage: func(lines [][]byte) []byte {
+				return bytes.Join([][]byte{lines[0], flipByte(lines[1], 12), lines[2]}, nil)
+			},
+			wantReplayed: 1,
+			wantErr:      errCorruptJournal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			intact := writeSegment(t, dir,
+				journalRecord{Op: opSetRole, User: &journalUser{ID: "1", Username: "alice", Role: models.RoleUser}},
+				journalRecord{Op: opDeletePost, PostID: "2"},
+				journalRecord{Op: opVote, PostID: "2", UserID: "1", Vote: 1},
+			)
+			lines := bytes.SplitAfter(intact, []byte("\n"))[:3]
+			damaged := tt.damage(lines)
+			path := segmentPath(dir, 1)
+			if err := os.WriteFile(path, damaged, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			var applied int
+			replayed, torn, err := replaySegment(path, func(record journalRecord) error {
+				applied++
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("replaySegment() err = %v, want %v", err, tt.wantErr)
+			}
+			if replayed != tt.wantReplayed || applied != tt.wantReplayed {
+				t.Errorf("replaySegment() replayed = %d, applied %d, want %d", replayed, applied, tt.wantReplayed)
+			}
+
+			// The damaged end is cut off, while a damaged middle leaves the
+			// segment as it is
+			wantSize := len(bytes.Join(lines[:tt.wantReplayed], nil))
+			if tt.wantErr != nil {
+				wantSize = len(damaged)
+			}
+			if wantTorn := int64(len(damaged) - wantSize); torn != wantTorn {
+				t.Errorf("replaySegment() torn = %d, want %d", torn, wantTorn)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) != wantSize {
+				t.Errorf("segment is %d bytes after the replay, want %d", len(data), wantSize)
+			}
+		})
+	}
+}
+
+func flipByte(line []byte, i int) []byte {
+	flipped := bytes.Clone(line)
+	flipped[i] ^= 0xff
+	return flipped
+}
@@ -0,0 +1,365 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/backup"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	segmentPrefix  = "wal-"
+	segmentSuffix  = ".log"
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".jsonl"
+	lockFileName   = "LOCK"
+)
+
+var errDataDirLocked = errors.New("data directory is in use by another process")
+
+type PersistenceOptions struct {
+	Dir              string
+	Fsync            FsyncPolicy
+	SnapshotInterval time.Duration
+}
+
+// Persistence keeps a UserRepo and a PostRepo in a data directory: every
+// change goes to the journal, and the journal is compacted into a snapshot
+// in the export format every SnapshotInterval and on Close. Snapshot N holds
+// the changes of the segments before N, so a restart loads the latest
+// snapshot and replays the segments from its number on.
+//
+// The deleted posts and comments that can still be restored are not
+// persisted, and neither are the views counted since the last snapshot.
+type Persistence struct {
+	Users   *UserRepo
+	Posts   *PostRepo
+	opts    PersistenceOptions
+	journal *Journal
+	// lock holds the flock on the LOCK file of the data directory
+	lock   *os.File
+	logger *zap.SugaredLogger
+	// snapshotMu keeps the snapshots from overlapping
+	snapshotMu sync.Mutex
+	stop       chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// OpenPersistence loads the repositories from opts.Dir, creating it when it
+// does not exist, and starts journaling their changes. It fails when another
+// process has the directory open.
+func OpenPersistence(ctx context.Context, opts PersistenceOptions, logger *zap.SugaredLogger) (*Persistence, error) {
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return nil, errors.Wrap(err, "OpenPersistence: ")
+	}
+	lock, err := lockDataDir(opts.Dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "OpenPersistence: ")
+	}
+	p, err := openPersistence(ctx, opts, lock, logger)
+	if err != nil {
+		lock.Close() //nolint:errcheck
+		return nil, errors.Wrap(err, "OpenPersistence: ")
+	}
+	return p, nil
+}
+
+func openPersistence(ctx context.Context, opts PersistenceOptions, lock *os.File, logger *zap.SugaredLogger) (*Persistence, error) {
+	snapshots, segments, err := listDataDir(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Persistence{
+		Users:  NewUserRepo(),
+		Posts:  NewPostRepo(),
+		opts:   opts,
+		lock:   lock,
+		logger: logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	var first uint64
+	if len(snapshots) > 0 {
+		first = snapshots[len(snapshots)-1]
+		if err = p.load(ctx, first); err != nil {
+			return nil, err
+		}
+	}
+	replayed, next := 0, max(first, 1)
+	for _, segment := range segments {
+		if segment < first {
+			continue
+		}
+		n, err := p.replay(segment)
+		if err != nil {
+			return nil, err
+		}
+		replayed += n
+		next = segment + 1
+	}
+	p.Posts.sortPosts()
+	// Versions from before the restart must not match the ETags handed out
+	// back then
+	now := time.Now()
+	for _, post := range p.Posts.storage {
+		post.Version = uint64(now.UnixNano())
+		post.Updated = now
+	}
+	logger.Infow("Storage loaded", "dir", opts.Dir, "snapshot", first, "replayed", replayed)
+
+	if p.journal, err = openJournal(opts.Dir, next, opts.Fsync); err != nil {
+		return nil, err
+	}
+	p.Users.journal = p.journal
+	p.Posts.journal = p.journal
+	if replayed > 0 {
+		if err = p.snapshot(true); err != nil {
+			p.journal.Close() //nolint:errcheck
+			return nil, err
+		}
+	} else {
+		p.removeBefore(first)
+	}
+	go p.run()
+	return p, nil
+}
+
+// Snapshot compacts the journal into a snapshot unless nothing changed since
+// the previous one.
+func (p *Persistence) Snapshot(ctx context.Context) error {
+	p.snapshotMu.Lock()
+	defer p.snapshotMu.Unlock()
+	return p.snapshot(false)
+}
+
+// Ping reports whether the data directory is still there.
+func (p *Persistence) Ping(ctx context.Context) error {
+	_, err := os.Stat(p.opts.Dir)
+	return err
+}
+
+// Close stops the background work, takes a last snapshot and closes the
+// journal. Changes made after Close fail.
+func (p *Persistence) Close(ctx context.Context) error {
+	var err error
+	p.closeOnce.Do(func() {
+		close(p.stop)
+		<-p.done
+		p.snapshotMu.Lock()
+		defer p.snapshotMu.Unlock()
+		err = p.snapshot(true)
+		if closeErr := p.journal.Close(); err == nil {
+			err = closeErr
+		}
+		if closeErr := p.lock.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
+
+func (p *Persistence) run() {
+	defer close(p.done)
+	snapshots := time.NewTicker(p.opts.SnapshotInterval)
+	defer snapshots.Stop()
+	var syncs <-chan time.Time
+	if p.opts.Fsync == FsyncInterval {
+		ticker := time.NewTicker(fsyncInterval)
+		defer ticker.Stop()
+		syncs = ticker.C
+	}
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-syncs:
+			if err := p.journal.sync(); err != nil {
+				p.logger.Errorw("Journal sync error", "reason", err.Error())
+			}
+		case <-snapshots.C:
+			if err := p.Snapshot(context.Background()); err != nil {
+				p.logger.Errorw("Snapshot error", "reason", err.Error())
+			}
+		}
+	}
+}
+
+// snapshot expects the caller to hold snapshotMu. Both repos are frozen while
+// the journal moves on to the next segment, so the snapshot holds exactly the
+// changes of the segments before it.
+func (p *Persistence) snapshot(force bool) error {
+	p.Posts.mu.RLock()
+	p.Users.mu.RLock()
+	if !force && p.journal.pending() == 0 {
+		p.Users.mu.RUnlock()
+		p.Posts.mu.RUnlock()
+		return nil
+	}
+	segment, err := p.journal.rotate(p.Posts.deleted(time.Now())...)
+	posts := p.Posts.snapshot()
+	users := p.Users.list()
+	p.Users.mu.RUnlock()
+	p.Posts.mu.RUnlock()
+	if err != nil {
+		return errors.Wrap(err, "snapshot: ")
+	}
+
+	name := dataFileName(snapshotPrefix, segment, snapshotSuffix)
+	if err = writeFileAtomic(p.opts.Dir, name, backup.NewSnapshot(users, posts)); err != nil {
+		return errors.Wrap(err, "snapshot: ")
+	}
+	p.removeBefore(segment)
+	return nil
+}
+
+func (p *Persistence) load(ctx context.Context, snapshot uint64) error {
+	file, err := os.Open(filepath.Join(p.opts.Dir, dataFileName(snapshotPrefix, snapshot, snapshotSuffix)))
+	if err != nil {
+		return errors.Wrap(err, "load: ")
+	}
+	defer file.Close()
+	_, err = backup.Import(ctx, file, p.Users, p.Posts, backup.Options{Mode: backup.ModeReplace})
+	return errors.Wrapf(err, "load: snapshot %d", snapshot)
+}
+
+func (p *Persistence) replay(segment uint64) (int, error) {
+	path := segmentPath(p.opts.Dir, segment)
+	replayed, torn, err := replaySegment(path, func(record journalRecord) error {
+		if !p.Users.apply(record) && !p.Posts.apply(record) {
+			return errors.Wrapf(errCorruptJournal, "unknown operation %q", record.Op)
+		}
+		return nil
+	})
+	if err != nil {
+		return replayed, errors.Wrap(err, "replay: ")
+	}
+	if torn > 0 {
+		p.logger.Warnw("Skipped the truncated end of the journal", "segment", path, "bytes", torn)
+	}
+	return replayed, nil
+}
+
+// removeBefore deletes the snapshots and the segments a newer snapshot
+// replaces, along with temporary files left by a crash.
+func (p *Persistence) removeBefore(snapshot uint64) {
+	entries, err := os.ReadDir(p.opts.Dir)
+	if err != nil {
+		p.logger.Warnw("Data directory cleanup error", "reason", err.Error())
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		n, isSnapshot := parseDataFileName(name, snapshotPrefix, snapshotSuffix)
+		if !isSnapshot {
+			n, _ = parseDataFileName(name, segmentPrefix, segmentSuffix)
+		}
+		if (n > 0 && n < snapshot) || strings.HasSuffix(name, ".tmp") {
+			if err = os.Remove(filepath.Join(p.opts.Dir, name)); err != nil {
+				p.logger.Warnw("Data directory cleanup error", "reason", err.Error())
+			}
+		}
+	}
+}
+
+// lockDataDir takes an exclusive flock on the LOCK file of dir, which is
+// released when the returned file is closed or the process exits.
+func lockDataDir(dir string) (*os.File, error) {
+	file, err := os.OpenFile(filepath.Join(dir, lockFileName), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close() //nolint:errcheck
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, errors.Wrap(errDataDirLocked, dir)
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// listDataDir returns the numbers of the snapshots and of the segments in
+// ascending order.
+func listDataDir(dir string) (snapshots, segments []uint64, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		if n, ok := parseDataFileName(entry.Name(), snapshotPrefix, snapshotSuffix); ok {
+			snapshots = append(snapshots, n)
+		} else if n, ok = parseDataFileName(entry.Name(), segmentPrefix, segmentSuffix); ok {
+			segments = append(segments, n)
+		}
+	}
+	slices.SortFunc(snapshots, cmp.Compare[uint64])
+	slices.SortFunc(segments, cmp.Compare[uint64])
+	return snapshots, segments, nil
+}
+
+func dataFileName(prefix string, n uint64, suffix string) string {
+	return fmt.Sprintf("%s%016d%s", prefix, n, suffix)
+}
+
+func parseDataFileName(name, prefix, suffix string) (uint64, bool) {
+	number, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return 0, false
+	}
+	if number, ok = strings.CutSuffix(number, suffix); !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(number, 10, 64)
+	return n, err == nil
+}
+
+func segmentPath(dir string, segment uint64) string {
+	return filepath.Join(dir, dataFileName(segmentPrefix, segment, segmentSuffix))
+}
+
+// writeFileAtomic replaces name in dir with the output of w, so that a crash
+// leaves either the old file or the complete new one.
+func writeFileAtomic(dir, name string, w io.WriterTo) error {
+	tmp, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+	if _, err = w.WriteTo(tmp); err != nil {
+		tmp.Close() //nolint:errcheck
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close() //nolint:errcheck
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
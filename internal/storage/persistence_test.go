@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestPersistence(t *testing.T, dir string) *Persistence {
+	t.Helper()
+	p, err := OpenPersistence(context.Background(), PersistenceOptions{
+		Dir:              dir,
+		Fsync:            FsyncAlways,
+		SnapshotInterval: time.Hour,
+	}, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("OpenPersistence() = %v", err)
+	}
+	return p
+}
+
+// crash stops p without the snapshot Close takes, leaving the changes since
+// the last snapshot in the journal only.
+func crash(t *testing.T, p *Persistence) {
+	t.Helper()
+	close(p.stop)
+	<-p.done
+	if err := p.journal.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.lock.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPersistenceRestart(t *testing.T) {
+	tests := []struct {
+		name string
+		// snapshot takes a snapshot between the first and the second half
+		// of the changes
+		snapshot bool
+		// stop ends the first run
+		stop func(t *testing.T, p *Persistence)
+	}{
+		{
+			name: "clean shutdown",
+			stop: func(t *testing.T, p *Persistence) {
+				if err := p.Close(context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name: "journal only",
+			stop: crash,
+		},
+		{
+			name:     "snapshot and journal",
+			snapshot: true,
+			stop:     crash,
+		},
+		{
+			name:     "snapshot and a torn journal",
+			snapshot: true,
+			stop: func(t *testing.T, p *Persistence) {
+				segment := p.journal.segment
+				crash(t, p)
+				file, err := os.OpenFile(segmentPath(p.opts.Dir, segment), os.O_WRONLY|os.O_APPEND, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer file.Close()
+				if _, err = file.WriteString(`0badf00d {"op":"vote","postId":`); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p := openTestPersistence(t, dir)
+			alice, err := p.Users.RegisterUser(models.AuthUserInfo{Login: "alice", Password: "password1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.WithValue(context.Background(), models.Payload, &models.TokenPayload{Login: alice.Username, ID: alice.ID})
+			post, err := p.Posts.CreatePost(ctx, models.PostPayload{Type: "text", Title: "Hello", Text: "world", Category: "music"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// The trash is restorable after the restart, whether it was
+			// carried over a snapshot or is only in the journal
+			trashed, err := p.Posts.CreatePost(ctx, models.PostPayload{Type: "text", Title: "Trash", Text: "bin", Category: "music"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = p.Posts.DeletePost(ctx, trashed.ID); err != nil {
+				t.Fatal(err)
+			}
+			withComment, err := p.Posts.AddComment(ctx, post.ID, models.Comment{Body: "deleted"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			deletedComment := withComment.Comments[0].ID
+			if _, err = p.Posts.DeleteComment(ctx, post.ID, deletedComment); err != nil {
+				t.Fatal(err)
+			}
+			if tt.snapshot {
+				if err = p.Snapshot(ctx); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err = p.Users.SetRole("alice", models.RoleAdmin); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = p.Posts.AddComment(ctx, post.ID, models.Comment{Body: "first"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = p.Posts.Upvote(ctx, post.ID); err != nil {
+				t.Fatal(err)
+			}
+			tt.stop(t, p)
+			files, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, file := range files {
+				data, err := os.ReadFile(filepath.Join(dir, file.Name()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if bytes.Contains(data, []byte("password1")) {
+					t.Errorf("%s holds the password of alice", file.Name())
+				}
+			}
+
+			p = openTestPersistence(t, dir)
+			defer p.Close(context.Background()) //nolint:errcheck
+			user, err := p.Users.GetUser("alice")
+			if err != nil {
+				t.Fatalf("GetUser() after the restart = %v", err)
+			}
+			if user.ID != alice.ID || user.Role != models.RoleAdmin {
+				t.Errorf("user after the restart = %+v, want the admin %s", user, alice.ID)
+			}
+			if _, err = p.Users.Authorize(models.AuthUserInfo{Login: "alice", Password: "password1"}); err != nil {
+				t.Errorf("Authorize() after the restart = %v", err)
+			}
+			restored, err := p.Posts.FindPost(ctx, post.ID)
+			if err != nil {
+				t.Fatalf("FindPost() after the restart = %v", err)
+			}
+			if restored.Title != "Hello" || len(restored.Comments) != 1 || restored.Score != 1 {
+				t.Errorf("post after the restart = %+v, want its comment and upvote", restored)
+			}
+			if _, err = p.Posts.RestorePost(ctx, trashed.ID); err != nil {
+				t.Errorf("RestorePost() after the restart = %v", err)
+			}
+			if restored, err = p.Posts.RestoreComment(ctx, post.ID, deletedComment); err != nil || len(restored.Comments) != 2 {
+				t.Errorf("RestoreComment() after the restart = %d comments, %v", len(restored.Comments), err)
+			}
+		})
+	}
+}
+
+func TestPersistenceLock(t *testing.T) {
+	dir := t.TempDir()
+	p := openTestPersistence(t, dir)
+	_, err := OpenPersistence(context.Background(), PersistenceOptions{Dir: dir, SnapshotInterval: time.Hour}, zap.NewNop().Sugar())
+	if !errors.Is(err, errDataDirLocked) {
+		t.Fatalf("OpenPersistence() of an open directory = %v, want %v", err, errDataDirLocked)
+	}
+	if err = p.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	openTestPersistence(t, dir).Close(context.Background()) //nolint:errcheck
+}
@@ -7,17 +7,49 @@ import (
 	"github.com/pkg/errors"
 	"slices"
 	"sync"
+	"time"
+)
+
+const (
+	// deletedRetention is how long a deleted post or comment can be restored
+	deletedRetention = 30 * 24 * time.Hour
+	// purgeInterval is how often the deletes look for expired ones
+	purgeInterval = time.Minute
 )
 
 type PostRepo struct {
 	storage []*models.Post
+	// The deleted posts and comments are kept until they are restored or
+	// deletedRetention has passed
+	deletedPosts    map[models.ID]deletedPost
+	deletedComments map[models.ID]deletedComment
+	lastPurge       time.Time
+	// modified advances with every change but the views, deletes included
+	modified time.Time
+	// journal is nil unless the posts are persisted
+	journal *Journal
 	mu      *sync.RWMutex
 }
 
+type deletedPost struct {
+	post      *models.Post
+	deletedAt time.Time
+}
+
+type deletedComment struct {
+	postID    models.ID
+	comment   *models.PostComment
+	deletedAt time.Time
+}
+
 func NewPostRepo() *PostRepo {
 	return &PostRepo{
-		storage: make([]*models.Post, 0, 42),
-		mu:      &sync.RWMutex{},
+		storage:         make([]*models.Post, 0, 42),
+		deletedPosts:    make(map[models.ID]deletedPost),
+		deletedComments: make(map[models.ID]deletedComment),
+		lastPurge:       time.Now(),
+		modified:        time.Now(),
+		mu:              &sync.RWMutex{},
 	}
 }
 
@@ -56,11 +88,26 @@ func (p *PostRepo) GetPostsByUser(ctx context.Context, userLogin models.Username
 }
 
 func (p *PostRepo) GetPostByID(ctx context.Context, postID models.ID) (models.Post, error) {
-	post, err := p.getPostByID(postID)
+	// Views are not journaled, the snapshots save them
+	post, err := p.updatePost(postID, func(post *models.Post) (journalRecord, error) {
+		post.UpdateViews()
+		return journalRecord{}, nil
+	}, nil)
 	if err != nil {
 		return models.Post{}, errors.Wrap(err, "GetPostByID: ")
 	}
-	return *post.UpdateViews(), nil
+	return post, nil
+}
+
+// FindPost returns the post without counting a view.
+func (p *PostRepo) FindPost(ctx context.Context, postID models.ID) (models.Post, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	post, err := p.findPost(postID)
+	if err != nil {
+		return models.Post{}, errors.Wrap(err, "FindPost: ")
+	}
+	return post.Clone(), nil
 }
 
 func (p *PostRepo) CreatePost(ctx context.Context, postPayload models.PostPayload) (models.Post, error) {
@@ -69,55 +116,119 @@ func (p *PostRepo) CreatePost(ctx context.Context, postPayload models.PostPayloa
 		return models.Post{}, models.ErrBadPayload
 	}
 
-	defer p.sortPosts()
 	newPost, err := models.NewPost(*author, postPayload)
 	if err != nil {
 		return models.Post{}, err
 	}
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	if err = p.journal.append(journalRecord{Op: opCreatePost, Post: newPost}); err != nil {
+		return models.Post{}, errors.Wrap(err, "CreatePost: ")
+	}
 	p.storage = append(p.storage, newPost)
-	return *newPost, nil
+	p.sortPosts()
+	p.modified = time.Now()
+	return newPost.Clone(), nil
 }
 
 func (p *PostRepo) DeletePost(ctx context.Context, postID models.ID) error {
-	lenBeforeDelete := len(p.storage)
 	p.mu.Lock()
-	p.storage = slices.DeleteFunc(p.storage, func(post *models.Post) bool {
+	defer p.mu.Unlock()
+	postIdx := slices.IndexFunc(p.storage, func(post *models.Post) bool {
 		return post.ID == postID
 	})
-	p.mu.Unlock()
-	if lenBeforeDelete == len(p.storage) {
+	if postIdx == -1 {
 		return models.ErrPostNotFound
 	}
+	now := time.Now()
+	if err := p.journal.append(journalRecord{Op: opDeletePost, PostID: postID, At: &now}); err != nil {
+		return errors.Wrap(err, "DeletePost: ")
+	}
+	p.purge(now)
+	p.deletedPosts[postID] = deletedPost{post: p.storage[postIdx], deletedAt: now}
+	p.storage = slices.Delete(p.storage, postIdx, postIdx+1)
+	p.modified = now
 	return nil
 }
 
+func (p *PostRepo) RestorePost(ctx context.Context, postID models.ID) (models.Post, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	deleted, ok := p.deletedPosts[postID]
+	if !ok || expired(deleted.deletedAt, time.Now()) {
+		return models.Post{}, errors.Wrap(models.ErrPostNotFound, "RestorePost: ")
+	}
+	post := deleted.post
+	if err := p.journal.append(journalRecord{Op: opRestorePost, Post: post}); err != nil {
+		return models.Post{}, errors.Wrap(err, "RestorePost: ")
+	}
+	delete(p.deletedPosts, postID)
+	p.storage = append(p.storage, post)
+	p.sortPosts()
+	p.modified = time.Now()
+	return post.Clone(), nil
+}
+
 func (p *PostRepo) AddComment(ctx context.Context, postID models.ID, comment models.Comment) (models.Post, error) {
 	author, ok := ctx.Value(models.Payload).(*models.TokenPayload)
 	if !ok {
 		return models.Post{}, models.ErrBadPayload
 	}
 
-	post, err := p.getPostByID(postID)
+	post, err := p.updatePost(postID, func(post *models.Post) (journalRecord, error) {
+		if err := post.AddComment(*author, comment.Body); err != nil {
+			return journalRecord{}, err
+		}
+		return journalRecord{Op: opAddComment, PostID: postID, Comment: post.Comments[len(post.Comments)-1]}, nil
+	}, nil)
 	if err != nil {
 		return models.Post{}, errors.Wrap(err, "AddComment: ")
 	}
-	if err = post.AddComment(*author, comment.Body); err != nil {
-		return models.Post{}, errors.Wrap(err, "AddComment: ")
-	}
-	return *post, nil
+	return post, nil
 }
 
 func (p *PostRepo) DeleteComment(ctx context.Context, postID, commentID models.ID) (models.Post, error) {
-	post, err := p.getPostByID(postID)
+	var comment *models.PostComment
+	now := time.Now()
+	post, err := p.updatePost(postID, func(post *models.Post) (journalRecord, error) {
+		commentIdx := slices.IndexFunc(post.Comments, func(comment *models.PostComment) bool {
+			return comment.ID == commentID
+		})
+		if commentIdx == -1 {
+			return journalRecord{}, models.ErrCommentNotFound
+		}
+		comment = post.Comments[commentIdx]
+		if err := post.DeleteComment(commentID); err != nil {
+			return journalRecord{}, err
+		}
+		return journalRecord{Op: opDeleteComment, PostID: postID, CommentID: commentID, At: &now}, nil
+	}, func() {
+		p.purge(now)
+		p.deletedComments[commentID] = deletedComment{postID: postID, comment: comment, deletedAt: now}
+	})
 	if err != nil {
 		return models.Post{}, errors.Wrap(err, "DeleteComment: ")
 	}
-	if err = post.DeleteComment(commentID); err != nil {
-		return models.Post{}, errors.Wrap(err, "DeleteComment: ")
+	return post, nil
+}
+
+// RestoreComment fails with ErrPostNotFound while the post itself is deleted,
+// the comment can be restored once the post is back.
+func (p *PostRepo) RestoreComment(ctx context.Context, postID, commentID models.ID) (models.Post, error) {
+	post, err := p.updatePost(postID, func(post *models.Post) (journalRecord, error) {
+		deleted, ok := p.deletedComments[commentID]
+		if !ok || deleted.postID != postID || expired(deleted.deletedAt, time.Now()) {
+			return journalRecord{}, models.ErrCommentNotFound
+		}
+		post.RestoreComment(deleted.comment)
+		return journalRecord{Op: opRestoreComment, PostID: postID, Comment: deleted.comment}, nil
+	}, func() {
+		delete(p.deletedComments, commentID)
+	})
+	if err != nil {
+		return models.Post{}, errors.Wrap(err, "RestoreComment: ")
 	}
-	return *post, nil
+	return post, nil
 }
 
 func (p *PostRepo) Upvote(ctx context.Context, postID models.ID) (models.Post, error) {
@@ -126,15 +237,16 @@ func (p *PostRepo) Upvote(ctx context.Context, postID models.ID) (models.Post, e
 		return models.Post{}, models.ErrBadPayload
 	}
 
-	post, err := p.getPostByID(postID)
+	post, err := p.updatePost(postID, func(post *models.Post) (journalRecord, error) {
+		if err := post.Upvote(author.ID); err != nil {
+			return journalRecord{}, err
+		}
+		return newVoteRecord(post, author.ID), nil
+	}, nil)
 	if err != nil {
 		return models.Post{}, errors.Wrap(err, "Upvote: ")
 	}
-	if err = post.Upvote(author.ID); err != nil {
-		return models.Post{}, errors.Wrap(err, "Upvote: ")
-	}
-	p.sortPosts()
-	return *post, nil
+	return post, nil
 }
 
 func (p *PostRepo) Downvote(ctx context.Context, postID models.ID) (models.Post, error) {
@@ -143,15 +255,16 @@ func (p *PostRepo) Downvote(ctx context.Context, postID models.ID) (models.Post,
 		return models.Post{}, models.ErrBadPayload
 	}
 
-	post, err := p.getPostByID(postID)
+	post, err := p.updatePost(postID, func(post *models.Post) (journalRecord, error) {
+		if err := post.Downvote(author.ID); err != nil {
+			return journalRecord{}, err
+		}
+		return newVoteRecord(post, author.ID), nil
+	}, nil)
 	if err != nil {
 		return models.Post{}, errors.Wrap(err, "Downvote: ")
 	}
-	if err = post.Downvote(author.ID); err != nil {
-		return models.Post{}, errors.Wrap(err, "Downvote: ")
-	}
-	p.sortPosts()
-	return *post, nil
+	return post, nil
 }
 
 func (p *PostRepo) Unvote(ctx context.Context, postID models.ID) (models.Post, error) {
@@ -160,20 +273,102 @@ func (p *PostRepo) Unvote(ctx context.Context, postID models.ID) (models.Post, e
 		return models.Post{}, models.ErrBadPayload
 	}
 
-	post, err := p.getPostByID(postID)
+	post, err := p.updatePost(postID, func(post *models.Post) (journalRecord, error) {
+		if err := post.Unvote(author.ID); err != nil {
+			return journalRecord{}, err
+		}
+		return newVoteRecord(post, author.ID), nil
+	}, nil)
 	if err != nil {
 		return models.Post{}, errors.Wrap(err, "Unvote: ")
 	}
-	if err = post.Unvote(author.ID); err != nil {
-		return models.Post{}, errors.Wrap(err, "Unvote: ")
-	}
-	p.sortPosts()
-	return *post, nil
+	return post, nil
+}
+
+func (p *PostRepo) LastModified(ctx context.Context) (time.Time, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.modified, nil
 }
 
-func (p *PostRepo) getPostByID(postID models.ID) (*models.Post, error) {
+// Snapshot returns deep copies of the stored posts taken at a single point:
+// every change to the posts is made under the write lock.
+func (p *PostRepo) Snapshot(ctx context.Context) ([]models.Post, error) {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
+	return p.snapshot(), nil
+}
+
+// Replace stores the posts returned by replace, which gets a snapshot of the
+// current ones. No other change is made in between. The deleted posts and
+// comments that clash with the new ones can no longer be restored.
+func (p *PostRepo) Replace(ctx context.Context, replace func(current []models.Post) ([]models.Post, error)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	next, err := replace(p.snapshot())
+	if err != nil {
+		return errors.Wrap(err, "Replace: ")
+	}
+	if err = p.journal.append(journalRecord{Op: opReplacePosts, Posts: next}); err != nil {
+		return errors.Wrap(err, "Replace: ")
+	}
+
+	p.storage = make([]*models.Post, 0, len(next))
+	for i := range next {
+		post := next[i].Clone()
+		p.storage = append(p.storage, &post)
+	}
+	p.dropClashingDeleted()
+	p.sortPosts()
+	p.modified = time.Now()
+	return nil
+}
+
+// updatePost lets update change a copy of the stored post under the write
+// lock, and stores the copy once the change update describes is journaled.
+// commit, when set, makes the changes outside of the post at that point. It
+// returns a copy of the result.
+func (p *PostRepo) updatePost(postID models.ID, update func(*models.Post) (journalRecord, error), commit func()) (models.Post, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	post, err := p.findPost(postID)
+	if err != nil {
+		return models.Post{}, err
+	}
+	updated := post.Clone()
+	record, err := update(&updated)
+	if err != nil {
+		return models.Post{}, err
+	}
+	if err = p.journal.append(record); err != nil {
+		return models.Post{}, err
+	}
+
+	oldScore := post.Score
+	*post = updated
+	if commit != nil {
+		commit()
+	}
+	if post.Score != oldScore {
+		p.sortPosts()
+	}
+	if record.Op != "" {
+		p.modified = time.Now()
+	}
+	return post.Clone(), nil
+}
+
+// snapshot, findPost, sortPosts, purge, dropClashingDeleted and deleted expect
+// the caller to hold the lock.
+func (p *PostRepo) snapshot() []models.Post {
+	postList := make([]models.Post, 0, len(p.storage))
+	for _, post := range p.storage {
+		postList = append(postList, post.Clone())
+	}
+	return postList
+}
+
+func (p *PostRepo) findPost(postID models.ID) (*models.Post, error) {
 	postIdx := slices.IndexFunc(p.storage, func(post *models.Post) bool {
 		return post.ID == postID
 	})
@@ -184,9 +379,156 @@ func (p *PostRepo) getPostByID(postID models.ID) (*models.Post, error) {
 }
 
 func (p *PostRepo) sortPosts() {
-	p.mu.Lock()
-	defer p.mu.Unlock()
 	slices.SortStableFunc(p.storage, func(a, b *models.Post) int {
 		return -cmp.Compare(a.Score, b.Score)
 	})
 }
+
+// purge drops the expired deleted posts and comments, at most once per
+// purgeInterval.
+func (p *PostRepo) purge(now time.Time) {
+	if now.Sub(p.lastPurge) < purgeInterval {
+		return
+	}
+	p.lastPurge = now
+	for id, deleted := range p.deletedPosts {
+		if expired(deleted.deletedAt, now) {
+			delete(p.deletedPosts, id)
+		}
+	}
+	for id, deleted := range p.deletedComments {
+		if expired(deleted.deletedAt, now) {
+			delete(p.deletedComments, id)
+		}
+	}
+}
+
+// dropClashingDeleted forgets the deleted posts and comments whose IDs the
+// stored posts use again.
+func (p *PostRepo) dropClashingDeleted() {
+	for _, post := range p.storage {
+		delete(p.deletedPosts, post.ID)
+		for _, comment := range post.Comments {
+			delete(p.deletedComments, comment.ID)
+		}
+	}
+}
+
+// deleted describes the deleted posts and comments that can still be
+// restored as journal records, which a new segment starts with since the
+// snapshots hold the live posts only.
+func (p *PostRepo) deleted(now time.Time) []journalRecord {
+	records := make([]journalRecord, 0, len(p.deletedPosts)+len(p.deletedComments))
+	for _, deleted := range p.deletedPosts {
+		if deletedAt := deleted.deletedAt; !expired(deletedAt, now) {
+			records = append(records, journalRecord{Op: opDeletedPost, Post: deleted.post, At: &deletedAt})
+		}
+	}
+	for _, deleted := range p.deletedComments {
+		if deletedAt := deleted.deletedAt; !expired(deletedAt, now) {
+			records = append(records, journalRecord{
+				Op:      opDeletedComment,
+				PostID:  deleted.postID,
+				Comment: deleted.comment,
+				At:      &deletedAt,
+			})
+		}
+	}
+	return records
+}
+
+func expired(deletedAt, now time.Time) bool {
+	return now.Sub(deletedAt) > deletedRetention
+}
+
+// apply replays a journaled change before the repo is shared and reports
+// whether the record concerns the posts. Changes of posts that are gone are
+// skipped, the caller sorts the posts once the replay is done.
+func (p *PostRepo) apply(record journalRecord) bool {
+	switch record.Op {
+	case opCreatePost, opRestorePost:
+		delete(p.deletedPosts, record.Post.ID)
+		postIdx := slices.IndexFunc(p.storage, func(post *models.Post) bool {
+			return post.ID == record.Post.ID
+		})
+		if postIdx == -1 {
+			p.storage = append(p.storage, record.Post)
+		} else {
+			p.storage[postIdx] = record.Post
+		}
+	case opDeletePost:
+		if post, err := p.findPost(record.PostID); err == nil {
+			p.deletedPosts[post.ID] = deletedPost{post: post, deletedAt: record.deletedAt()}
+		}
+		p.storage = slices.DeleteFunc(p.storage, func(post *models.Post) bool {
+			return post.ID == record.PostID
+		})
+	case opDeletedPost:
+		p.deletedPosts[record.Post.ID] = deletedPost{post: record.Post, deletedAt: record.deletedAt()}
+	case opAddComment, opRestoreComment:
+		delete(p.deletedComments, record.Comment.ID)
+		post, err := p.findPost(record.PostID)
+		if err != nil {
+			break
+		}
+		if !slices.ContainsFunc(post.Comments, func(comment *models.PostComment) bool {
+			return comment.ID == record.Comment.ID
+		}) {
+			post.RestoreComment(record.Comment)
+		}
+	case opDeleteComment:
+		post, err := p.findPost(record.PostID)
+		if err != nil {
+			break
+		}
+		commentIdx := slices.IndexFunc(post.Comments, func(comment *models.PostComment) bool {
+			return comment.ID == record.CommentID
+		})
+		if commentIdx != -1 {
+			p.deletedComments[record.CommentID] = deletedComment{
+				postID:    post.ID,
+				comment:   post.Comments[commentIdx],
+				deletedAt: record.deletedAt(),
+			}
+			post.DeleteComment(record.CommentID) //nolint:errcheck
+		}
+	case opDeletedComment:
+		p.deletedComments[record.Comment.ID] = deletedComment{
+			postID:    record.PostID,
+			comment:   record.Comment,
+			deletedAt: record.deletedAt(),
+		}
+	case opVote:
+		post, err := p.findPost(record.PostID)
+		if err != nil {
+			break
+		}
+		switch {
+		case record.Vote == 0:
+			post.Unvote(record.UserID) //nolint:errcheck
+		case record.Vote > 0:
+			post.Upvote(record.UserID) //nolint:errcheck
+		default:
+			post.Downvote(record.UserID) //nolint:errcheck
+		}
+	case opReplacePosts:
+		p.storage = make([]*models.Post, 0, len(record.Posts))
+		for i := range record.Posts {
+			p.storage = append(p.storage, &record.Posts[i])
+		}
+		p.dropClashingDeleted()
+	default:
+		return false
+	}
+	return true
+}
+
+// Ping and Close exist so that every backend can be probed and shut down the
+// same way. The in-memory repo holds no resources.
+func (p *PostRepo) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (p *PostRepo) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/pkg/errors"
+	"testing"
+	"time"
+)
+
+func TestPostRepoDeletedRetention(t *testing.T) {
+	repo := NewPostRepo()
+	ctx := context.WithValue(context.Background(), models.Payload, &models.TokenPayload{Login: "alice", ID: "1"})
+	create := func() models.ID {
+		post, err := repo.CreatePost(ctx, models.PostPayload{Type: "text", Title: "Hello", Text: "world", Category: "music"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = repo.DeletePost(ctx, post.ID); err != nil {
+			t.Fatal(err)
+		}
+		return post.ID
+	}
+
+	old := create()
+	expiredPost := repo.deletedPosts[old]
+	expiredPost.deletedAt = time.Now().Add(-deletedRetention - time.Minute)
+	repo.deletedPosts[old] = expiredPost
+	if _, err := repo.RestorePost(ctx, old); !errors.Is(err, models.ErrPostNotFound) {
+		t.Errorf("RestorePost() of an expired post = %v, want %v", err, models.ErrPostNotFound)
+	}
+	if got := len(repo.deleted(time.Now())); got != 0 {
+		t.Errorf("%d deleted records carried, want none for an expired post", got)
+	}
+
+	repo.lastPurge = time.Now().Add(-purgeInterval)
+	recent := create()
+	if _, ok := repo.deletedPosts[old]; ok {
+		t.Error("the expired post was not purged")
+	}
+	if _, err := repo.RestorePost(ctx, recent); err != nil {
+		t.Errorf("RestorePost() of a recent post = %v", err)
+	}
+}
@@ -1,13 +1,18 @@
 package storage
 
 import (
+	"cmp"
+	"context"
 	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
 	"github.com/pkg/errors"
+	"slices"
 	"sync"
 )
 
 type UserRepo struct {
 	storage map[models.Username]*models.User
+	// journal is nil unless the users are persisted
+	journal *Journal
 	mu      *sync.RWMutex
 }
 
@@ -26,7 +31,7 @@ func (repo *UserRepo) Authorize(authData models.AuthUserInfo) (*models.User, err
 	if !ok {
 		return nil, errors.Wrap(models.ErrNoUser, "Authorize: ")
 	}
-	if user.Password != authData.Password {
+	if !user.CheckPassword(authData.Password) {
 		return nil, errors.Wrap(models.ErrBadPass, "Authorize: ")
 	}
 	return user, nil
@@ -48,12 +53,137 @@ func (repo *UserRepo) RegisterUser(authData models.AuthUserInfo) (*models.User,
 }
 
 func (repo *UserRepo) createUser(authData models.AuthUserInfo) (*models.User, error) {
-	repo.mu.Lock()
-	defer repo.mu.Unlock()
+	// Hashing is slow on purpose, so it is done before taking the lock
 	newUser, err := models.NewUser(authData)
 	if err != nil {
 		return nil, err
 	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if _, ok := repo.storage[newUser.Username]; ok {
+		return nil, errors.Wrap(models.ErrUserExists, "Register: ")
+	}
+	if err = repo.journal.append(journalRecord{Op: opRegister, User: newJournalUser(*newUser)}); err != nil {
+		return nil, errors.Wrap(err, "Register: ")
+	}
 	repo.storage[newUser.Username] = newUser
 	return newUser, nil
 }
+
+// GetUser returns a copy of the stored user.
+func (repo *UserRepo) GetUser(login models.Username) (models.User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	user, ok := repo.storage[login]
+	if !ok {
+		return models.User{}, errors.Wrap(models.ErrNoUser, "GetUser: ")
+	}
+	return *user, nil
+}
+
+// GetAllUsers returns copies of the stored users ordered by username.
+func (repo *UserRepo) GetAllUsers() ([]models.User, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+	return repo.list(), nil
+}
+
+func (repo *UserRepo) SetRole(login models.Username, role models.Role) (models.User, error) {
+	return repo.updateUser(login, opSetRole, func(user *models.User) {
+		user.Role = role
+	})
+}
+
+func (repo *UserRepo) SetPassword(login models.Username, password string) (models.User, error) {
+	passwordHash, err := models.HashPassword(password)
+	if err != nil {
+		return models.User{}, errors.Wrap(err, "SetPassword: ")
+	}
+	return repo.updateUser(login, opSetPassword, func(user *models.User) {
+		user.PasswordHash = passwordHash
+	})
+}
+
+// updateUser replaces the stored user with an updated copy: Authorize reads
+// the users it got from the map after releasing the lock.
+func (repo *UserRepo) updateUser(login models.Username, op string, update func(*models.User)) (models.User, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	user, ok := repo.storage[login]
+	if !ok {
+		return models.User{}, errors.Wrap(models.ErrNoUser, "updateUser: ")
+	}
+	updated := *user
+	update(&updated)
+	if err := repo.journal.append(journalRecord{Op: op, User: newJournalUser(updated)}); err != nil {
+		return models.User{}, errors.Wrap(err, "updateUser: ")
+	}
+	repo.storage[login] = &updated
+	return updated, nil
+}
+
+// Replace stores the users returned by replace, which gets the current ones
+// ordered by username. No other change is made in between.
+func (repo *UserRepo) Replace(replace func(current []models.User) ([]models.User, error)) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	next, err := replace(repo.list())
+	if err != nil {
+		return errors.Wrap(err, "Replace: ")
+	}
+
+	users := make([]journalUser, 0, len(next))
+	for _, user := range next {
+		users = append(users, *newJournalUser(user))
+	}
+	if err = repo.journal.append(journalRecord{Op: opReplaceUsers, Users: users}); err != nil {
+		return errors.Wrap(err, "Replace: ")
+	}
+
+	repo.storage = make(map[models.Username]*models.User, len(next))
+	for i := range next {
+		user := next[i]
+		repo.storage[user.Username] = &user
+	}
+	return nil
+}
+
+// list returns copies of the stored users ordered by username, the caller
+// holds the lock.
+func (repo *UserRepo) list() []models.User {
+	userList := make([]models.User, 0, len(repo.storage))
+	for _, user := range repo.storage {
+		userList = append(userList, *user)
+	}
+	slices.SortFunc(userList, func(a, b models.User) int {
+		return cmp.Compare(a.Username, b.Username)
+	})
+	return userList
+}
+
+// apply replays a journaled change before the repo is shared and reports
+// whether the record concerns the users.
+func (repo *UserRepo) apply(record journalRecord) bool {
+	switch record.Op {
+	case opRegister, opSetRole, opSetPassword:
+		user := record.User.user()
+		repo.storage[user.Username] = &user
+	case opReplaceUsers:
+		repo.storage = make(map[models.Username]*models.User, len(record.Users))
+		for _, journaled := range record.Users {
+			user := journaled.user()
+			repo.storage[user.Username] = &user
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+func (repo *UserRepo) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (repo *UserRepo) Close(ctx context.Context) error {
+	return nil
+}
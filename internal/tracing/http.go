@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// Middleware starts a server span for every routed request, continuing the
+// trace of the caller when a traceparent header is present. Like the metrics
+// middleware it has to be installed with mux.Router.Use to see the route.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer().Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer span.End()
+		if postID, ok := mux.Vars(r)["POST_ID"]; ok {
+			span.SetAttributes(attribute.String("post.id", postID))
+		}
+		if payload, ok := ctx.Value(models.Payload).(*models.TokenPayload); ok {
+			span.SetAttributes(attribute.String("user.id", string(payload.ID)))
+		}
+
+		rec := mdwr.NewResponseRecorder(w)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		span.SetAttributes(attribute.Int("http.response.status_code", rec.Status()))
+		if rec.Status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.Status()))
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package tracing
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+type PostRepo interface {
+	service.PostStorage
+	service.PostActions
+}
+
+// Posts wraps any layer exposing the post operations, the service as well as
+// the storage, with a child span per call named after the layer.
+type Posts struct {
+	next  PostRepo
+	layer string
+}
+
+func WrapPosts(layer string, next PostRepo) *Posts {
+	return &Posts{
+		next:  next,
+		layer: layer,
+	}
+}
+
+func (p *Posts) start(ctx context.Context, operation string, attrs ...attribute.KeyValue) (context.Context, func(err error)) {
+	if payload, ok := ctx.Value(models.Payload).(*models.TokenPayload); ok {
+		attrs = append(attrs, attribute.String("user.id", string(payload.ID)))
+	}
+	ctx, span := tracer().Start(ctx, p.layer+"."+operation, trace.WithAttributes(attrs...))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func postID(id models.ID) attribute.KeyValue {
+	return attribute.String("post.id", string(id))
+}
+
+func (p *Posts) GetAllPosts(ctx context.Context) ([]models.Post, error) {
+	ctx, end := p.start(ctx, "GetAllPosts")
+	posts, err := p.next.GetAllPosts(ctx)
+	end(err)
+	return posts, err
+}
+
+func (p *Posts) GetPostsByCategory(ctx context.Context, postCategory models.PostCategory) ([]models.Post, error) {
+	ctx, end := p.start(ctx, "GetPostsByCategory", attribute.String("post.category", postCategory.String()))
+	posts, err := p.next.GetPostsByCategory(ctx, postCategory)
+	end(err)
+	return posts, err
+}
+
+func (p *Posts) GetPostsByUser(ctx context.Context, userLogin models.Username) ([]models.Post, error) {
+	ctx, end := p.start(ctx, "GetPostsByUser", attribute.String("user.login", string(userLogin)))
+	posts, err := p.next.GetPostsByUser(ctx, userLogin)
+	end(err)
+	return posts, err
+}
+
+func (p *Posts) GetPostByID(ctx context.Context, id models.ID) (models.Post, error) {
+	ctx, end := p.start(ctx, "GetPostByID", postID(id))
+	post, err := p.next.GetPostByID(ctx, id)
+	end(err)
+	return post, err
+}
+
+func (p *Posts) CreatePost(ctx context.Context, postPayload models.PostPayload) (models.Post, error) {
+	ctx, end := p.start(ctx, "CreatePost", attribute.String("post.category", postPayload.Category))
+	post, err := p.next.CreatePost(ctx, postPayload)
+	if err == nil {
+		trace.SpanFromContext(ctx).SetAttributes(postID(post.ID))
+	}
+	end(err)
+	return post, err
+}
+
+func (p *Posts) DeletePost(ctx context.Context, id models.ID) error {
+	ctx, end := p.start(ctx, "DeletePost", postID(id))
+	err := p.next.DeletePost(ctx, id)
+	end(err)
+	return err
+}
+
+func (p *Posts) LastModified(ctx context.Context) (time.Time, error) {
+	ctx, end := p.start(ctx, "LastModified")
+	modified, err := p.next.LastModified(ctx)
+	end(err)
+	return modified, err
+}
+
+func (p *Posts) AddComment(ctx context.Context, id models.ID, comment models.Comment) (models.Post, error) {
+	ctx, end := p.start(ctx, "AddComment", postID(id))
+	post, err := p.next.AddComment(ctx, id, comment)
+	end(err)
+	return post, err
+}
+
+func (p *Posts) DeleteComment(ctx context.Context, id, commentID models.ID) (models.Post, error) {
+	ctx, end := p.start(ctx, "DeleteComment", postID(id), attribute.String("comment.id", string(commentID)))
+	post, err := p.next.DeleteComment(ctx, id, commentID)
+	end(err)
+	return post, err
+}
+
+func (p *Posts) Upvote(ctx context.Context, id models.ID) (models.Post, error) {
+	ctx, end := p.start(ctx, "Upvote", postID(id))
+	post, err := p.next.Upvote(ctx, id)
+	end(err)
+	return post, err
+}
+
+func (p *Posts) Downvote(ctx context.Context, id models.ID) (models.Post, error) {
+	ctx, end := p.start(ctx, "Downvote", postID(id))
+	post, err := p.next.Downvote(ctx, id)
+	end(err)
+	return post, err
+}
+
+func (p *Posts) Unvote(ctx context.Context, id models.ID) (models.Post, error) {
+	ctx, end := p.start(ctx, "Unvote", postID(id))
+	post, err := p.next.Unvote(ctx, id)
+	end(err)
+	return post, err
+}
@@ -0,0 +1,106 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"io"
+	"os"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	// ExporterMemory keeps every finished span until the process exits, so it
+	// is meant for tests and is not one of the configurable Exporters.
+	ExporterMemory  = "memory"
+	instrumentation = "github.com/Benzogang-Tape/Reddit-clone"
+)
+
+// Exporters lists the exporters the server can be configured with.
+var Exporters = []string{ExporterNone, ExporterStdout}
+
+type Config struct {
+	Exporter    string
+	Output      string
+	SampleRatio float64
+	ServiceName string
+}
+
+type Provider struct {
+	trace.TracerProvider
+	shutdown func(ctx context.Context) error
+	// Memory holds the finished spans when the memory exporter is selected.
+	Memory *tracetest.InMemoryExporter
+}
+
+// NewProvider builds the tracer provider selected by cfg and installs it, along
+// with the W3C trace context propagator, as the global one.
+func NewProvider(cfg Config) (*Provider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	p := &Provider{
+		shutdown: func(ctx context.Context) error { return nil },
+	}
+	var spans sdktrace.TracerProviderOption
+	closeOutput := func() error { return nil }
+	switch cfg.Exporter {
+	case ExporterNone, "":
+		p.TracerProvider = noop.NewTracerProvider()
+		otel.SetTracerProvider(p.TracerProvider)
+		return p, nil
+	case ExporterStdout:
+		// Only a file opened here is closed on shutdown, never os.Stdout
+		var out io.Writer = os.Stdout
+		if cfg.Output != "" {
+			f, err := os.OpenFile(cfg.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return nil, err
+			}
+			out = f
+			closeOutput = f.Close
+		}
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(out))
+		if err != nil {
+			closeOutput() //nolint:errcheck
+			return nil, err
+		}
+		spans = sdktrace.WithBatcher(stdout)
+	case ExporterMemory:
+		// Spans are exported as they end, for a test to read them right away
+		p.Memory = tracetest.NewInMemoryExporter()
+		spans = sdktrace.WithSyncer(p.Memory)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	sdkProvider := sdktrace.NewTracerProvider(
+		spans,
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+	)
+	p.TracerProvider = sdkProvider
+	p.shutdown = func(ctx context.Context) error {
+		return errors.Join(sdkProvider.Shutdown(ctx), closeOutput())
+	}
+	otel.SetTracerProvider(sdkProvider)
+	return p, nil
+}
+
+// Shutdown flushes the spans that are still buffered.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	return p.shutdown(ctx)
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
@@ -0,0 +1,71 @@
+package gql
+
+import (
+	"strings"
+)
+
+// countAliases returns the number of aliased fields in a query document. Only
+// aliases let a request repeat a field, so bounding them bounds how often a
+// single request can list or write before any resolver runs. Arguments,
+// variable definitions and directives sit in parentheses, where a name
+// followed by a colon is not an alias.
+func countAliases(query string) int {
+	aliases, parens := 0, 0
+	// name tells whether the previous token was a name outside parentheses
+	name := false
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '#':
+			if end := strings.IndexByte(query[i:], '\n'); end != -1 {
+				i += end
+			} else {
+				i = len(query)
+			}
+			continue
+		case strings.HasPrefix(query[i:], `"""`):
+			i += 3
+			for i < len(query) && !strings.HasPrefix(query[i:], `"""`) {
+				if strings.HasPrefix(query[i:], `\"""`) {
+					i++
+				}
+				i++
+			}
+			i += 3
+			name = false
+			continue
+		case c == '"':
+			for i++; i < len(query) && query[i] != '"' && query[i] != '\n'; i++ {
+				if query[i] == '\\' {
+					i++
+				}
+			}
+			i++
+			name = false
+			continue
+		case isNameStart(c):
+			for i++; i < len(query) && (isNameStart(query[i]) || query[i] >= '0' && query[i] <= '9'); i++ {
+			}
+			name = parens == 0
+			continue
+		case c == ':':
+			if name {
+				aliases++
+			}
+		case c == '(':
+			parens++
+		case c == ')':
+			parens = max(parens-1, 0)
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+			continue
+		}
+		name = false
+		i++
+	}
+	return aliases
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,89 @@
+package gql
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// batchFunc fetches the values of many keys at once. Keys missing from the
+// result are reported with the loader's missing error.
+type batchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+type result[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// loader coalesces the loads issued within wait of each other into a single
+// batchFunc call and caches the results, so nested resolvers cost one storage
+// call per level instead of one per parent. Loaders live for one request.
+type loader[K comparable, V any] struct {
+	fetch   batchFunc[K, V]
+	missing error
+	wait    time.Duration
+
+	mu      sync.Mutex
+	cache   map[K]*result[V]
+	pending map[K]*result[V]
+}
+
+func newLoader[K comparable, V any](fetch batchFunc[K, V], missing error, wait time.Duration) *loader[K, V] {
+	return &loader[K, V]{
+		fetch:   fetch,
+		missing: missing,
+		wait:    wait,
+		cache:   make(map[K]*result[V]),
+	}
+}
+
+func (l *loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	res, ok := l.cache[key]
+	if !ok {
+		res = &result[V]{done: make(chan struct{})}
+		l.cache[key] = res
+		if l.pending == nil {
+			l.pending = make(map[K]*result[V])
+			time.AfterFunc(l.wait, func() {
+				l.dispatch(ctx)
+			})
+		}
+		l.pending[key] = res
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-res.done:
+		return res.value, res.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (l *loader[K, V]) dispatch(ctx context.Context) {
+	l.mu.Lock()
+	batch := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	keys := make([]K, 0, len(batch))
+	for key := range batch {
+		keys = append(keys, key)
+	}
+	values, err := l.fetch(ctx, keys)
+	for key, res := range batch {
+		value, found := values[key]
+		switch {
+		case err != nil:
+			res.err = err
+		case !found:
+			res.err = l.missing
+		default:
+			res.value = value
+		}
+		close(res.done)
+	}
+}
@@ -0,0 +1,411 @@
+package gql
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	"github.com/graph-gophers/graphql-go"
+	"unicode/utf8"
+)
+
+type pageArgs struct {
+	First  int32
+	Offset int32
+}
+
+// page applies the pagination arguments and charges the request for the
+// objects it returns, on top of the field that listed them.
+func page[T any](ctx context.Context, items []T, args pageArgs) ([]T, error) {
+	if args.First < 0 || args.Offset < 0 {
+		return nil, models.NewValidationErr(models.ComplexErr{
+			Location: "args",
+			Param:    "first",
+			Value:    args.First,
+			Msg:      "pagination arguments must not be negative",
+		})
+	}
+	first := min(int(args.First), maxFirst)
+	start := min(int(args.Offset), len(items))
+	items = items[start:min(start+first, len(items))]
+	if err := spend(ctx, len(items)); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+type rootResolver struct {
+	executor *Executor
+}
+
+func (r *rootResolver) posts(ctx context.Context, posts []models.Post, args pageArgs) ([]*postResolver, error) {
+	posts, err := page(ctx, posts, args)
+	if err != nil {
+		return nil, r.executor.wrapErr(err)
+	}
+	resolvers := make([]*postResolver, 0, len(posts))
+	for _, post := range posts {
+		resolvers = append(resolvers, &postResolver{root: r, post: post})
+	}
+	return resolvers, nil
+}
+
+func (r *rootResolver) post(post models.Post, err error) (*postResolver, error) {
+	if err != nil {
+		return nil, r.executor.wrapErr(err)
+	}
+	return &postResolver{root: r, post: post}, nil
+}
+
+func (r *rootResolver) Posts(ctx context.Context, args pageArgs) ([]*postResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	posts, err := r.executor.posts.GetAllPosts(ctx)
+	if err != nil {
+		return nil, r.executor.wrapErr(err)
+	}
+	return r.posts(ctx, posts, args)
+}
+
+func (r *rootResolver) Post(ctx context.Context, args struct{ ID graphql.ID }) (*postResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	postID, err := parseID(args.ID, models.ErrInvalidPostID)
+	if err != nil {
+		return nil, r.executor.wrapErr(err)
+	}
+	return r.post(r.executor.posts.GetPostByID(ctx, postID))
+}
+
+func (r *rootResolver) Categories(ctx context.Context) ([]*categoryResolver, error) {
+	if err := spend(ctx, 1+models.CategoryCount); err != nil {
+		return nil, err
+	}
+	resolvers := make([]*categoryResolver, 0, models.CategoryCount)
+	for c := 0; c < models.CategoryCount; c++ {
+		resolvers = append(resolvers, &categoryResolver{root: r, category: models.PostCategory(c)})
+	}
+	return resolvers, nil
+}
+
+func (r *rootResolver) Category(ctx context.Context, args struct{ Name string }) (*categoryResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	category, err := models.StringToPostCategory(args.Name)
+	if err != nil {
+		return nil, nil
+	}
+	return &categoryResolver{root: r, category: category}, nil
+}
+
+func (r *rootResolver) User(ctx context.Context, args struct{ Username string }) (*userResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	return &userResolver{root: r, user: models.TokenPayload{Login: models.Username(args.Username)}}, nil
+}
+
+type createPostInput struct {
+	Type     string
+	Title    string
+	URL      *string
+	Text     *string
+	Category string
+}
+
+func (r *rootResolver) CreatePost(ctx context.Context, args struct{ Input createPostInput }) (*postResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	payload := models.PostPayload{
+		Title:    args.Input.Title,
+		Type:     models.WithText.String(),
+		Category: args.Input.Category,
+	}
+	if args.Input.Type == "LINK" {
+		payload.Type = models.WithLink.String()
+	}
+	if args.Input.URL != nil {
+		payload.URL = *args.Input.URL
+	}
+	if args.Input.Text != nil {
+		payload.Text = *args.Input.Text
+	}
+	return r.post(r.executor.posts.CreatePost(ctx, payload))
+}
+
+func (r *rootResolver) DeletePost(ctx context.Context, args struct{ ID graphql.ID }) (bool, error) {
+	if err := spend(ctx, 1); err != nil {
+		return false, err
+	}
+	postID, err := parseID(args.ID, models.ErrInvalidPostID)
+	if err == nil {
+		err = r.executor.posts.DeletePost(ctx, postID)
+	}
+	if err != nil {
+		return false, r.executor.wrapErr(err)
+	}
+	return true, nil
+}
+
+func (r *rootResolver) Vote(ctx context.Context, args struct {
+	PostID    graphql.ID
+	Direction string
+}) (*postResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	postID, err := parseID(args.PostID, models.ErrInvalidPostID)
+	if err != nil {
+		return nil, r.executor.wrapErr(err)
+	}
+	switch args.Direction {
+	case "UP":
+		return r.post(r.executor.posts.Upvote(ctx, postID))
+	case "DOWN":
+		return r.post(r.executor.posts.Downvote(ctx, postID))
+	default:
+		return r.post(r.executor.posts.Unvote(ctx, postID))
+	}
+}
+
+func (r *rootResolver) AddComment(ctx context.Context, args struct {
+	PostID graphql.ID
+	Body   string
+}) (*postResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	postID, err := parseID(args.PostID, models.ErrInvalidPostID)
+	if err != nil {
+		return nil, r.executor.wrapErr(err)
+	}
+	return r.post(r.executor.posts.AddComment(ctx, postID, models.Comment{Body: args.Body}))
+}
+
+func (r *rootResolver) DeleteComment(ctx context.Context, args struct {
+	PostID    graphql.ID
+	CommentID graphql.ID
+}) (*postResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	postID, err := parseID(args.PostID, models.ErrInvalidPostID)
+	if err != nil {
+		return nil, r.executor.wrapErr(err)
+	}
+	commentID, err := parseID(args.CommentID, models.ErrInvalidCommentID)
+	if err != nil {
+		return nil, r.executor.wrapErr(err)
+	}
+	return r.post(r.executor.posts.DeleteComment(ctx, postID, commentID))
+}
+
+type postResolver struct {
+	root *rootResolver
+	post models.Post
+}
+
+func (r *postResolver) ID() graphql.ID {
+	return graphql.ID(r.post.ID)
+}
+
+func (r *postResolver) Type() string {
+	if r.post.Type == models.WithLink {
+		return "LINK"
+	}
+	return "TEXT"
+}
+
+func (r *postResolver) Title() string {
+	return r.post.Title
+}
+
+func (r *postResolver) URL() *string {
+	if r.post.Type != models.WithLink {
+		return nil
+	}
+	return &r.post.URL
+}
+
+func (r *postResolver) Text() *string {
+	if r.post.Type != models.WithText {
+		return nil
+	}
+	return &r.post.Text
+}
+
+func (r *postResolver) Category() *categoryResolver {
+	return &categoryResolver{root: r.root, category: r.post.Category}
+}
+
+func (r *postResolver) Author() *userResolver {
+	return &userResolver{root: r.root, user: r.post.Author}
+}
+
+func (r *postResolver) Score() int32 {
+	return int32(r.post.Score)
+}
+
+func (r *postResolver) Views() int32 {
+	return int32(r.post.Views)
+}
+
+func (r *postResolver) UpvotePercentage() int32 {
+	return int32(r.post.UpvotePercentage)
+}
+
+func (r *postResolver) Created() string {
+	return r.post.Created
+}
+
+func (r *postResolver) VoteCount() int32 {
+	return int32(len(r.post.Votes))
+}
+
+func (r *postResolver) Upvotes() int32 {
+	upvotes, _ := r.post.Tally()
+	return int32(upvotes)
+}
+
+func (r *postResolver) Downvotes() int32 {
+	_, downvotes := r.post.Tally()
+	return int32(downvotes)
+}
+
+func (r *postResolver) ViewerVote(ctx context.Context) int32 {
+	return int32(r.post.VoteOf(service.ViewerID(ctx)))
+}
+
+func (r *postResolver) Votes(ctx context.Context, args pageArgs) ([]*voteResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	votes, err := page(ctx, service.NewPublicPost(ctx, r.post).Votes, args)
+	if err != nil {
+		return nil, r.root.executor.wrapErr(err)
+	}
+	resolvers := make([]*voteResolver, 0, len(votes))
+	for _, vote := range votes {
+		resolvers = append(resolvers, &voteResolver{vote: *vote})
+	}
+	return resolvers, nil
+}
+
+func (r *postResolver) CommentCount() int32 {
+	return int32(len(r.post.Comments))
+}
+
+func (r *postResolver) Comments(ctx context.Context, args pageArgs) ([]*commentResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	comments, err := page(ctx, r.post.Comments, args)
+	if err != nil {
+		return nil, r.root.executor.wrapErr(err)
+	}
+	resolvers := make([]*commentResolver, 0, len(comments))
+	for _, comment := range comments {
+		resolvers = append(resolvers, &commentResolver{root: r.root, postID: r.post.ID, comment: *comment})
+	}
+	return resolvers, nil
+}
+
+type commentResolver struct {
+	root    *rootResolver
+	postID  models.ID
+	comment models.PostComment
+}
+
+func (r *commentResolver) ID() graphql.ID {
+	return graphql.ID(r.comment.ID)
+}
+
+func (r *commentResolver) Author() *userResolver {
+	return &userResolver{root: r.root, user: r.comment.Author}
+}
+
+func (r *commentResolver) Body() string {
+	return r.comment.Body
+}
+
+func (r *commentResolver) Created() string {
+	return r.comment.Created
+}
+
+func (r *commentResolver) Post(ctx context.Context) (*postResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	return r.root.post(state(ctx).loaders.postByID.Load(ctx, r.postID))
+}
+
+type userResolver struct {
+	root *rootResolver
+	user models.TokenPayload
+}
+
+// ID is only known when the user is reached through a post or a comment.
+func (r *userResolver) ID() *graphql.ID {
+	if r.user.ID == "" {
+		return nil
+	}
+	id := graphql.ID(r.user.ID)
+	return &id
+}
+
+func (r *userResolver) Username() string {
+	return string(r.user.Login)
+}
+
+func (r *userResolver) Posts(ctx context.Context, args pageArgs) ([]*postResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	posts, err := state(ctx).loaders.postsByAuthor.Load(ctx, r.user.Login)
+	if err != nil {
+		return nil, r.root.executor.wrapErr(err)
+	}
+	return r.root.posts(ctx, posts, args)
+}
+
+type categoryResolver struct {
+	root     *rootResolver
+	category models.PostCategory
+}
+
+func (r *categoryResolver) Name() string {
+	return r.category.String()
+}
+
+func (r *categoryResolver) Posts(ctx context.Context, args pageArgs) ([]*postResolver, error) {
+	if err := spend(ctx, 1); err != nil {
+		return nil, err
+	}
+	posts, err := state(ctx).loaders.postsByCategory.Load(ctx, r.category)
+	if err != nil {
+		return nil, r.root.executor.wrapErr(err)
+	}
+	return r.root.posts(ctx, posts, args)
+}
+
+type voteResolver struct {
+	vote models.PostVote
+}
+
+func (r *voteResolver) UserID() graphql.ID {
+	return graphql.ID(r.vote.UserID)
+}
+
+func (r *voteResolver) Vote() int32 {
+	return int32(r.vote.Vote)
+}
+
+func parseID(id graphql.ID, errInvalid error) (models.ID, error) {
+	if utf8.RuneCountInString(string(id)) != models.UUIDLength {
+		return "", errInvalid
+	}
+	return models.ID(id), nil
+}
@@ -0,0 +1,191 @@
+package gql
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/transport/rest"
+	"github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"sync/atomic"
+	"time"
+)
+
+//go:embed schema.graphql
+var schemaSource string
+
+const (
+	batchWait = time.Millisecond
+	maxFirst  = 100
+)
+
+var ErrTooComplex = errors.New("query complexity limit exceeded")
+
+type PostAPI interface {
+	service.PostStorage
+	service.PostActions
+}
+
+type Options struct {
+	// MaxDepth bounds the nesting of selections
+	MaxDepth int
+	// MaxComplexity bounds the number of objects a single request may resolve
+	MaxComplexity int64
+	// MaxAliases bounds the aliased fields of a query, checked before it runs
+	MaxAliases int
+}
+
+// Executor runs GraphQL requests against the post service.
+type Executor struct {
+	schema  *graphql.Schema
+	posts   PostAPI
+	errs    *rest.ErrorRegistry
+	options Options
+}
+
+func NewExecutor(posts PostAPI, errs *rest.ErrorRegistry, options Options) (*Executor, error) {
+	e := &Executor{
+		posts:   posts,
+		errs:    errs,
+		options: options,
+	}
+	schema, err := graphql.ParseSchema(schemaSource, &rootResolver{executor: e},
+		graphql.UseStringDescriptions(),
+		graphql.MaxDepth(options.MaxDepth),
+	)
+	if err != nil {
+		return nil, err
+	}
+	e.schema = schema
+	return e, nil
+}
+
+func (e *Executor) Execute(ctx context.Context, query, operationName string, variables map[string]interface{}) interface{} {
+	if e.options.MaxAliases > 0 && countAliases(query) > e.options.MaxAliases {
+		return &graphql.Response{Errors: []*gqlerrors.QueryError{{Message: ErrTooComplex.Error()}}}
+	}
+	ctx = context.WithValue(ctx, requestKey, &requestState{
+		loaders: e.newLoaders(),
+		budget:  e.options.MaxComplexity,
+	})
+	return e.schema.Exec(ctx, query, operationName, variables)
+}
+
+type ctxKey string
+
+const requestKey = ctxKey("graphql_request")
+
+// requestState is shared by the resolvers of one request.
+type requestState struct {
+	loaders *loaders
+	budget  int64
+	spent   atomic.Int64
+}
+
+func state(ctx context.Context) *requestState {
+	return ctx.Value(requestKey).(*requestState)
+}
+
+// spend charges the request for n resolved objects. The whole request is
+// charged, not just one branch, so wide and deep queries are cut off alike.
+// Every field that resolves objects, mutations included, spends before it
+// reaches the storage, so even empty results cost something.
+func spend(ctx context.Context, n int) error {
+	st := state(ctx)
+	if st.budget > 0 && st.spent.Add(int64(n)) > st.budget {
+		return ErrTooComplex
+	}
+	return nil
+}
+
+type loaders struct {
+	postByID        *loader[models.ID, models.Post]
+	postsByAuthor   *loader[models.Username, []models.Post]
+	postsByCategory *loader[models.PostCategory, []models.Post]
+}
+
+// Every batch is served by a single listing: the in-memory storage has no
+// multi-key lookups and GetPostByID would count a view per parent.
+func (e *Executor) newLoaders() *loaders {
+	return &loaders{
+		postByID: newLoader(func(ctx context.Context, ids []models.ID) (map[models.ID]models.Post, error) {
+			posts, err := e.posts.GetAllPosts(ctx)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[models.ID]models.Post, len(ids))
+			for _, post := range posts {
+				byID[post.ID] = post
+			}
+			return byID, nil
+		}, models.ErrPostNotFound, batchWait),
+		postsByAuthor: newLoader(func(ctx context.Context, logins []models.Username) (map[models.Username][]models.Post, error) {
+			posts, err := e.posts.GetAllPosts(ctx)
+			if err != nil {
+				return nil, err
+			}
+			byAuthor := make(map[models.Username][]models.Post, len(logins))
+			for _, login := range logins {
+				byAuthor[login] = nil
+			}
+			for _, post := range posts {
+				if _, ok := byAuthor[post.Author.Login]; ok {
+					byAuthor[post.Author.Login] = append(byAuthor[post.Author.Login], post)
+				}
+			}
+			return byAuthor, nil
+		}, nil, batchWait),
+		postsByCategory: newLoader(func(ctx context.Context, categories []models.PostCategory) (map[models.PostCategory][]models.Post, error) {
+			posts, err := e.posts.GetAllPosts(ctx)
+			if err != nil {
+				return nil, err
+			}
+			byCategory := make(map[models.PostCategory][]models.Post, len(categories))
+			for _, category := range categories {
+				byCategory[category] = nil
+			}
+			for _, post := range posts {
+				if _, ok := byCategory[post.Category]; ok {
+					byCategory[post.Category] = append(byCategory[post.Category], post)
+				}
+			}
+			return byCategory, nil
+		}, nil, batchWait),
+	}
+}
+
+// resolverErr exposes the REST error type of a domain error to clients in
+// the extensions of the GraphQL error.
+type resolverErr struct {
+	err     error
+	mapping rest.ErrorMapping
+}
+
+func (e *resolverErr) Error() string {
+	return e.mapping.Message
+}
+
+func (e *resolverErr) Unwrap() error {
+	return e.err
+}
+
+func (e *resolverErr) Extensions() map[string]interface{} {
+	ext := map[string]interface{}{
+		"code":   e.mapping.Type,
+		"status": e.mapping.StatusCode,
+	}
+	var vErr *models.ValidationErr
+	if errors.As(e.err, &vErr) {
+		ext["errors"] = vErr.ComplexErrArr().Errs
+	}
+	return ext
+}
+
+func (e *Executor) wrapErr(err error) error {
+	if err == nil || errors.Is(err, ErrTooComplex) {
+		return err
+	}
+	return &resolverErr{err: err, mapping: e.errs.Lookup(err)}
+}
@@ -0,0 +1,109 @@
+package gql
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/storage"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/transport/rest"
+	"github.com/graph-gophers/graphql-go"
+	"strings"
+	"testing"
+)
+
+func TestCountAliases(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{name: "no aliases", query: `{ posts(first: 0, offset: 1) { id title } }`, want: 0},
+		{name: "aliased root fields", query: `{ a: posts(first: 0) { id } b: posts(first: 0) { id } }`, want: 2},
+		{name: "aliases without spaces", query: `{a1:posts{id}a2:posts{id}}`, want: 2},
+		{name: "nested alias", query: `{ posts { key: id comments { body } } }`, want: 1},
+		{name: "input objects", query: `mutation { createPost(input: {type: TEXT, title: "a: b", category: "music"}) { id } }`, want: 0},
+		{
+			name:  "variables, directives and defaults",
+			query: `query Q($first: Int = 2, $skip: Boolean!) { posts(first: $first) @skip(if: $skip) { id } }`,
+			want:  0,
+		},
+		{name: "strings and comments", query: "{ posts(first: 1) { id } # a: b\n x: post(id: \"\\\"y: z\") { id } }", want: 1},
+		{name: "block string", query: `{ post(id: """ a: b """) { id } c: categories { name } }`, want: 1},
+		{name: "fragment", query: `{ ...F } fragment F on Query { a: posts { id } }`, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countAliases(tt.query); got != tt.want {
+				t.Errorf("countAliases() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func aliased(n int, field string) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		b.WriteString(" a")
+		b.WriteByte(byte('a' + i))
+		b.WriteString(": ")
+		b.WriteString(field)
+	}
+	return b.String()
+}
+
+func TestExecuteCost(t *testing.T) {
+	createPost := `createPost(input: {type: TEXT, title: "Hello", text: "world", category: "music"}) { id }`
+	tests := []struct {
+		name      string
+		query     string
+		options   Options
+		wantErr   bool
+		wantPosts int
+	}{
+		{
+			name:    "within the limits",
+			query:   "{" + aliased(3, "posts(first: 0) { id }") + " }",
+			options: Options{MaxDepth: 8, MaxComplexity: 3, MaxAliases: 3},
+		},
+		{
+			name:    "empty pages still cost",
+			query:   "{" + aliased(4, "posts(first: 0) { id }") + " }",
+			options: Options{MaxDepth: 8, MaxComplexity: 3, MaxAliases: 10},
+			wantErr: true,
+		},
+		{
+			name:      "mutations cost",
+			query:     "mutation {" + aliased(4, createPost) + " }",
+			options:   Options{MaxDepth: 8, MaxComplexity: 2, MaxAliases: 10},
+			wantErr:   true,
+			wantPosts: 2,
+		},
+		{
+			name:    "too many aliases",
+			query:   "mutation {" + aliased(4, createPost) + " }",
+			options: Options{MaxDepth: 8, MaxComplexity: 100, MaxAliases: 3},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts := storage.NewPostRepo()
+			executor, err := NewExecutor(service.NewPostHandler(posts, posts), rest.DefaultErrorRegistry(), tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.WithValue(context.Background(), models.Payload, &models.TokenPayload{Login: "alice", ID: "1"})
+			resp := executor.Execute(ctx, tt.query, "", nil).(*graphql.Response)
+			if gotErr := len(resp.Errors) > 0; gotErr != tt.wantErr {
+				t.Errorf("Execute() errors = %v, want errors %t", resp.Errors, tt.wantErr)
+			}
+			stored, err := posts.GetAllPosts(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(stored) != tt.wantPosts {
+				t.Errorf("%d posts stored, want %d", len(stored), tt.wantPosts)
+			}
+		})
+	}
+}
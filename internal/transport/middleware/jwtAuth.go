@@ -3,6 +3,8 @@ package middleware
 import (
 	"context"
 	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
+	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"net/http"
 	"regexp"
@@ -13,19 +15,35 @@ import (
 type HTTPMethods []string
 type Endpoints map[*regexp.Regexp]HTTPMethods
 
+var errMissingToken = errors.New("missing bearer token")
+
 var (
 	authUrls = Endpoints{
-		regexp.MustCompile(`^/api/posts$`):                            {http.MethodPost},   // 4
-		regexp.MustCompile(`^/api/post/[0-9a-fA-F-]+$`):               {http.MethodPost},   // 7
-		regexp.MustCompile(`^/api/post/[0-9a-fA-F-]+/[0-9a-fA-F-]+$`): {http.MethodDelete}, // 8
-		regexp.MustCompile(`^/api/post/[0-9a-fA-F-]+/upvote$`):        {http.MethodGet},    // 9
-		regexp.MustCompile(`^/api/post/[0-9a-fA-F-]+/downvote$`):      {http.MethodGet},    // 10
-		regexp.MustCompile(`^/api/post/[0-9a-fA-F-]+/unvote$`):        {http.MethodGet},    // 11
-		regexp.MustCompile(`^/api/post/[0-9a-fA-F-]+$`):               {http.MethodDelete}, // 12
+		regexp.MustCompile(`^/api/posts$`):                            {http.MethodPost},                 // 4
+		regexp.MustCompile(`^/api/post/[0-9a-fA-F-]+$`):               {http.MethodPost},                 // 7
+		regexp.MustCompile(`^/api/post/[0-9a-fA-F-]+/[0-9a-fA-F-]+$`): {http.MethodDelete},               // 8
+		regexp.MustCompile(`^/api/post/[0-9a-fA-F-]+/upvote$`):        {http.MethodGet, http.MethodPost}, // 9
+		regexp.MustCompile(`^/api/post/[0-9a-fA-F-]+/downvote$`):      {http.MethodGet, http.MethodPost}, // 10
+		regexp.MustCompile(`^/api/post/[0-9a-fA-F-]+/unvote$`):        {http.MethodGet, http.MethodPost}, // 11
+		regexp.MustCompile(`^/api/post/[0-9a-fA-F-]+$`):               {http.MethodDelete},               // 12
+		regexp.MustCompile(`^/api/admin/`):                            {http.MethodGet, http.MethodPost, http.MethodDelete},
+	}
+	// Endpoints serving anonymous and authenticated callers alike, the token
+	// is only checked when one is sent
+	optionalAuthUrls = Endpoints{
+		regexp.MustCompile(`^/graphql$`): {http.MethodPost},
+		regexp.MustCompile(`^/api/`):     {http.MethodGet},
 	}
 )
 
-func Auth(next http.Handler, logger *zap.SugaredLogger) http.Handler {
+// ErrorWriter writes an error response the way the API handlers do.
+type ErrorWriter interface {
+	WriteError(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Auth requires a valid bearer token on authUrls and answers 401 without one.
+// Whether the caller may use an endpoint is up to its handler.
+func Auth(next http.Handler, errs ErrorWriter, logger *zap.SugaredLogger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var canBeWithoutAuth = true
 		for endpoint, methods := range authUrls {
@@ -35,22 +53,54 @@ func Auth(next http.Handler, logger *zap.SugaredLogger) http.Handler {
 			}
 		}
 		if canBeWithoutAuth {
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, optionalAuth(r, logger))
 			return
 		}
 
-		authToken := models.Session{}
-		authToken.InitWithToken(strings.Split(r.Header.Get("Authorization"), " ")[1])
-		payload, err := authToken.ValidateToken()
+		var payload *models.TokenPayload
+		err := errMissingToken
+		if token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); found {
+			authToken := models.Session{}
+			authToken.InitWithToken(token)
+			payload, err = authToken.ValidateToken()
+		}
 		if err != nil {
-			logger.Warnw("Authorization failed",
+			mdwr.Logger(r.Context(), logger).Warnw("Authorization failed",
 				"reason", err.Error(),
 				"remote_addr", r.RemoteAddr,
 				"url", r.URL.Path,
 			)
-			http.Redirect(w, r, "/api/posts/", http.StatusFound)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			errs.WriteError(w, r, models.ErrBadToken)
 			return
 		}
+		mdwr.AnnotateLog(r.Context(), "user_id", payload.ID, "user_login", payload.Login)
 		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), models.Payload, payload)))
 	})
 }
+
+func optionalAuth(r *http.Request, logger *zap.SugaredLogger) *http.Request {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found {
+		return r
+	}
+	for endpoint, methods := range optionalAuthUrls {
+		if !endpoint.MatchString(r.URL.Path) || !slices.Contains(methods, r.Method) {
+			continue
+		}
+		authToken := models.Session{}
+		authToken.InitWithToken(token)
+		payload, err := authToken.ValidateToken()
+		if err != nil {
+			mdwr.Logger(r.Context(), logger).Warnw("Authorization failed, continuing anonymously",
+				"reason", err.Error(),
+				"remote_addr", r.RemoteAddr,
+				"url", r.URL.Path,
+			)
+			return r
+		}
+		mdwr.AnnotateLog(r.Context(), "user_id", payload.ID, "user_login", payload.Login)
+		return r.WithContext(context.WithValue(r.Context(), models.Payload, payload))
+	}
+	return r
+}
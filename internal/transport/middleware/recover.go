@@ -3,6 +3,7 @@ package middleware
 import (
 	"fmt"
 	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
 	"go.uber.org/zap"
 	"net/http"
 )
@@ -11,8 +12,8 @@ func Panic(next http.Handler, logger *zap.SugaredLogger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				fmt.Println("recovered", err)
-				logger.Errorw("panicMiddleware",
+				mdwr.Logger(r.Context(), logger).Errorw("panicMiddleware",
+					"panic", fmt.Sprint(err),
 					"method", r.Method,
 					"remote_addr", r.RemoteAddr,
 					"url", r.URL.Path,
@@ -0,0 +1,397 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/backup"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// maxImportBytes bounds the imports, which are far larger than the other
+// request bodies and are only accepted from the administrators.
+const maxImportBytes int64 = 1 << 30
+
+type AdminAPI interface {
+	IsAdmin(login models.Username) (bool, error)
+	Users() ([]service.UserInfo, error)
+	CreateUser(authData models.AuthUserInfo, role models.Role) (service.UserInfo, error)
+	SetRole(login models.Username, role models.Role) (service.UserInfo, error)
+	ResetPassword(login models.Username, password string) (service.UserInfo, error)
+	TopPosts(ctx context.Context, limit int) ([]models.Post, error)
+	TopPostsByCategory(ctx context.Context, postCategory models.PostCategory, limit int) ([]models.Post, error)
+	Post(ctx context.Context, postID models.ID) (models.Post, error)
+	DeletePost(ctx context.Context, postID models.ID) error
+	RestorePost(ctx context.Context, postID models.ID) (models.Post, error)
+	DeleteComment(ctx context.Context, postID, commentID models.ID) (models.Post, error)
+	RestoreComment(ctx context.Context, postID, commentID models.ID) (models.Post, error)
+	Export(ctx context.Context) (*backup.Snapshot, error)
+	Import(ctx context.Context, r io.Reader, opts backup.Options) (backup.Report, error)
+}
+
+// AdminHandler serves /api/admin to the administrators. Posts are returned as
+// the anonymous v2 details, and reading them does not count a view.
+type AdminHandler struct {
+	logger  *zap.SugaredLogger
+	service AdminAPI
+	decoder *RequestDecoder
+}
+
+func NewAdminHandler(a AdminAPI, decoder *RequestDecoder, logger *zap.SugaredLogger) *AdminHandler {
+	return &AdminHandler{
+		logger:  logger,
+		service: a,
+		decoder: decoder,
+	}
+}
+
+// Middleware lets the administrators through, the caller is already
+// authenticated by middleware.Auth.
+func (a *AdminHandler) Middleware(api *Responder) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			payload, ok := r.Context().Value(models.Payload).(*models.TokenPayload)
+			if !ok {
+				api.WriteError(w, r, models.ErrBadToken)
+				return
+			}
+			isAdmin, err := a.service.IsAdmin(payload.Login)
+			if err == nil && !isAdmin {
+				mdwr.Logger(r.Context(), a.logger).Warnw("Admin access denied",
+					"login", payload.Login,
+					"remote_addr", r.RemoteAddr,
+					"url", r.URL.Path,
+				)
+				err = models.ErrForbidden
+			}
+			if err != nil {
+				api.WriteError(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (a *AdminHandler) GetUsers(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	return a.service.Users()
+}
+
+func (a *AdminHandler) CreateUser(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	payload := struct {
+		models.AuthUserInfo
+		Role string `json:"role"`
+	}{}
+	if err := a.decoder.Decode(w, r, &payload); err != nil {
+		return nil, err
+	}
+	role, err := roleParam(payload.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.service.CreateUser(payload.AuthUserInfo, role)
+	if errors.Is(err, models.ErrUserExists) {
+		return nil, models.NewValidationErr(models.ComplexErr{
+			Location: `body`,
+			Param:    `username`,
+			Value:    payload.Login,
+			Msg:      `already exists`,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.audit(r, "User created", "login", user.Username, "role", user.Role)
+	return user, nil
+}
+
+func (a *AdminHandler) SetRole(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	payload := struct {
+		Role string `json:"role"`
+	}{}
+	if err := a.decoder.Decode(w, r, &payload); err != nil {
+		return nil, err
+	}
+	role, err := roleParam(payload.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := a.service.SetRole(models.Username(mux.Vars(r)["USER_LOGIN"]), role)
+	if err != nil {
+		return nil, err
+	}
+	a.audit(r, "User role changed", "login", user.Username, "role", user.Role)
+	return user, nil
+}
+
+func (a *AdminHandler) ResetPassword(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	payload := struct {
+		Password string `json:"password"`
+	}{}
+	if err := a.decoder.Decode(w, r, &payload); err != nil {
+		return nil, err
+	}
+
+	user, err := a.service.ResetPassword(models.Username(mux.Vars(r)["USER_LOGIN"]), payload.Password)
+	if err != nil {
+		return nil, err
+	}
+	a.audit(r, "User password reset", "login", user.Username)
+	return user, nil
+}
+
+// GetTopPosts lists the most popular posts, optionally of a single category.
+func (a *AdminHandler) GetTopPosts(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	limit := 0
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return nil, models.NewValidationErr(models.ComplexErr{
+				Location: `query`,
+				Param:    `limit`,
+				Value:    raw,
+				Msg:      `must be a positive integer`,
+			})
+		}
+		limit = n
+	}
+
+	var (
+		posts        []models.Post
+		postCategory models.PostCategory
+		err          error
+	)
+	if raw := query.Get("category"); raw != "" {
+		if postCategory, err = models.StringToPostCategory(raw); err != nil {
+			return nil, err
+		}
+		posts, err = a.service.TopPostsByCategory(r.Context(), postCategory, limit)
+	} else {
+		posts, err = a.service.TopPosts(r.Context(), limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return models.NewPostSummaries(posts, ""), nil
+}
+
+func (a *AdminHandler) GetPost(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	postID, err := pathID(r, "POST_ID", models.ErrInvalidPostID)
+	if err != nil {
+		return nil, err
+	}
+	return adminPost(a.service.Post(r.Context(), postID))
+}
+
+func (a *AdminHandler) DeletePost(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	postID, err := pathID(r, "POST_ID", models.ErrInvalidPostID)
+	if err != nil {
+		return nil, err
+	}
+	if err = a.service.DeletePost(r.Context(), postID); err != nil {
+		return nil, err
+	}
+	a.audit(r, "Post deleted", "post_id", postID)
+	return models.NewSimpleErr("success"), nil
+}
+
+func (a *AdminHandler) RestorePost(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	postID, err := pathID(r, "POST_ID", models.ErrInvalidPostID)
+	if err != nil {
+		return nil, err
+	}
+	post, err := a.service.RestorePost(r.Context(), postID)
+	if err != nil {
+		return nil, err
+	}
+	a.audit(r, "Post restored", "post_id", postID)
+	return models.NewPostDetails(post, ""), nil
+}
+
+func (a *AdminHandler) DeleteComment(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	postID, commentID, err := commentPath(r)
+	if err != nil {
+		return nil, err
+	}
+	post, err := a.service.DeleteComment(r.Context(), postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	a.audit(r, "Comment deleted", "post_id", postID, "comment_id", commentID)
+	return models.NewPostDetails(post, ""), nil
+}
+
+func (a *AdminHandler) RestoreComment(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	postID, commentID, err := commentPath(r)
+	if err != nil {
+		return nil, err
+	}
+	post, err := a.service.RestoreComment(r.Context(), postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	a.audit(r, "Comment restored", "post_id", postID, "comment_id", commentID)
+	return models.NewPostDetails(post, ""), nil
+}
+
+// Export streams a copy of the users, passwords included, and of the posts.
+func (a *AdminHandler) Export(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	snapshot, err := a.service.Export(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="reddit-clone-%s.jsonl"`, snapshot.Created.Format("20060102T150405Z")))
+	counts := snapshot.Counts()
+	a.audit(r, "Data exported", "users", counts.Users, "posts", counts.Posts)
+	return snapshot, nil
+}
+
+// Import loads an export. Conflicts that stop a merge are answered with 409
+// and the same report, so that they can be reviewed before retrying.
+func (a *AdminHandler) Import(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != backup.ContentType {
+		return nil, &decodeErr{
+			statusCode: http.StatusUnsupportedMediaType,
+			msg:        "Content-Type must be " + backup.ContentType,
+			cause:      models.ErrUnknownPayload,
+		}
+	}
+	opts, err := importOptions(r)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := a.service.Import(r.Context(), http.MaxBytesReader(w, r.Body, maxImportBytes), opts)
+	var (
+		formatErr   *backup.FormatError
+		maxBytesErr *http.MaxBytesError
+	)
+	switch {
+	case errors.As(err, &formatErr):
+		return nil, &decodeErr{
+			statusCode: http.StatusUnprocessableEntity,
+			msg:        formatErr.Error(),
+			cause:      err,
+		}
+	case errors.As(err, &maxBytesErr):
+		return nil, &decodeErr{
+			statusCode: http.StatusRequestEntityTooLarge,
+			msg:        fmt.Sprintf("request body must not be larger than %d bytes", maxBytesErr.Limit),
+			cause:      models.ErrBodyTooLarge,
+		}
+	case errors.Is(err, models.ErrImportConflict) && !report.Applied:
+		return importResult{Report: report, statusCode: http.StatusConflict}, nil
+	case err != nil:
+		return nil, err
+	}
+	if report.Applied {
+		a.audit(r, "Data imported",
+			"mode", report.Mode,
+			"on_conflict", report.OnConflict,
+			"users_added", report.Users.Added,
+			"users_removed", report.Users.Removed,
+			"posts_added", report.Posts.Added,
+			"posts_removed", report.Posts.Removed,
+			"conflicts", len(report.Conflicts),
+		)
+	}
+	return importResult{Report: report, statusCode: http.StatusOK}, nil
+}
+
+type importResult struct {
+	backup.Report
+	statusCode int
+}
+
+func (res importResult) StatusCode() int {
+	return res.statusCode
+}
+
+// audit logs a change made by an administrator.
+func (a *AdminHandler) audit(r *http.Request, msg string, keysAndValues ...interface{}) {
+	if payload, ok := r.Context().Value(models.Payload).(*models.TokenPayload); ok {
+		keysAndValues = append(keysAndValues, "admin", payload.Login)
+	}
+	mdwr.Logger(r.Context(), a.logger).Infow(msg, keysAndValues...)
+}
+
+func adminPost(post models.Post, err error) (interface{}, error) {
+	if err != nil {
+		return nil, err
+	}
+	return models.NewPostDetails(post, ""), nil
+}
+
+func roleParam(raw string) (models.Role, error) {
+	if raw == "" {
+		return models.RoleUser, nil
+	}
+	role, err := models.StringToRole(raw)
+	if err != nil {
+		return "", models.NewValidationErr(models.ComplexErr{
+			Location: `body`,
+			Param:    `role`,
+			Value:    raw,
+			Msg:      `must be user or admin`,
+		})
+	}
+	return role, nil
+}
+
+func importOptions(r *http.Request) (backup.Options, error) {
+	query := r.URL.Query()
+	mode, err := backup.StringToMode(query.Get("mode"))
+	if err != nil {
+		return backup.Options{}, models.NewValidationErr(models.ComplexErr{
+			Location: `query`,
+			Param:    `mode`,
+			Value:    query.Get("mode"),
+			Msg:      `must be merge or replace`,
+		})
+	}
+	onConflict, err := backup.StringToOnConflict(query.Get("onConflict"))
+	if err != nil {
+		return backup.Options{}, models.NewValidationErr(models.ComplexErr{
+			Location: `query`,
+			Param:    `onConflict`,
+			Value:    query.Get("onConflict"),
+			Msg:      `must be fail, skip or overwrite`,
+		})
+	}
+	dryRun := false
+	if raw := query.Get("dryRun"); raw != "" {
+		if dryRun, err = strconv.ParseBool(raw); err != nil {
+			return backup.Options{}, models.NewValidationErr(models.ComplexErr{
+				Location: `query`,
+				Param:    `dryRun`,
+				Value:    raw,
+				Msg:      `must be true or false`,
+			})
+		}
+	}
+	return backup.Options{Mode: mode, OnConflict: onConflict, DryRun: dryRun}, nil
+}
+
+func commentPath(r *http.Request) (models.ID, models.ID, error) {
+	postID, err := pathID(r, "POST_ID", models.ErrInvalidPostID)
+	if err != nil {
+		return "", "", err
+	}
+	commentID, err := pathID(r, "COMMENT_ID", models.ErrInvalidCommentID)
+	if err != nil {
+		return "", "", err
+	}
+	return postID, commentID, nil
+}
@@ -0,0 +1,116 @@
+package rest
+
+import (
+	"github.com/gorilla/mux"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Chunk file names carry a content hash, so they never change once published
+var hashedAsset = regexp.MustCompile(`\.[0-9a-f]{8}\.chunk\.(js|css)$`)
+
+// Preferred first: brotli is noticeably smaller for the JS bundles
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+type assetHandler struct {
+	fsys fs.FS
+}
+
+// StaticHandler serves files of fsys, picking a precompressed .br or .gz
+// sibling when the client accepts it. It expects the /static/ prefix to be
+// stripped already.
+func StaticHandler(fsys fs.FS) http.Handler {
+	return assetHandler{fsys: fsys}
+}
+
+func (a assetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	f, info, err := a.open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	h := w.Header()
+	h.Add("Vary", "Accept-Encoding")
+	if hashedAsset.MatchString(name) {
+		h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		h.Set("Cache-Control", CacheRevalidate)
+	}
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		h.Set("Content-Type", ctype)
+	}
+
+	for _, variant := range precompressed {
+		if !acceptsEncoding(r, variant.encoding) {
+			continue
+		}
+		cf, cinfo, err := a.open(name + variant.ext)
+		if err != nil {
+			continue
+		}
+		defer cf.Close()
+		f, info = cf, cinfo
+		h.Set("Content-Encoding", variant.encoding)
+		break
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+func (a assetHandler) open(name string) (fs.File, fs.FileInfo, error) {
+	f, err := a.fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, nil, fs.ErrNotExist
+	}
+	return f, info, nil
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header lists coding
+// with a non-zero quality.
+func acceptsEncoding(r *http.Request, coding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), coding) {
+			continue
+		}
+		q, found := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !found {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
+
+// isAppRoute reports whether the frontend router owns the path, so that deep
+// links such as /a/funny or /u/bob get index.html instead of a 404.
+func isAppRoute(r *http.Request, _ *mux.RouteMatch) bool {
+	p := r.URL.Path
+	return !strings.HasPrefix(p, "/api/") && !strings.HasPrefix(p, "/static/") && path.Ext(p) == ""
+}
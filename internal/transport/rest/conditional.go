@@ -0,0 +1,151 @@
+package rest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CacheRevalidate = "no-cache"
+	CacheNoStore    = "no-store"
+)
+
+type validators struct {
+	etag         string
+	lastModified time.Time
+}
+
+type postVersion struct {
+	id      models.ID
+	version uint64
+	updated time.Time
+	vote    models.Vote
+}
+
+// postListing is a list of posts along with the time the repository last
+// changed, which unlike the posts themselves also advances on deletes.
+type postListing struct {
+	posts    interface{}
+	modified time.Time
+}
+
+func (l postListing) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.posts)
+}
+
+// postValidators derives an ETag from the IDs and versions of the posts in the
+// response, so listings only change their tag when a post is created, deleted,
+// reordered or modified, a view counting as a modification. Projections also
+// mix in the viewer's vote.
+func postValidators(v interface{}) (validators, bool) {
+	var posts []postVersion
+	switch resp := v.(type) {
+	case postListing:
+		vals, ok := postValidators(resp.posts)
+		if ok && resp.modified.After(vals.lastModified) {
+			vals.lastModified = resp.modified
+		}
+		return vals, ok
+	case models.Post:
+		posts = []postVersion{{resp.ID, resp.Version, resp.Updated, 0}}
+	case []models.Post:
+		for _, post := range resp {
+			posts = append(posts, postVersion{post.ID, post.Version, post.Updated, 0})
+		}
+	case service.PublicPost:
+		posts = []postVersion{{resp.ID, resp.Version, resp.Updated, resp.OwnVote()}}
+	case []service.PublicPost:
+		for _, post := range resp {
+			posts = append(posts, postVersion{post.ID, post.Version, post.Updated, post.OwnVote()})
+		}
+	case models.PostDetails:
+		posts = []postVersion{{resp.ID, resp.Version, resp.Updated, resp.Vote}}
+	case []models.PostSummary:
+		for _, post := range resp {
+			posts = append(posts, postVersion{post.ID, post.Version, post.Updated, post.Vote})
+		}
+	default:
+		return validators{}, false
+	}
+
+	h := fnv.New64a()
+	buf := make([]byte, 8)
+	var lastModified time.Time
+	for _, post := range posts {
+		h.Write([]byte(post.id))
+		binary.BigEndian.PutUint64(buf, post.version)
+		h.Write(buf)
+		if post.vote != 0 {
+			h.Write([]byte{byte(post.vote)})
+		}
+		if post.updated.After(lastModified) {
+			lastModified = post.updated
+		}
+	}
+	return validators{
+		etag:         `"` + strconv.Itoa(len(posts)) + "-" + strconv.FormatUint(h.Sum64(), 16) + `"`,
+		lastModified: lastModified,
+	}, true
+}
+
+func (v validators) setHeaders(w http.ResponseWriter) {
+	w.Header().Set("ETag", v.etag)
+	if !v.lastModified.IsZero() {
+		w.Header().Set("Last-Modified", v.lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified evaluates the request preconditions as RFC 7232 section 6
+// prescribes: If-Modified-Since is ignored when If-None-Match is present.
+func (v validators) notModified(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatches(inm, v.etag)
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || v.lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !v.lastModified.Truncate(time.Second).After(since)
+}
+
+// etagMatches uses the weak comparison RFC 9110 section 13.1.2 prescribes
+// for If-None-Match: the W/ prefixes are ignored.
+func etagMatches(header, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func cacheControl(policy string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", policy)
+		next(w, r)
+	}
+}
+
+// deprecated flags a route that has a replacement, see RFC 9745.
+func deprecated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		next(w, r)
+	}
+}
@@ -0,0 +1,145 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	DefaultMaxBodyBytes int64 = 1 << 20
+	jsonContentType           = "application/json"
+)
+
+type RequestDecoder struct {
+	maxBodyBytes int64
+}
+
+type decodeErr struct {
+	statusCode int
+	msg        string
+	cause      error
+}
+
+func (e *decodeErr) Error() string {
+	return e.msg
+}
+
+func (e *decodeErr) Unwrap() error {
+	return e.cause
+}
+
+func NewRequestDecoder(maxBodyBytes int64) *RequestDecoder {
+	if maxBodyBytes <= 0 {
+		maxBodyBytes = DefaultMaxBodyBytes
+	}
+	return &RequestDecoder{
+		maxBodyBytes: maxBodyBytes,
+	}
+}
+
+// Decode reads at most maxBodyBytes of a JSON request body into dst. It rejects
+// bodies that are not declared as JSON, carry unknown fields or more than one
+// value, and reports the exact position of syntax errors.
+func (d *RequestDecoder) Decode(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	body, err := d.read(w, r)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(dst); err != nil {
+		return describeJSONErr(body, err)
+	}
+	// More only looks for the start of another value and misses a stray
+	// closing bracket
+	if err = decoder.Decode(&struct{}{}); err != io.EOF {
+		return badRequest("request body must contain a single JSON value", models.ErrBadPayload)
+	}
+	return nil
+}
+
+func (d *RequestDecoder) read(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	if err := checkContentType(r); err != nil {
+		return nil, err
+	}
+
+	defer r.Body.Close()
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, d.maxBodyBytes))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, &decodeErr{
+			statusCode: http.StatusRequestEntityTooLarge,
+			msg:        fmt.Sprintf("request body must not be larger than %d bytes", maxBytesErr.Limit),
+			cause:      models.ErrBodyTooLarge,
+		}
+	}
+	if err != nil {
+		return nil, badRequest("request body could not be read", err)
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, badRequest("request body must not be empty", models.ErrNoPayload)
+	}
+	return body, nil
+}
+
+func checkContentType(r *http.Request) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != jsonContentType {
+		return &decodeErr{
+			statusCode: http.StatusUnsupportedMediaType,
+			msg:        "Content-Type must be " + jsonContentType,
+			cause:      models.ErrUnknownPayload,
+		}
+	}
+	return nil
+}
+
+func describeJSONErr(body []byte, err error) error {
+	var (
+		syntaxErr        *json.SyntaxError
+		unmarshalTypeErr *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		// Offset counts the bytes read including the offending one
+		line, column := position(body, max(syntaxErr.Offset-1, 0))
+		return badRequest(fmt.Sprintf("malformed JSON at line %d, column %d: %s",
+			line, column, syntaxErr.Error()), err)
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return badRequest("malformed JSON: unexpected end of body", err)
+	case errors.As(err, &unmarshalTypeErr):
+		line, column := position(body, unmarshalTypeErr.Offset)
+		return badRequest(fmt.Sprintf("field %q must be of type %s (line %d, column %d)",
+			unmarshalTypeErr.Field, unmarshalTypeErr.Type, line, column), err)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return badRequest("unknown field "+strings.TrimPrefix(err.Error(), "json: unknown field "), err)
+	default:
+		return badRequest("malformed JSON: "+err.Error(), err)
+	}
+}
+
+func position(body []byte, offset int64) (line, column int) {
+	if offset > int64(len(body)) {
+		offset = int64(len(body))
+	}
+	consumed := body[:offset]
+	line = bytes.Count(consumed, []byte("\n")) + 1
+	column = int(offset) - bytes.LastIndexByte(consumed, '\n')
+	return line, column
+}
+
+func badRequest(msg string, cause error) error {
+	return &decodeErr{
+		statusCode: http.StatusBadRequest,
+		msg:        msg,
+		cause:      cause,
+	}
+}
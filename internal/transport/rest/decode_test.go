@@ -0,0 +1,105 @@
+package rest
+
+import (
+	"errors"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		wantStatus  int
+		wantMsg     string
+	}{
+		{name: "single value", body: `{"comment":"x"}`},
+		{name: "trailing whitespace", body: "{\"comment\":\"x\"}\n\t "},
+		{name: "second value", body: `{"comment":"x"}{"comment":"y"}`, wantStatus: http.StatusBadRequest, wantMsg: "single JSON value"},
+		{name: "stray closing brace", body: `{"comment":"x"}}`, wantStatus: http.StatusBadRequest, wantMsg: "single JSON value"},
+		{name: "stray closing bracket", body: `{"comment":"x"}]`, wantStatus: http.StatusBadRequest, wantMsg: "single JSON value"},
+		{name: "trailing garbage", body: `{"comment":"x"} x`, wantStatus: http.StatusBadRequest, wantMsg: "single JSON value"},
+		{name: "unknown field", body: `{"comment":"x","extra":1}`, wantStatus: http.StatusBadRequest, wantMsg: `unknown field "extra"`},
+		{name: "syntax error", body: "{\"comment\":\n\"x\",}", wantStatus: http.StatusBadRequest, wantMsg: "line 2, column 5"},
+		{name: "empty body", body: "  ", wantStatus: http.StatusBadRequest, wantMsg: "must not be empty"},
+		{name: "not JSON", body: `{"comment":"x"}`, contentType: "text/plain", wantStatus: http.StatusUnsupportedMediaType},
+		{name: "too large", body: `{"comment":"` + strings.Repeat("x", 64) + `"}`, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	decoder := NewRequestDecoder(64)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", jsonContentType)
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			var comment models.Comment
+			err := decoder.Decode(httptest.NewRecorder(), r, &comment)
+			if tt.wantStatus == 0 {
+				if err != nil || comment.Body != "x" {
+					t.Fatalf("Decode() = %v with %+v, want the comment", err, comment)
+				}
+				return
+			}
+			var dErr *decodeErr
+			if !errors.As(err, &dErr) {
+				t.Fatalf("Decode() = %v, want a *decodeErr", err)
+			}
+			if dErr.statusCode != tt.wantStatus || !strings.Contains(dErr.msg, tt.wantMsg) {
+				t.Errorf("Decode() = %d %q, want %d containing %q", dErr.statusCode, dErr.msg, tt.wantStatus, tt.wantMsg)
+			}
+		})
+	}
+}
+
+// TestDecodePostPayload checks that an unknown type or category does not hide
+// the other invalid fields.
+func TestDecodePostPayload(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          string
+		wantDecodeErr bool
+		wantParams    []string
+	}{
+		{name: "valid", body: `{"type":"text","title":"Hello","text":"world","category":"music"}`},
+		{name: "unknown type", body: `{"type":"bogus","category":"music","title":""}`, wantParams: []string{"title", "type"}},
+		{name: "unknown category", body: `{"type":"link","url":"x y","category":"bogus","title":"Hello"}`, wantParams: []string{"url", "category"}},
+		{name: "missing enums", body: `{"title":"Hello"}`, wantParams: []string{"type", "category"}},
+		{name: "enum of the wrong type", body: `{"type":1,"category":"music","title":"Hello"}`, wantDecodeErr: true},
+	}
+	decoder := NewRequestDecoder(DefaultMaxBodyBytes)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", jsonContentType)
+			var payload models.PostPayload
+			err := decoder.Decode(httptest.NewRecorder(), r, &payload)
+			if tt.wantDecodeErr {
+				var dErr *decodeErr
+				if !errors.As(err, &dErr) {
+					t.Fatalf("Decode() = %v, want a *decodeErr", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() = %v", err)
+			}
+			var params []string
+			var vErr *models.ValidationErr
+			if err := payload.Validate(); errors.As(err, &vErr) {
+				for _, e := range vErr.ComplexErrArr().Errs {
+					params = append(params, e.Param.(string))
+				}
+			} else if err != nil {
+				t.Fatalf("Validate() = %v", err)
+			}
+			if strings.Join(params, ",") != strings.Join(tt.wantParams, ",") {
+				t.Errorf("Validate() reported %v, want %v", params, tt.wantParams)
+			}
+		})
+	}
+}
@@ -1,33 +1,89 @@
 package rest
 
 import (
-	"encoding/json"
+	"errors"
 	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
 	"net/http"
 )
 
-func jsonSimpleErr(w http.ResponseWriter, statusCode int, errMsg models.SimpleErr) {
-	resp, err := json.Marshal(errMsg)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+type ErrorMapping struct {
+	StatusCode int
+	Type       string
+	Message    string
+}
 
-	w.WriteHeader(statusCode)
-	if _, err = w.Write(resp); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-	}
+type registeredErr struct {
+	target  error
+	mapping ErrorMapping
 }
 
-func jsonComplexErr(w http.ResponseWriter, statusCode int, errMsg models.ComplexErrArr) {
-	resp, err := json.Marshal(errMsg)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+// ErrorRegistry maps domain errors to HTTP responses. Lookups walk the
+// registrations in order and return the first one the error wraps.
+type ErrorRegistry struct {
+	errs     []registeredErr
+	fallback ErrorMapping
+}
+
+func NewErrorRegistry() *ErrorRegistry {
+	return &ErrorRegistry{
+		errs: make([]registeredErr, 0, 42),
+		fallback: ErrorMapping{
+			StatusCode: http.StatusInternalServerError,
+			Type:       "unknown-error",
+			Message:    models.ErrUnknownError.Error(),
+		},
 	}
+}
 
-	w.WriteHeader(statusCode)
-	if _, err = w.Write(resp); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+func DefaultErrorRegistry() *ErrorRegistry {
+	reg := NewErrorRegistry()
+	reg.Register(models.ErrInvalidPostID, http.StatusBadRequest, "invalid-post-id", models.ErrInvalidPostID.Error())
+	reg.Register(models.ErrInvalidCommentID, http.StatusBadRequest, "invalid-comment-id", models.ErrInvalidCommentID.Error())
+	reg.Register(models.ErrInvalidCategory, http.StatusBadRequest, "invalid-category", models.ErrInvalidCategory.Error())
+	reg.Register(models.ErrBadPayload, http.StatusBadRequest, "bad-payload", models.ErrBadPayload.Error())
+	reg.Register(models.ErrNoUser, http.StatusUnauthorized, "invalid-credentials", models.ErrBadCredentials.Error())
+	reg.Register(models.ErrBadPass, http.StatusUnauthorized, "invalid-credentials", models.ErrBadCredentials.Error())
+	reg.Register(models.ErrBadToken, http.StatusUnauthorized, "bad-token", models.ErrBadToken.Error())
+	reg.Register(models.ErrForbidden, http.StatusForbidden, "forbidden", models.ErrForbidden.Error())
+	reg.Register(models.ErrUnknownUser, http.StatusNotFound, "user-not-found", models.ErrUnknownUser.Error())
+	reg.Register(models.ErrPostNotFound, http.StatusNotFound, "post-not-found", models.ErrPostNotFound.Error())
+	reg.Register(models.ErrCommentNotFound, http.StatusNotFound, "comment-not-found", models.ErrCommentNotFound.Error())
+	reg.Register(models.ErrVoteNotFound, http.StatusNotFound, "vote-not-found", models.ErrVoteNotFound.Error())
+	reg.Register(models.ErrBodyTooLarge, http.StatusRequestEntityTooLarge, "body-too-large", models.ErrBodyTooLarge.Error())
+	reg.Register(models.ErrUnknownPayload, http.StatusUnsupportedMediaType, "unsupported-media-type", models.ErrUnknownPayload.Error())
+	reg.Register(models.ErrInvalidExport, http.StatusUnprocessableEntity, "invalid-export", models.ErrInvalidExport.Error())
+	reg.Register(models.ErrImportConflict, http.StatusConflict, "import-conflict", models.ErrImportConflict.Error())
+	reg.Register(models.ErrBadCommentBody, http.StatusUnprocessableEntity, "bad-comment-body", models.ErrBadCommentBody.Error())
+	reg.Register(models.ErrTooManyAttempts, http.StatusTooManyRequests, "too-many-attempts", models.ErrTooManyAttempts.Error())
+	reg.Register(models.ErrTooManyRequests, http.StatusTooManyRequests, "too-many-requests", models.ErrTooManyRequests.Error())
+	reg.Register(models.ErrResponseError, http.StatusInternalServerError, "response-error", models.ErrResponseError.Error())
+	return reg
+}
+
+func (reg *ErrorRegistry) Register(target error, statusCode int, problemType, message string) {
+	reg.errs = append(reg.errs, registeredErr{
+		target: target,
+		mapping: ErrorMapping{
+			StatusCode: statusCode,
+			Type:       problemType,
+			Message:    message,
+		},
+	})
+}
+
+func (reg *ErrorRegistry) Lookup(err error) ErrorMapping {
+	var vErr *models.ValidationErr
+	if errors.As(err, &vErr) {
+		return ErrorMapping{
+			StatusCode: http.StatusUnprocessableEntity,
+			Type:       "validation-error",
+			Message:    "validation failed",
+		}
+	}
+	for _, registered := range reg.errs {
+		if errors.Is(err, registered.target) {
+			return registered.mapping
+		}
 	}
+	return reg.fallback
 }
@@ -0,0 +1,30 @@
+package rest
+
+import (
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// The tests that run the app built by internal/app live in rest_test, which
+// reaches the internals they check through these.
+
+const JSONContentType = jsonContentType
+
+func (rtr *AppRouter) Routes() *mux.Router {
+	return rtr.routes(NewResponder(DefaultErrorRegistry(), zap.NewNop().Sugar()))
+}
+
+func (h *OpenAPIHandler) FindRoute(req *http.Request) (*routers.Route, map[string]string, error) {
+	return h.router.FindRoute(req)
+}
+
+func APIOperations(r *mux.Router) map[string]bool {
+	return apiOperations(r)
+}
+
+func CheckResponse(input *openapi3filter.RequestValidationInput, status int, header http.Header, body []byte) error {
+	return checkResponse(input, status, header, body)
+}
@@ -0,0 +1,402 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"html"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	feedRSS          = "rss"
+	feedAtom         = "atom"
+	feedDefaultLimit = 25
+	feedMaxLimit     = 100
+	sortNew          = "new"
+	sortTop          = "top"
+	sortComments     = "comments"
+)
+
+var feedSorts = []string{sortNew, sortTop, sortComments}
+
+// feed is the format independent content, encoded as RSS 2.0 or Atom 1.0
+// once complete.
+type feed struct {
+	Title       string
+	Description string
+	Link        string
+	Self        string
+	Updated     time.Time
+	Entries     []feedEntry
+}
+
+type feedEntry struct {
+	ID        string
+	Title     string
+	Link      string
+	Permalink string
+	Author    string
+	Text      string
+	Published time.Time
+	Updated   time.Time
+}
+
+type FeedHandler struct {
+	logger    *zap.SugaredLogger
+	posts     service.PostStorage
+	publicURL string
+}
+
+func NewFeedHandler(posts service.PostStorage, publicURL string, logger *zap.SugaredLogger) *FeedHandler {
+	return &FeedHandler{
+		logger:    logger,
+		posts:     posts,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+	}
+}
+
+func (f *FeedHandler) Front(w http.ResponseWriter, r *http.Request) {
+	f.writePosts(w, r, f.posts.GetAllPosts, "asperitas", "/")
+}
+
+func (f *FeedHandler) Category(w http.ResponseWriter, r *http.Request) {
+	category, err := models.StringToPostCategory(mux.Vars(r)["CATEGORY_NAME"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f.writePosts(w, r, func(ctx context.Context) ([]models.Post, error) {
+		return f.posts.GetPostsByCategory(ctx, category)
+	}, category.String()+" · asperitas", "/a/"+category.String())
+}
+
+func (f *FeedHandler) User(w http.ResponseWriter, r *http.Request) {
+	login := mux.Vars(r)["USER_LOGIN"]
+	f.writePosts(w, r, func(ctx context.Context) ([]models.Post, error) {
+		return f.posts.GetPostsByUser(ctx, models.Username(login))
+	}, login+" · asperitas", "/u/"+login)
+}
+
+func (f *FeedHandler) Comments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	category, err := models.StringToPostCategory(vars["CATEGORY_NAME"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	post, err := findPost(r.Context(), f.posts, category, models.ID(vars["POST_ID"]))
+	if errors.Is(err, models.ErrPostNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		f.fail(w, r, err)
+		return
+	}
+	// Comments have neither a score nor replies, every sort lists the newest first
+	_, limit, ok := f.listParams(w, r)
+	if !ok {
+		return
+	}
+
+	comments := slices.Clone(post.Comments)
+	slices.SortStableFunc(comments, func(a, b *models.PostComment) int {
+		return parseCreated(b.Created).Compare(parseCreated(a.Created))
+	})
+	if len(comments) > limit {
+		comments = comments[:limit]
+	}
+
+	permalink := absoluteURL(f.publicURL, r, postPath(post))
+	fd := feed{
+		Title:       "Comments on " + post.Title,
+		Description: "Comments on " + post.Title,
+		Link:        permalink,
+		Self:        absoluteURL(f.publicURL, r, r.URL.RequestURI()),
+		Updated:     post.Updated,
+	}
+	for _, comment := range comments {
+		created := parseCreated(comment.Created)
+		anchor := permalink + "#" + string(comment.ID)
+		fd.Entries = append(fd.Entries, feedEntry{
+			ID:        anchor,
+			Title:     string(comment.Author.Login) + " on " + post.Title,
+			Link:      anchor,
+			Permalink: anchor,
+			Author:    string(comment.Author.Login),
+			Text:      comment.Body,
+			Published: created,
+			Updated:   created,
+		})
+	}
+	vals, _ := postValidators(*post)
+	f.write(w, r, fd, vals)
+}
+
+// writePosts reads when the posts last changed before it lists them, see
+// PostHandler.listPosts.
+func (f *FeedHandler) writePosts(w http.ResponseWriter, r *http.Request, list func(ctx context.Context) ([]models.Post, error), title, path string) {
+	modified, err := f.posts.LastModified(r.Context())
+	if err != nil {
+		f.fail(w, r, err)
+		return
+	}
+	posts, err := list(r.Context())
+	if err != nil {
+		f.fail(w, r, err)
+		return
+	}
+	sortBy, limit, ok := f.listParams(w, r)
+	if !ok {
+		return
+	}
+	posts = sortPosts(posts, sortBy)
+	if len(posts) > limit {
+		posts = posts[:limit]
+	}
+
+	fd := feed{
+		Title:       title,
+		Description: "The " + sortBy + " posts of " + title,
+		Link:        absoluteURL(f.publicURL, r, path),
+		Self:        absoluteURL(f.publicURL, r, r.URL.RequestURI()),
+	}
+	for _, post := range posts {
+		permalink := absoluteURL(f.publicURL, r, postPath(&post))
+		entry := feedEntry{
+			ID:        permalink,
+			Title:     post.Title,
+			Link:      permalink,
+			Permalink: permalink,
+			Author:    string(post.Author.Login),
+			Published: parseCreated(post.Created),
+			Updated:   post.Updated,
+		}
+		if post.Type == models.WithLink {
+			entry.Link = post.URL
+		} else {
+			entry.Text = post.Text
+		}
+		if post.Updated.After(fd.Updated) {
+			fd.Updated = post.Updated
+		}
+		fd.Entries = append(fd.Entries, entry)
+	}
+	vals, _ := postValidators(postListing{posts: posts, modified: modified})
+	f.write(w, r, fd, vals)
+}
+
+func (f *FeedHandler) listParams(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	query := r.URL.Query()
+	sortBy := query.Get("sort")
+	if sortBy == "" {
+		sortBy = sortNew
+	}
+	if !slices.Contains(feedSorts, sortBy) {
+		http.Error(w, "sort must be one of new, top or comments", http.StatusBadRequest)
+		return "", 0, false
+	}
+	limit := feedDefaultLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > feedMaxLimit {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(feedMaxLimit), http.StatusBadRequest)
+			return "", 0, false
+		}
+		limit = n
+	}
+	return sortBy, limit, true
+}
+
+func (f *FeedHandler) write(w http.ResponseWriter, r *http.Request, fd feed, vals validators) {
+	w.Header().Set("Cache-Control", CacheRevalidate)
+	vals.setHeaders(w)
+	if vals.notModified(r) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var doc interface{}
+	contentType := "application/rss+xml; charset=utf-8"
+	if mux.Vars(r)["FORMAT"] == feedAtom {
+		doc, contentType = fd.atom(), "application/atom+xml; charset=utf-8"
+	} else {
+		doc = fd.rss()
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(buf).Encode(doc); err != nil {
+		f.fail(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		mdwr.Logger(r.Context(), f.logger).Infow("Failed to write feed", "reason", err.Error())
+	}
+}
+
+func (f *FeedHandler) fail(w http.ResponseWriter, r *http.Request, err error) {
+	mdwr.Logger(r.Context(), f.logger).Errorw("Feed generation error", "reason", err.Error())
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+func sortPosts(posts []models.Post, sortBy string) []models.Post {
+	posts = slices.Clone(posts)
+	switch sortBy {
+	case sortNew:
+		slices.SortStableFunc(posts, func(a, b models.Post) int {
+			return parseCreated(b.Created).Compare(parseCreated(a.Created))
+		})
+	case sortTop:
+		slices.SortStableFunc(posts, func(a, b models.Post) int {
+			return b.Score - a.Score
+		})
+	case sortComments:
+		slices.SortStableFunc(posts, func(a, b models.Post) int {
+			return len(b.Comments) - len(a.Comments)
+		})
+	}
+	return posts
+}
+
+func parseCreated(created string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, created)
+	return t
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          atomLink  `xml:"atom:link"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description,omitempty"`
+	Creator     string  `xml:"dc:creator"`
+	Comments    string  `xml:"comments"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func (fd feed) rss() rssDocument {
+	doc := rssDocument{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       fd.Title,
+			Link:        fd.Link,
+			Description: fd.Description,
+			Self:        atomLink{Href: fd.Self, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	if !fd.Updated.IsZero() {
+		doc.Channel.LastBuildDate = fd.Updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, entry := range fd.Entries {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title: entry.Title,
+			Link:  entry.Link,
+			// Readers render the description as HTML, the text is shown as typed
+			Description: html.EscapeString(entry.Text),
+			Creator:     entry.Author,
+			Comments:    entry.Permalink,
+			GUID:        rssGUID{IsPermaLink: true, Value: entry.ID},
+			PubDate:     entry.Published.UTC().Format(time.RFC1123Z),
+		})
+	}
+	return doc
+}
+
+type atomDocument struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published"`
+	Links     []atomLink `xml:"link"`
+	Author    atomPerson `xml:"author"`
+	Content   *atomText  `xml:"content,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func (fd feed) atom() atomDocument {
+	doc := atomDocument{
+		ID:      fd.Self,
+		Title:   fd.Title,
+		Updated: fd.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: fd.Link, Rel: "alternate", Type: "text/html"},
+			{Href: fd.Self, Rel: "self", Type: "application/atom+xml"},
+		},
+	}
+	for _, entry := range fd.Entries {
+		ae := atomEntry{
+			ID:        entry.ID,
+			Title:     entry.Title,
+			Updated:   entry.Updated.UTC().Format(time.RFC3339),
+			Published: entry.Published.UTC().Format(time.RFC3339),
+			Links:     []atomLink{{Href: entry.Link, Rel: "alternate"}},
+			Author:    atomPerson{Name: entry.Author},
+		}
+		if entry.Link != entry.Permalink {
+			ae.Links = append(ae.Links, atomLink{Href: entry.Permalink, Rel: "replies", Type: "text/html"})
+		}
+		if entry.Text != "" {
+			ae.Content = &atomText{Type: "text", Body: entry.Text}
+		}
+		doc.Entries = append(doc.Entries, ae)
+	}
+	return doc
+}
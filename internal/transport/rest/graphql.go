@@ -0,0 +1,48 @@
+package rest
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"net/http"
+	"strings"
+)
+
+type GraphQLExecutor interface {
+	Execute(ctx context.Context, query, operationName string, variables map[string]interface{}) interface{}
+}
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+type GraphQLHandler struct {
+	executor GraphQLExecutor
+	decoder  *RequestDecoder
+}
+
+func NewGraphQLHandler(executor GraphQLExecutor, decoder *RequestDecoder) *GraphQLHandler {
+	return &GraphQLHandler{
+		executor: executor,
+		decoder:  decoder,
+	}
+}
+
+// Query follows the GraphQL over HTTP convention: transport problems get an
+// HTTP error status, query errors are reported in a 200 response.
+func (g *GraphQLHandler) Query(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	req := graphQLRequest{}
+	if err := g.decoder.Decode(w, r, &req); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, models.NewValidationErr(models.ComplexErr{
+			Location: `body`,
+			Param:    `query`,
+			Msg:      `is required`,
+		})
+	}
+	return g.executor.Execute(r.Context(), req.Query, req.OperationName, req.Variables), nil
+}
@@ -0,0 +1,129 @@
+package rest
+
+import (
+	"context"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	statusOK          = "ok"
+	statusUnavailable = "unavailable"
+	checkTimeout      = time.Second * 2
+)
+
+type HealthCheck func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+type checkStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type readiness struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkStatus `json:"checks"`
+}
+
+func (r readiness) StatusCode() int {
+	if r.Status != statusOK {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+type buildInfo struct {
+	Module    string `json:"module"`
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified"`
+}
+
+type HealthHandler struct {
+	mu       *sync.RWMutex
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+func NewHealthHandler() *HealthHandler {
+	return &HealthHandler{
+		mu:     &sync.RWMutex{},
+		checks: make([]namedCheck, 0, 4),
+	}
+}
+
+func (h *HealthHandler) AddCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// Drain makes the readiness probe fail so that the instance is taken out of
+// rotation before its listener is closed.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	return checkStatus{Status: statusOK}, nil
+}
+
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	h.mu.RLock()
+	checks := h.checks
+	h.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+	resp := readiness{
+		Status: statusOK,
+		Checks: make(map[string]checkStatus, len(checks)+1),
+	}
+	if h.draining.Load() {
+		resp.Status = statusUnavailable
+		resp.Checks["shutdown"] = checkStatus{Status: statusUnavailable, Error: "server is draining"}
+	}
+	for _, c := range checks {
+		if err := c.check(ctx); err != nil {
+			resp.Status = statusUnavailable
+			resp.Checks[c.name] = checkStatus{Status: statusUnavailable, Error: err.Error()}
+			continue
+		}
+		resp.Checks[c.name] = checkStatus{Status: statusOK}
+	}
+
+	return resp, nil
+}
+
+func (h *HealthHandler) Version(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return buildInfo{Version: "unknown"}, nil
+	}
+
+	resp := buildInfo{
+		Module:    info.Main.Path,
+		Version:   info.Main.Version,
+		GoVersion: info.GoVersion,
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			resp.Revision = setting.Value
+		case "vcs.time":
+			resp.Time = setting.Value
+		case "vcs.modified":
+			resp.Modified = setting.Value == "true"
+		}
+	}
+	return resp, nil
+}
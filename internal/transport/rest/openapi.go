@@ -0,0 +1,262 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/backup"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+var (
+	routeVarPattern   = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+	schemaPropPattern = regexp.MustCompile(`property "([^"]+)"`)
+)
+
+type OpenAPIOptions struct {
+	// ValidateRequests rejects API requests that do not match the document
+	ValidateRequests bool
+	// ValidateResponses logs API responses that do not match the document, it
+	// buffers every response body and is meant for development and staging
+	ValidateResponses bool
+}
+
+// OpenAPIHandler serves the OpenAPI document of the REST API and optionally
+// validates the traffic against it.
+type OpenAPIHandler struct {
+	doc     *openapi3.T
+	router  routers.Router
+	decoder *RequestDecoder
+	options OpenAPIOptions
+	logger  *zap.SugaredLogger
+}
+
+func NewOpenAPIHandler(decoder *RequestDecoder, options OpenAPIOptions, logger *zap.SugaredLogger) (*OpenAPIHandler, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, fmt.Errorf("openapi.yaml: %w", err)
+	}
+	if err = doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("openapi.yaml: %w", err)
+	}
+	openapi3filter.RegisterBodyDecoder(backup.ContentType, openapi3filter.FileBodyDecoder)
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("openapi.yaml: %w", err)
+	}
+	return &OpenAPIHandler{
+		doc:     doc,
+		router:  router,
+		decoder: decoder,
+		options: options,
+		logger:  logger,
+	}, nil
+}
+
+func (h *OpenAPIHandler) Spec(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	return h.doc, nil
+}
+
+// Drift lists the /api routes of r the document does not describe and the
+// documented operations no route serves.
+func (h *OpenAPIHandler) Drift(r *mux.Router) []string {
+	routed := apiOperations(r)
+	drift := make([]string, 0)
+	for operation := range routed {
+		method, path, _ := strings.Cut(operation, " ")
+		if item := h.doc.Paths.Value(path); item == nil || item.GetOperation(method) == nil {
+			drift = append(drift, operation+" is routed but not documented")
+		}
+	}
+	for path, item := range h.doc.Paths.Map() {
+		for method := range item.Operations() {
+			if !routed[method+" "+path] {
+				drift = append(drift, method+" "+path+" is documented but not routed")
+			}
+		}
+	}
+	slices.Sort(drift)
+	return drift
+}
+
+// apiOperations returns the /api routes of r as "METHOD /path/{VAR}", the way
+// the document spells them.
+func apiOperations(r *mux.Router) map[string]bool {
+	routed := make(map[string]bool)
+	_ = r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(template, "/api/") {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		path := routeVarPattern.ReplaceAllString(template, "{$1}")
+		for _, method := range methods {
+			routed[method+" "+path] = true
+		}
+		return nil
+	})
+	return routed
+}
+
+// Middleware validates the API requests and responses according to the
+// options. Requests outside of the document are passed through untouched.
+func (h *OpenAPIHandler) Middleware(api *Responder) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if !h.options.ValidateRequests && !h.options.ValidateResponses {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := h.router.FindRoute(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			input := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options: &openapi3filter.Options{
+					AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+					MultiError:         true,
+				},
+			}
+
+			if h.options.ValidateRequests {
+				if err = h.validateRequest(w, input); err != nil {
+					api.WriteError(w, r, err)
+					return
+				}
+			}
+			if !h.options.ValidateResponses {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rec := &bodyRecorder{ResponseRecorder: mdwr.NewResponseRecorder(w)}
+			next.ServeHTTP(rec, r)
+			h.validateResponse(input, rec)
+		})
+	}
+}
+
+// validateRequest leaves transport errors, such as a wrong Content-Type or
+// malformed JSON, to the RequestDecoder so that they are reported the same
+// way with and without validation.
+func (h *OpenAPIHandler) validateRequest(w http.ResponseWriter, input *openapi3filter.RequestValidationInput) error {
+	r := input.Request
+	// Other bodies, such as imports, are streamed and checked by their handler
+	input.Options.ExcludeRequestBody = true
+	if spec := input.Route.Operation.RequestBody; spec != nil && spec.Value.Content.Get(jsonContentType) != nil {
+		body, err := h.decoder.read(w, r)
+		if err != nil {
+			return err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		input.Options.ExcludeRequestBody = !json.Valid(body)
+	}
+
+	if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+		return models.NewValidationErr(specViolations(err)...)
+	}
+	return nil
+}
+
+func (h *OpenAPIHandler) validateResponse(input *openapi3filter.RequestValidationInput, rec *bodyRecorder) {
+	r := input.Request
+	if err := checkResponse(input, rec.Status(), rec.Header(), rec.body.Bytes()); err != nil {
+		mdwr.Logger(r.Context(), h.logger).Errorw("Response does not match the OpenAPI document",
+			"reason", err.Error(),
+			"method", r.Method,
+			"url", r.URL.Path,
+			"status", rec.Status(),
+		)
+	}
+}
+
+// checkResponse reports how a response differs from the document, including
+// a status code the operation does not list.
+func checkResponse(input *openapi3filter.RequestValidationInput, status int, header http.Header, body []byte) error {
+	return openapi3filter.ValidateResponse(input.Request.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 status,
+		Header:                 header,
+		Body:                   io.NopCloser(bytes.NewReader(body)),
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true,
+			MultiError:            true,
+		},
+	})
+}
+
+func specViolations(err error) []models.ComplexErr {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		violations := make([]models.ComplexErr, 0, len(e))
+		for _, inner := range e {
+			violations = append(violations, specViolations(inner)...)
+		}
+		return violations
+	case *openapi3filter.RequestError:
+		if e.Parameter == nil && e.Err != nil {
+			return specViolations(e.Err)
+		}
+		violation := models.ComplexErr{Location: "body", Msg: e.Reason}
+		if e.Parameter != nil {
+			violation.Location, violation.Param = e.Parameter.In, e.Parameter.Name
+		}
+		var schemaErr *openapi3.SchemaError
+		switch {
+		case errors.As(e.Err, &schemaErr):
+			violation.Msg = schemaErr.Reason
+		case e.Err != nil:
+			violation.Msg = e.Err.Error()
+		}
+		return []models.ComplexErr{violation}
+	case *openapi3.SchemaError:
+		param := e.JSONPointer()
+		msg := e.Reason
+		// Missing and unknown properties are reported on the enclosing object
+		if match := schemaPropPattern.FindStringSubmatch(e.Reason); match != nil {
+			if len(param) == 0 || param[len(param)-1] != match[1] {
+				param = append(param, match[1])
+			}
+			switch {
+			case strings.HasSuffix(e.Reason, " is missing"):
+				msg = "is required"
+			case strings.HasSuffix(e.Reason, " is unsupported"):
+				msg = "is not allowed"
+			}
+		}
+		return []models.ComplexErr{{Location: "body", Param: strings.Join(param, "."), Msg: msg}}
+	default:
+		return []models.ComplexErr{{Location: "body", Msg: err.Error()}}
+	}
+}
+
+// bodyRecorder keeps a copy of the response body for the response validation.
+type bodyRecorder struct {
+	*mdwr.ResponseRecorder
+	body bytes.Buffer
+}
+
+func (rec *bodyRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseRecorder.Write(b)
+}
@@ -0,0 +1,200 @@
+package rest_test
+
+import (
+	"encoding/json"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/app"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/backup"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/config"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/storage"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/transport/rest"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestApp builds the app the way cmd/redditclone does, in memory and with
+// "root", whose password is "password1", as a configured administrator. The
+// rate limits are raised for the scenarios, which send more than a client
+// would.
+func newTestApp(t *testing.T) *app.App {
+	t.Helper()
+	models.ConfigureSessions([]byte("openapi-test-secret"), nil, time.Hour)
+	cfg := config.Default()
+	cfg.Auth.Admins = []string{"root"}
+	for class, policy := range cfg.RateLimit.Policies {
+		policy.Burst = 1000
+		cfg.RateLimit.Policies[class] = policy
+	}
+	users := storage.NewUserRepo()
+	if _, err := users.RegisterUser(models.AuthUserInfo{Login: "root", Password: "password1"}); err != nil {
+		t.Fatal(err)
+	}
+	reddit, err := app.New(cfg, users, storage.NewPostRepo(), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reddit
+}
+
+// apiCall is a request of the scenario. Its path and body may refer to the
+// values saved by the previous calls as {name}.
+type apiCall struct {
+	method      string
+	path        string
+	body        string
+	contentType string
+	// as names the user whose token is sent
+	as   string
+	want int
+	// save keeps values of the response for the next calls
+	save func(vars map[string]string, body []byte)
+}
+
+func saveField(name string, path ...string) func(map[string]string, []byte) {
+	return func(vars map[string]string, body []byte) {
+		var v interface{}
+		if json.Unmarshal(body, &v) != nil {
+			return
+		}
+		for _, key := range path {
+			switch node := v.(type) {
+			case map[string]interface{}:
+				v = node[key]
+			case []interface{}:
+				if len(node) == 0 {
+					return
+				}
+				v = node[0]
+			}
+		}
+		if s, ok := v.(string); ok {
+			vars[name] = s
+		}
+	}
+}
+
+// TestOpenAPIResponses runs a request against every documented operation and
+// checks the responses of the real handlers against openapi.yaml.
+func TestOpenAPIResponses(t *testing.T) {
+	reddit := newTestApp(t)
+	routes := reddit.Router.Routes()
+	for _, drift := range reddit.OpenAPI.Drift(routes) {
+		t.Errorf("drift: %s", drift)
+	}
+	handler := reddit.Handler
+
+	const (
+		credentials = `{"username":"root","password":"password1"}`
+		textPost    = `{"type":"text","title":"Hello","text":"world","category":"music"}`
+	)
+	calls := []apiCall{
+		{method: http.MethodGet, path: "/api/openapi.json", want: http.StatusOK},
+		{method: http.MethodPost, path: "/api/register", body: `{"username":"alice","password":"password1"}`, want: http.StatusCreated},
+		{method: http.MethodPost, path: "/api/register", body: `{"username":"bad name","password":"x"}`, want: http.StatusUnprocessableEntity},
+		{method: http.MethodPost, path: "/api/register", body: `{`, want: http.StatusBadRequest},
+		{method: http.MethodPost, path: "/api/login", body: credentials, want: http.StatusOK, save: saveField("root", "token")},
+		{method: http.MethodPost, path: "/api/login", body: `{"username":"root","password":"password2"}`, want: http.StatusUnauthorized},
+		{method: http.MethodPost, path: "/api/posts", body: textPost, as: "root", want: http.StatusCreated, save: saveField("post", "id")},
+		{method: http.MethodPost, path: "/api/posts", body: `{"title":"Hello"}`, as: "root", want: http.StatusUnprocessableEntity},
+		{method: http.MethodPost, path: "/api/posts", body: textPost, want: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/api/posts/", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/posts/music", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/user/root", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/post/{post}", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/post/ffffffff", want: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/api/post/00000000-0000-0000-0000-000000000000", want: http.StatusNotFound},
+		{method: http.MethodPost, path: "/api/post/{post}", body: `{"comment":"first"}`, as: "root", want: http.StatusCreated, save: saveField("comment", "comments", "", "id")},
+		{method: http.MethodPost, path: "/api/post/{post}/upvote", as: "root", want: http.StatusOK},
+		{method: http.MethodPost, path: "/api/post/{post}/downvote", as: "root", want: http.StatusOK},
+		{method: http.MethodPost, path: "/api/post/{post}/unvote", as: "root", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/post/{post}/upvote", as: "root", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/post/{post}/downvote", as: "root", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/post/{post}/unvote", as: "root", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v2/posts", as: "root", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v2/posts/music", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v2/user/root", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v2/post/{post}", as: "root", want: http.StatusOK},
+		{method: http.MethodPost, path: "/api/register", body: `{"username":"eve","password":"password1"}`, want: http.StatusCreated, save: saveField("eve", "token")},
+		{method: http.MethodGet, path: "/api/admin/users", as: "eve", want: http.StatusForbidden},
+		{method: http.MethodGet, path: "/api/admin/users", want: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/api/admin/users", as: "root", want: http.StatusOK},
+		{method: http.MethodPost, path: "/api/admin/users", body: `{"username":"bob","password":"password1"}`, as: "root", want: http.StatusCreated},
+		{method: http.MethodPost, path: "/api/admin/users/bob/role", body: `{"role":"admin"}`, as: "root", want: http.StatusOK},
+		{method: http.MethodPost, path: "/api/admin/users/bob/password", body: `{"password":"password2"}`, as: "root", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/admin/posts?limit=5", as: "root", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/admin/posts/{post}", as: "root", want: http.StatusOK},
+		{method: http.MethodDelete, path: "/api/admin/posts/{post}/comments/{comment}", as: "root", want: http.StatusOK},
+		{method: http.MethodPost, path: "/api/admin/posts/{post}/comments/{comment}/restore", as: "root", want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/admin/export", as: "root", want: http.StatusOK, save: func(vars map[string]string, body []byte) {
+			vars["export"] = string(body)
+		}},
+		{method: http.MethodPost, path: "/api/admin/import?dryRun=true", body: "{export}", contentType: backup.ContentType, as: "root", want: http.StatusOK},
+		{method: http.MethodDelete, path: "/api/admin/posts/{post}", as: "root", want: http.StatusOK},
+		{method: http.MethodPost, path: "/api/admin/posts/{post}/restore", as: "root", want: http.StatusOK},
+		{method: http.MethodDelete, path: "/api/post/{post}/{comment}", as: "root", want: http.StatusOK},
+		{method: http.MethodDelete, path: "/api/post/{post}", as: "root", want: http.StatusOK},
+	}
+
+	vars := make(map[string]string)
+	exercised := make(map[string]bool)
+	for _, call := range calls {
+		replacements := make([]string, 0, 2*len(vars))
+		for name, value := range vars {
+			replacements = append(replacements, "{"+name+"}", value)
+		}
+		expand := strings.NewReplacer(replacements...).Replace
+		path := expand(call.path)
+		req := httptest.NewRequest(call.method, path, strings.NewReader(expand(call.body)))
+		if call.body != "" {
+			req.Header.Set("Content-Type", rest.JSONContentType)
+		}
+		if call.contentType != "" {
+			req.Header.Set("Content-Type", call.contentType)
+		}
+		if call.as != "" {
+			req.Header.Set("Authorization", "Bearer "+vars[call.as])
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != call.want {
+			t.Errorf("%s %s = %d %s, want %d", call.method, path, rec.Code, rec.Body, call.want)
+			continue
+		}
+		if call.save != nil {
+			call.save(vars, rec.Body.Bytes())
+		}
+
+		route, pathParams, err := reddit.OpenAPI.FindRoute(req)
+		if err != nil {
+			t.Errorf("%s %s is not documented: %v", call.method, path, err)
+			continue
+		}
+		exercised[call.method+" "+route.Path] = true
+		input := &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+		}
+		if err = rest.CheckResponse(input, rec.Code, rec.Header(), rec.Body.Bytes()); err != nil {
+			t.Errorf("%s %s: response does not match the document: %v", call.method, path, err)
+		}
+	}
+
+	operations := make([]string, 0)
+	for operation := range rest.APIOperations(routes) {
+		operations = append(operations, operation)
+	}
+	slices.Sort(operations)
+	for _, operation := range operations {
+		if !exercised[operation] {
+			t.Errorf("%s is routed but no request checks its response", operation)
+		}
+	}
+}
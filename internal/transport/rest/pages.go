@@ -0,0 +1,271 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	pagePostLimit        = 50
+	pageDescriptionLimit = 200
+	sitemapURLLimit      = 50000
+	allCategories        = "all"
+)
+
+// page is rendered into index.html so that crawlers and clients without
+// JavaScript get the content and the link preview tags, the bundle replaces
+// it once loaded.
+type page struct {
+	Title       string
+	Description string
+	URL         string
+	Feed        string
+	Type        string
+	Categories  []string
+	Posts       []models.Post
+	Post        *models.Post
+}
+
+type PageHandler struct {
+	logger    *zap.SugaredLogger
+	posts     service.PostStorage
+	publicURL string
+	index     *template.Template
+	category  *template.Template
+	post      *template.Template
+}
+
+// NewPageHandler parses the templates matching pattern in assets together
+// with the category.tmpl and post.tmpl page bodies next to them. Absolute
+// links are built from publicURL, or from the request host when it is empty.
+func NewPageHandler(posts service.PostStorage, assets fs.FS, pattern, publicURL string, logger *zap.SugaredLogger) (*PageHandler, error) {
+	index, err := template.ParseFS(assets, pattern)
+	if err != nil {
+		return nil, err
+	}
+	pages := make(map[string]*template.Template, 2)
+	for _, name := range []string{"category.tmpl", "post.tmpl"} {
+		tmpl, err := template.Must(index.Clone()).ParseFS(assets, "html/"+name)
+		if err != nil {
+			return nil, err
+		}
+		pages[name] = tmpl
+	}
+	return &PageHandler{
+		logger:    logger,
+		posts:     posts,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		index:     index,
+		category:  pages["category.tmpl"],
+		post:      pages["post.tmpl"],
+	}, nil
+}
+
+// Loaded reports whether the SPA shell template is available.
+func (pg *PageHandler) Loaded() bool {
+	return pg.index.Lookup("index.html") != nil
+}
+
+// App serves the bare SPA shell for the routes rendered by the bundle only.
+func (pg *PageHandler) App(w http.ResponseWriter, r *http.Request) {
+	pg.render(w, r, pg.index, http.StatusOK, nil)
+}
+
+func (pg *PageHandler) Category(w http.ResponseWriter, r *http.Request) {
+	name, ok := mux.Vars(r)["CATEGORY_NAME"]
+	if !ok {
+		name = allCategories
+	}
+
+	var posts []models.Post
+	var err error
+	if name == allCategories {
+		posts, err = pg.posts.GetAllPosts(r.Context())
+	} else {
+		var category models.PostCategory
+		if category, err = models.StringToPostCategory(name); err != nil {
+			pg.render(w, r, pg.index, http.StatusNotFound, nil)
+			return
+		}
+		posts, err = pg.posts.GetPostsByCategory(r.Context(), category)
+	}
+	if err != nil {
+		pg.fail(w, r, err)
+		return
+	}
+	if len(posts) > pagePostLimit {
+		posts = posts[:pagePostLimit]
+	}
+
+	path, feed := "/", "/feeds/all.rss"
+	if _, ok = mux.Vars(r)["CATEGORY_NAME"]; ok {
+		path, feed = "/a/"+name, "/feeds/a/"+name+".rss"
+	}
+	pg.render(w, r, pg.category, http.StatusOK, &page{
+		Title:       name,
+		Description: "The latest " + name + " posts on asperitas",
+		URL:         pg.absolute(r, path),
+		Feed:        feed,
+		Type:        "website",
+		Categories:  categoryNames(),
+		Posts:       posts,
+	})
+}
+
+func (pg *PageHandler) Post(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	category, err := models.StringToPostCategory(vars["CATEGORY_NAME"])
+	if err != nil {
+		pg.render(w, r, pg.index, http.StatusNotFound, nil)
+		return
+	}
+	post, err := findPost(r.Context(), pg.posts, category, models.ID(vars["POST_ID"]))
+	if errors.Is(err, models.ErrPostNotFound) {
+		pg.render(w, r, pg.index, http.StatusNotFound, nil)
+		return
+	}
+	if err != nil {
+		pg.fail(w, r, err)
+		return
+	}
+
+	description := post.Text
+	if post.Type == models.WithLink {
+		description = post.URL
+	}
+	pg.render(w, r, pg.post, http.StatusOK, &page{
+		Title:       post.Title,
+		Description: truncate(description, pageDescriptionLimit),
+		URL:         pg.absolute(r, postPath(post)),
+		Feed:        "/feeds" + postPath(post) + "/comments.rss",
+		Type:        "article",
+		Post:        post,
+	})
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemap struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+func (pg *PageHandler) Sitemap(w http.ResponseWriter, r *http.Request) {
+	posts, err := pg.posts.GetAllPosts(r.Context())
+	if err != nil {
+		pg.fail(w, r, err)
+		return
+	}
+
+	sm := sitemap{URLs: []sitemapURL{{Loc: pg.absolute(r, "/")}}}
+	for _, name := range categoryNames() {
+		sm.URLs = append(sm.URLs, sitemapURL{Loc: pg.absolute(r, "/a/"+name)})
+	}
+	for _, post := range posts {
+		if len(sm.URLs) == sitemapURLLimit {
+			break
+		}
+		sm.URLs = append(sm.URLs, sitemapURL{
+			Loc:     pg.absolute(r, postPath(&post)),
+			LastMod: post.Updated.UTC().Format(time.RFC3339),
+		})
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	if err = xml.NewEncoder(buf).Encode(sm); err != nil {
+		pg.fail(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Cache-Control", CacheRevalidate)
+	if _, err = w.Write(buf.Bytes()); err != nil {
+		mdwr.Logger(r.Context(), pg.logger).Infow("Failed to write sitemap", "reason", err.Error())
+	}
+}
+
+func (pg *PageHandler) render(w http.ResponseWriter, r *http.Request, tmpl *template.Template, status int, data *page) {
+	buf := &bytes.Buffer{}
+	if err := tmpl.ExecuteTemplate(buf, "index.html", data); err != nil {
+		pg.fail(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", CacheRevalidate)
+	w.WriteHeader(status)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		mdwr.Logger(r.Context(), pg.logger).Infow("Failed to write page", "reason", err.Error())
+	}
+}
+
+func (pg *PageHandler) fail(w http.ResponseWriter, r *http.Request, err error) {
+	mdwr.Logger(r.Context(), pg.logger).Errorw("Page rendering error", "reason", err.Error())
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+func (pg *PageHandler) absolute(r *http.Request, path string) string {
+	return absoluteURL(pg.publicURL, r, path)
+}
+
+// findPost looks the post up in its category listing instead of calling
+// GetPostByID, which counts a view: the bundle counts its own as soon as it
+// loads the post, and feed readers poll.
+func findPost(ctx context.Context, posts service.PostStorage, category models.PostCategory, postID models.ID) (*models.Post, error) {
+	list, err := posts.GetPostsByCategory(ctx, category)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].ID == postID {
+			return &list[i], nil
+		}
+	}
+	return nil, models.ErrPostNotFound
+}
+
+func absoluteURL(publicURL string, r *http.Request, path string) string {
+	if publicURL != "" {
+		return publicURL + path
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + path
+}
+
+func postPath(post *models.Post) string {
+	return "/a/" + post.Category.String() + "/" + string(post.ID)
+}
+
+func categoryNames() []string {
+	names := make([]string, 0, models.CategoryCount)
+	for c := 0; c < models.CategoryCount; c++ {
+		names = append(names, models.PostCategory(c).String())
+	}
+	return names
+}
+
+func truncate(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
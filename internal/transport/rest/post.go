@@ -1,13 +1,11 @@
 package rest
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
 	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
-	"io"
 	"net/http"
 	"unicode/utf8"
 )
@@ -20,319 +18,155 @@ type PostAPI interface {
 type PostHandler struct {
 	logger  *zap.SugaredLogger
 	service PostAPI
+	decoder *RequestDecoder
 }
 
-func NewPostHandler(p PostAPI, logger *zap.SugaredLogger) *PostHandler {
+func NewPostHandler(p PostAPI, decoder *RequestDecoder, logger *zap.SugaredLogger) *PostHandler {
 	return &PostHandler{
 		logger:  logger,
 		service: p,
+		decoder: decoder,
 	}
 }
 
-func (p *PostHandler) GetAllPosts(w http.ResponseWriter, r *http.Request) {
-	postList, err := p.service.GetAllPosts(r.Context())
-	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrUnknownError.Error()))
-		return
-	}
-
-	resp, err := json.Marshal(postList)
-	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
-		return
-	}
-	if _, err = w.Write(resp); err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
-	}
+func (p *PostHandler) GetAllPosts(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	return p.listPosts(r, publicPosts(w, r), p.service.GetAllPosts)
 }
 
-func (p *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
+func (p *PostHandler) CreatePost(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	postPayload := models.PostPayload{}
-	if err = json.Unmarshal(body, &postPayload); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
-	newPost, err := p.service.CreatePost(r.Context(), postPayload)
-	if errors.Is(err, models.ErrInvalidURL) {
-		jsonComplexErr(w, http.StatusUnprocessableEntity, models.NewComplexErr(models.ComplexErr{
-			Location: "body",
-			Param:    "url",
-			Value:    postPayload.URL,
-			Msg:      "is invalid",
-		}))
-		return
-	}
-	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrUnknownError.Error()))
-		return
-	}
-
-	resp, err := json.Marshal(newPost)
-	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
-		return
-	}
-	w.WriteHeader(http.StatusCreated)
-	if _, err := w.Write(resp); err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
+	if err := p.decoder.Decode(w, r, &postPayload); err != nil {
+		return nil, err
 	}
+	return publicPost(w, r)(p.service.CreatePost(r.Context(), postPayload))
 }
 
-func (p *PostHandler) GetPostByID(w http.ResponseWriter, r *http.Request) {
-	postID := models.ID(mux.Vars(r)["POST_ID"])
-	if utf8.RuneCountInString(string(postID)) != models.UUIDLength {
-		jsonSimpleErr(w, http.StatusBadRequest, models.NewSimpleErr(models.ErrInvalidPostID.Error()))
-		return
-	}
-
-	post, err := p.service.GetPostByID(r.Context(), postID)
-	if errors.Is(err, models.ErrPostNotFound) {
-		jsonSimpleErr(w, http.StatusNotFound, models.NewSimpleErr(models.ErrPostNotFound.Error()))
-		return
-	}
+func (p *PostHandler) GetPostByID(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	postID, err := pathID(r, "POST_ID", models.ErrInvalidPostID)
 	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrUnknownError.Error()))
-		return
-	}
-
-	resp, err := json.Marshal(post)
-	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
-		return
-	}
-	if _, err = w.Write(resp); err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
+		return nil, err
 	}
+	return publicPost(w, r)(p.service.GetPostByID(r.Context(), postID))
 }
 
-func (p *PostHandler) GetPostsByCategory(w http.ResponseWriter, r *http.Request) {
+func (p *PostHandler) GetPostsByCategory(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	postCategory, err := models.StringToPostCategory(mux.Vars(r)["CATEGORY_NAME"])
 	if err != nil {
-		jsonSimpleErr(w, http.StatusBadRequest, models.NewSimpleErr(models.ErrInvalidCategory.Error()))
-		return
-	}
-
-	postList, err := p.service.GetPostsByCategory(r.Context(), postCategory)
-	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrUnknownError.Error()))
-		return
-	}
-
-	resp, err := json.Marshal(postList)
-	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
-		return
-	}
-	if _, err := w.Write(resp); err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
+		return nil, err
 	}
+	return p.listPosts(r, publicPosts(w, r), func(ctx context.Context) ([]models.Post, error) {
+		return p.service.GetPostsByCategory(ctx, postCategory)
+	})
 }
 
-func (p *PostHandler) GetPostsByUser(w http.ResponseWriter, r *http.Request) {
+func (p *PostHandler) GetPostsByUser(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	userLogin := models.Username(mux.Vars(r)["USER_LOGIN"])
-	postList, err := p.service.GetPostsByUser(r.Context(), userLogin)
-	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrUnknownError.Error()))
-		return
-	}
+	return p.listPosts(r, publicPosts(w, r), func(ctx context.Context) ([]models.Post, error) {
+		return p.service.GetPostsByUser(ctx, userLogin)
+	})
+}
 
-	resp, err := json.Marshal(postList)
+func (p *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	postID, err := pathID(r, "POST_ID", models.ErrInvalidPostID)
 	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
-		return
+		return nil, err
 	}
-	if _, err := w.Write(resp); err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
+	if err = p.service.DeletePost(r.Context(), postID); err != nil {
+		return nil, err
 	}
+	return models.NewSimpleErr("success"), nil
 }
 
-func (p *PostHandler) DeletePost(w http.ResponseWriter, r *http.Request) {
-	postID := models.ID(mux.Vars(r)["POST_ID"])
-	if utf8.RuneCountInString(string(postID)) != models.UUIDLength {
-		jsonSimpleErr(w, http.StatusBadRequest, models.NewSimpleErr(models.ErrInvalidPostID.Error()))
-		return
-	}
-
-	err := p.service.DeletePost(r.Context(), postID)
-	if errors.Is(err, models.ErrPostNotFound) {
-		jsonSimpleErr(w, http.StatusNotFound, models.NewSimpleErr(models.ErrPostNotFound.Error()))
-		return
-	}
+func (p *PostHandler) Upvote(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	postID, err := pathID(r, "POST_ID", models.ErrInvalidPostID)
 	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrUnknownError.Error()))
-		return
+		return nil, err
 	}
-	jsonSimpleErr(w, http.StatusOK, models.NewSimpleErr("success"))
+	return publicPost(w, r)(p.service.Upvote(r.Context(), postID))
 }
 
-func (p *PostHandler) Upvote(w http.ResponseWriter, r *http.Request) {
-	postID := models.ID(mux.Vars(r)["POST_ID"])
-	if utf8.RuneCountInString(string(postID)) != models.UUIDLength {
-		jsonSimpleErr(w, http.StatusBadRequest, models.NewSimpleErr(models.ErrInvalidPostID.Error()))
-		return
-	}
-
-	post, err := p.service.Upvote(r.Context(), postID)
-	if errors.Is(err, models.ErrPostNotFound) {
-		jsonSimpleErr(w, http.StatusNotFound, models.NewSimpleErr(models.ErrPostNotFound.Error()))
-		return
-	}
+func (p *PostHandler) Downvote(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	postID, err := pathID(r, "POST_ID", models.ErrInvalidPostID)
 	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrUnknownError.Error()))
-		return
+		return nil, err
 	}
+	return publicPost(w, r)(p.service.Downvote(r.Context(), postID))
+}
 
-	resp, err := json.Marshal(post)
+func (p *PostHandler) Unvote(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	postID, err := pathID(r, "POST_ID", models.ErrInvalidPostID)
 	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
-		return
-	}
-	if _, err = w.Write(resp); err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
+		return nil, err
 	}
+	return publicPost(w, r)(p.service.Unvote(r.Context(), postID))
 }
 
-func (p *PostHandler) Downvote(w http.ResponseWriter, r *http.Request) {
-	postID := models.ID(mux.Vars(r)["POST_ID"])
-	if utf8.RuneCountInString(string(postID)) != models.UUIDLength {
-		jsonSimpleErr(w, http.StatusBadRequest, models.NewSimpleErr(models.ErrInvalidPostID.Error()))
-		return
-	}
-
-	post, err := p.service.Downvote(r.Context(), postID)
-	if errors.Is(err, models.ErrPostNotFound) {
-		jsonSimpleErr(w, http.StatusNotFound, models.NewSimpleErr(models.ErrPostNotFound.Error()))
-		return
-	}
-	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrUnknownError.Error()))
-		return
+func (p *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	comment := models.Comment{}
+	if err := p.decoder.Decode(w, r, &comment); err != nil {
+		return nil, err
 	}
 
-	resp, err := json.Marshal(post)
+	postID, err := pathID(r, "POST_ID", models.ErrInvalidPostID)
 	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
-		return
-	}
-	if _, err = w.Write(resp); err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
+		return nil, err
 	}
+	return publicPost(w, r)(p.service.AddComment(r.Context(), postID, comment))
 }
 
-func (p *PostHandler) Unvote(w http.ResponseWriter, r *http.Request) {
-	postID := models.ID(mux.Vars(r)["POST_ID"])
-	if utf8.RuneCountInString(string(postID)) != models.UUIDLength {
-		jsonSimpleErr(w, http.StatusBadRequest, models.NewSimpleErr(models.ErrInvalidPostID.Error()))
-		return
-	}
-
-	post, err := p.service.Unvote(r.Context(), postID)
-	if errors.Is(err, models.ErrPostNotFound) {
-		jsonSimpleErr(w, http.StatusNotFound, models.NewSimpleErr(models.ErrPostNotFound.Error()))
-		return
-	}
+func (p *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	postID, err := pathID(r, "POST_ID", models.ErrInvalidPostID)
 	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrUnknownError.Error()))
-		return
+		return nil, err
 	}
-
-	resp, err := json.Marshal(post)
+	commentID, err := pathID(r, "COMMENT_ID", models.ErrInvalidCommentID)
 	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
-		return
-	}
-	if _, err = w.Write(resp); err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
+		return nil, err
 	}
+	return publicPost(w, r)(p.service.DeleteComment(r.Context(), postID, commentID))
 }
 
-func (p *PostHandler) AddComment(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-	comment := models.Comment{}
-	if err = json.Unmarshal(body, &comment); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
+// publicPost and publicPosts serialize service results for the caller, see
+// service.NewPublicPost. The body depends on the token, so caches key on it.
+func publicPost(w http.ResponseWriter, r *http.Request) func(models.Post, error) (interface{}, error) {
+	return func(post models.Post, err error) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		w.Header().Add("Vary", "Authorization")
+		return service.NewPublicPost(r.Context(), post), nil
 	}
+}
 
-	postID := models.ID(mux.Vars(r)["POST_ID"])
-	if utf8.RuneCountInString(string(postID)) != models.UUIDLength {
-		jsonSimpleErr(w, http.StatusBadRequest, models.NewSimpleErr(models.ErrInvalidPostID.Error()))
-		return
+func publicPosts(w http.ResponseWriter, r *http.Request) func([]models.Post, error) (interface{}, error) {
+	return func(posts []models.Post, err error) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		w.Header().Add("Vary", "Authorization")
+		return service.NewPublicPosts(r.Context(), posts), nil
 	}
+}
 
-	post, err := p.service.AddComment(r.Context(), postID, comment)
-	if errors.Is(err, models.ErrBadCommentBody) {
-		jsonComplexErr(w, http.StatusUnprocessableEntity, models.NewComplexErr(models.ComplexErr{
-			Location: "body",
-			Param:    "comment",
-			Msg:      "is required",
-		}))
-		return
-	}
-	if errors.Is(err, models.ErrPostNotFound) {
-		jsonSimpleErr(w, http.StatusNotFound, models.NewSimpleErr(models.ErrPostNotFound.Error()))
-		return
-	}
+// listPosts reads when the posts last changed before it lists them: a change
+// in between then makes the listing look older than it is, never newer.
+func (p *PostHandler) listPosts(r *http.Request, project func([]models.Post, error) (interface{}, error),
+	list func(ctx context.Context) ([]models.Post, error)) (interface{}, error) {
+	modified, err := p.service.LastModified(r.Context())
 	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrUnknownError.Error()))
-		return
+		return nil, err
 	}
-
-	resp, err := json.Marshal(post)
+	posts, err := project(list(r.Context()))
 	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
-		return
-	}
-	w.WriteHeader(http.StatusCreated)
-	if _, err = w.Write(resp); err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
+		return nil, err
 	}
+	return postListing{posts: posts, modified: modified}, nil
 }
 
-func (p *PostHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
-	postID := models.ID(mux.Vars(r)["POST_ID"])
-	commentID := models.ID(mux.Vars(r)["COMMENT_ID"])
-	if utf8.RuneCountInString(string(postID)) != models.UUIDLength {
-		jsonSimpleErr(w, http.StatusBadRequest, models.NewSimpleErr(models.ErrInvalidPostID.Error()))
-		return
-	}
-	if utf8.RuneCountInString(string(commentID)) != models.UUIDLength {
-		jsonSimpleErr(w, http.StatusBadRequest, models.NewSimpleErr(models.ErrInvalidCommentID.Error()))
-		return
-	}
-
-	post, err := p.service.DeleteComment(r.Context(), postID, commentID)
-	if errors.Is(err, models.ErrPostNotFound) {
-		jsonSimpleErr(w, http.StatusNotFound, models.NewSimpleErr(models.ErrPostNotFound.Error()))
-		return
-	}
-	if errors.Is(err, models.ErrCommentNotFound) {
-		jsonSimpleErr(w, http.StatusNotFound, models.NewSimpleErr(models.ErrCommentNotFound.Error()))
-		return
-	}
-	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrUnknownError.Error()))
-		return
-	}
-
-	resp, err := json.Marshal(post)
-	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
-		return
-	}
-	if _, err = w.Write(resp); err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrResponseError.Error()))
+func pathID(r *http.Request, name string, errInvalid error) (models.ID, error) {
+	id := models.ID(mux.Vars(r)[name])
+	if utf8.RuneCountInString(string(id)) != models.UUIDLength {
+		return "", errInvalid
 	}
+	return id, nil
 }
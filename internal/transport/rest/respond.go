@@ -0,0 +1,169 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
+	"go.uber.org/zap"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "/problems/"
+	utf8Charset        = "; charset=utf-8"
+)
+
+// APIFunc is a handler that leaves response encoding to the Responder: it
+// returns either a value to be serialized or an error to be mapped.
+type APIFunc func(w http.ResponseWriter, r *http.Request) (interface{}, error)
+
+// StatusCoder lets a response value override the status code the handler was
+// registered with.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// Streamer is a response value that writes its own body, for bodies too large
+// to be encoded in memory first.
+type Streamer interface {
+	io.WriterTo
+	ContentType() string
+}
+
+type Responder struct {
+	errs   *ErrorRegistry
+	logger *zap.SugaredLogger
+}
+
+func NewResponder(errs *ErrorRegistry, logger *zap.SugaredLogger) *Responder {
+	return &Responder{
+		errs:   errs,
+		logger: logger,
+	}
+}
+
+func (rs *Responder) Handle(statusCode int, fn APIFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp, err := fn(w, r)
+		if err != nil {
+			rs.WriteError(w, r, err)
+			return
+		}
+		if streamer, ok := resp.(Streamer); ok {
+			rs.stream(w, r, statusCode, streamer)
+			return
+		}
+		rs.WriteJSON(w, r, statusCode, resp)
+	}
+}
+
+func (rs *Responder) WriteJSON(w http.ResponseWriter, r *http.Request, statusCode int, v interface{}) {
+	if coder, ok := v.(StatusCoder); ok {
+		statusCode = coder.StatusCode()
+	}
+	cacheable := statusCode == http.StatusOK && w.Header().Get("Cache-Control") != CacheNoStore
+	if validators, ok := postValidators(v); ok && cacheable {
+		validators.setHeaders(w)
+		if validators.notModified(r) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	resp, err := json.Marshal(v)
+	if err != nil {
+		rs.WriteError(w, r, errors.Join(models.ErrResponseError, err))
+		return
+	}
+	rs.write(w, r, statusCode, jsonContentType, resp)
+}
+
+func (rs *Responder) WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	mapping := rs.errs.Lookup(err)
+	if mapping.StatusCode >= http.StatusInternalServerError {
+		mdwr.Logger(r.Context(), rs.logger).Errorw("Request failed",
+			"reason", err.Error(),
+			"method", r.Method,
+			"remote_addr", r.RemoteAddr,
+			"url", r.URL.Path,
+		)
+	}
+
+	var (
+		resp        interface{}
+		contentType = jsonContentType
+		vErr        *models.ValidationErr
+		dErr        *decodeErr
+		detail      string
+	)
+	if errors.As(err, &dErr) {
+		mapping.StatusCode = dErr.statusCode
+		detail = dErr.msg
+	}
+	switch {
+	case acceptsProblem(r):
+		problem := models.NewProblem(problemTypePrefix+mapping.Type, mapping.Message, mapping.StatusCode, detail, r.URL.Path)
+		if errors.As(err, &vErr) {
+			problem.Errs = vErr.ComplexErrArr().Errs
+		}
+		resp, contentType = problem, problemContentType
+	case errors.As(err, &vErr):
+		resp = vErr.ComplexErrArr()
+	case detail != "":
+		resp = models.NewSimpleErr(detail)
+	default:
+		resp = models.NewSimpleErr(mapping.Message)
+	}
+
+	body, mErr := json.Marshal(resp)
+	if mErr != nil {
+		mdwr.Logger(r.Context(), rs.logger).Errorw("Error response generation failed", "reason", mErr.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rs.write(w, r, mapping.StatusCode, contentType, body)
+}
+
+// write sends the status code and body once. A failed Write cannot be reported
+// to the client anymore, since the status line is already out, so it is only logged.
+func (rs *Responder) write(w http.ResponseWriter, r *http.Request, statusCode int, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType+utf8Charset)
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(body); err != nil {
+		mdwr.Logger(r.Context(), rs.logger).Warnw("Response write failed",
+			"reason", err.Error(),
+			"method", r.Method,
+			"remote_addr", r.RemoteAddr,
+			"url", r.URL.Path,
+		)
+	}
+}
+
+// stream is write for a Streamer, which can fail half way through the body.
+func (rs *Responder) stream(w http.ResponseWriter, r *http.Request, statusCode int, streamer Streamer) {
+	w.Header().Set("Content-Type", streamer.ContentType()+utf8Charset)
+	w.WriteHeader(statusCode)
+	if _, err := streamer.WriteTo(w); err != nil {
+		mdwr.Logger(r.Context(), rs.logger).Warnw("Response stream failed",
+			"reason", err.Error(),
+			"method", r.Method,
+			"remote_addr", r.RemoteAddr,
+			"url", r.URL.Path,
+		)
+	}
+}
+
+func acceptsProblem(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == problemContentType {
+			return true
+		}
+	}
+	return false
+}
@@ -1,68 +1,169 @@
 package rest
 
 import (
+	"context"
+	"errors"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/ratelimit"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/tracing"
 	"github.com/Benzogang-Tape/Reddit-clone/internal/transport/middleware"
 	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
-	"html/template"
+	"io/fs"
 	"net/http"
 )
 
+type RouterOptions struct {
+	// Assets holds the frontend files served under /static/
+	Assets               fs.FS
+	AccessLogSampleRates map[string]float64
+	IPResolver           *mdwr.IPResolver
+	CORS                 mdwr.CORSOptions
+	Security             mdwr.SecurityOptions
+	SessionCookie        string
+	// RateLimiter is optional, rate limiting is disabled when it is nil
+	RateLimiter *ratelimit.Limiter
+	// GraphQL is optional, /graphql is not served when it is nil
+	GraphQL *GraphQLHandler
+	// OpenAPI is optional, /api/openapi.json is not served when it is nil
+	OpenAPI *OpenAPIHandler
+	// Admin is optional, /api/admin is not served when it is nil
+	Admin *AdminHandler
+}
+
+// Instrumentation measures the requests: Middleware wraps the whole app and
+// RouteLabel, installed on the mux, names the route a request matched.
+type Instrumentation interface {
+	Middleware(next http.Handler) http.Handler
+	RouteLabel(next http.Handler) http.Handler
+	Handler() http.Handler
+}
+
 type AppRouter struct {
-	userHandler *UserHandler
-	postHandler *PostHandler
+	userHandler     *UserHandler
+	postHandler     *PostHandler
+	healthHandler   *HealthHandler
+	pageHandler     *PageHandler
+	feedHandler     *FeedHandler
+	instrumentation Instrumentation
+	options         RouterOptions
 }
 
-func NewAppRouter(u *UserHandler, p *PostHandler) *AppRouter {
+func NewAppRouter(u *UserHandler, p *PostHandler, h *HealthHandler, pg *PageHandler, f *FeedHandler, i Instrumentation, options RouterOptions) *AppRouter {
 	return &AppRouter{
-		userHandler: u,
-		postHandler: p,
+		userHandler:     u,
+		postHandler:     p,
+		healthHandler:   h,
+		pageHandler:     pg,
+		feedHandler:     f,
+		instrumentation: i,
+		options:         options,
 	}
 }
 
 func (rtr *AppRouter) InitRouter(logger *zap.SugaredLogger) http.Handler {
-	templates := template.Must(template.ParseGlob("./static/*/*"))
+	rtr.healthHandler.AddCheck("templates", func(ctx context.Context) error {
+		if !rtr.pageHandler.Loaded() {
+			return errors.New("index.html template is not loaded")
+		}
+		return nil
+	})
 
-	r := mux.NewRouter()
-	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		err := templates.ExecuteTemplate(w, "index.html", nil)
-		if err != nil {
-			http.Error(w, `Template error`, http.StatusInternalServerError)
-			return
+	api := NewResponder(DefaultErrorRegistry(), logger)
+	r := rtr.routes(api)
+	if rtr.options.OpenAPI != nil {
+		for _, drift := range rtr.options.OpenAPI.Drift(r) {
+			logger.Errorw("OpenAPI document is out of sync with the router", "drift", drift)
 		}
-	}).Methods(http.MethodGet)
-
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
-
-	// ! may not work
-	// staticHandler := http.StripPrefix("/static/", http.FileServer(http.Dir("./static")))
-	// r.Handle("/static/", staticHandler).Methods("GET")
-
-	// ! Another way to link with static
-	// r := mux.NewRouter()
-	// r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
-	// r.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-	// 	http.ServeFile(w, r, "./static/html/index.html")
-	// }).Methods("GET")
-
-	r.HandleFunc("/api/register", rtr.userHandler.registerUser).Methods(http.MethodPost)
-	r.HandleFunc("/api/login", rtr.userHandler.loginUser).Methods(http.MethodPost)
-	r.HandleFunc("/api/posts/", rtr.postHandler.GetAllPosts).Methods(http.MethodGet)
-	r.HandleFunc("/api/posts", rtr.postHandler.CreatePost).Methods(http.MethodPost)
-	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+$}", rtr.postHandler.GetPostByID).Methods(http.MethodGet)
-	r.HandleFunc("/api/posts/{CATEGORY_NAME:[0-9a-zA-Z_-]+$}", rtr.postHandler.GetPostsByCategory).Methods(http.MethodGet)
-	r.HandleFunc("/api/user/{USER_LOGIN:[0-9a-zA-Z_-]+$}", rtr.postHandler.GetPostsByUser).Methods(http.MethodGet)
-	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+$}", rtr.postHandler.DeletePost).Methods(http.MethodDelete)
-	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+}/upvote", rtr.postHandler.Upvote).Methods(http.MethodGet)
-	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+}/downvote", rtr.postHandler.Downvote).Methods(http.MethodGet)
-	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+}/unvote", rtr.postHandler.Unvote).Methods(http.MethodGet)
-	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+$}", rtr.postHandler.AddComment).Methods(http.MethodPost)
-	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+}/{COMMENT_ID:[0-9a-fA-F-]+$}", rtr.postHandler.DeleteComment).Methods(http.MethodDelete)
-
-	router := middleware.Auth(r, logger)
-	router = mdwr.AccessLog(logger, router)
-	router = middleware.Panic(router, logger)
-
-	return router
+	}
+
+	router := middleware.Auth(r, api, logger)
+	router = mdwr.CSRF(rtr.options.SessionCookie, router)
+	router = mdwr.AccessLog(logger, mdwr.NewPrefixSampler(rtr.options.AccessLogSampleRates), router)
+	router = rtr.instrumentation.Middleware(router)
+
+	// Probes and metrics are polled every few seconds: they skip authentication
+	// and the access log so that they do not drown out real traffic.
+	root := mux.NewRouter()
+	root.HandleFunc("/healthz", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.healthHandler.Healthz))).Methods(http.MethodGet)
+	root.HandleFunc("/readyz", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.healthHandler.Readyz))).Methods(http.MethodGet)
+	root.HandleFunc("/version", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.healthHandler.Version))).Methods(http.MethodGet)
+	root.Handle("/metrics", rtr.instrumentation.Handler()).Methods(http.MethodGet)
+	root.PathPrefix("/").Handler(router)
+
+	handler := mdwr.SecurityHeaders(rtr.options.Security, mdwr.CORS(rtr.options.CORS, root))
+	return mdwr.RequestID(rtr.options.IPResolver.Middleware(middleware.Panic(handler, logger)))
+}
+
+// routes builds the mux of the app, without the middlewares that run before
+// routing.
+func (rtr *AppRouter) routes(api *Responder) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(tracing.Middleware, rtr.instrumentation.RouteLabel)
+	if rtr.options.RateLimiter != nil {
+		r.Use(rtr.options.RateLimiter.Middleware(api))
+	}
+	if rtr.options.OpenAPI != nil {
+		r.Use(rtr.options.OpenAPI.Middleware(api))
+	}
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static", StaticHandler(rtr.options.Assets))).Methods(http.MethodGet, http.MethodHead)
+
+	r.HandleFunc("/api/register", cacheControl(CacheNoStore, api.Handle(http.StatusCreated, rtr.userHandler.registerUser))).Methods(http.MethodPost)
+	r.HandleFunc("/api/login", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.userHandler.loginUser))).Methods(http.MethodPost)
+	r.HandleFunc("/api/posts/", cacheControl(CacheRevalidate, api.Handle(http.StatusOK, rtr.postHandler.GetAllPosts))).Methods(http.MethodGet)
+	r.HandleFunc("/api/posts", cacheControl(CacheNoStore, api.Handle(http.StatusCreated, rtr.postHandler.CreatePost))).Methods(http.MethodPost)
+	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+$}", cacheControl(CacheRevalidate, api.Handle(http.StatusOK, rtr.postHandler.GetPostByID))).Methods(http.MethodGet)
+	r.HandleFunc("/api/posts/{CATEGORY_NAME:[0-9a-zA-Z_-]+$}", cacheControl(CacheRevalidate, api.Handle(http.StatusOK, rtr.postHandler.GetPostsByCategory))).Methods(http.MethodGet)
+	r.HandleFunc("/api/user/{USER_LOGIN:[0-9a-zA-Z_-]+$}", cacheControl(CacheRevalidate, api.Handle(http.StatusOK, rtr.postHandler.GetPostsByUser))).Methods(http.MethodGet)
+	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+$}", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.postHandler.DeletePost))).Methods(http.MethodDelete)
+	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+}/upvote", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.postHandler.Upvote))).Methods(http.MethodPost)
+	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+}/downvote", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.postHandler.Downvote))).Methods(http.MethodPost)
+	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+}/unvote", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.postHandler.Unvote))).Methods(http.MethodPost)
+	// Deprecated: state-changing GETs are kept for the bundled frontend only
+	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+}/upvote", deprecated(cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.postHandler.Upvote)))).Methods(http.MethodGet)
+	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+}/downvote", deprecated(cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.postHandler.Downvote)))).Methods(http.MethodGet)
+	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+}/unvote", deprecated(cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.postHandler.Unvote)))).Methods(http.MethodGet)
+	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+$}", cacheControl(CacheNoStore, api.Handle(http.StatusCreated, rtr.postHandler.AddComment))).Methods(http.MethodPost)
+	r.HandleFunc("/api/post/{POST_ID:[0-9a-fA-F-]+}/{COMMENT_ID:[0-9a-fA-F-]+$}", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.postHandler.DeleteComment))).Methods(http.MethodDelete)
+	r.HandleFunc("/api/v2/posts", cacheControl(CacheRevalidate, api.Handle(http.StatusOK, rtr.postHandler.GetAllPostSummaries))).Methods(http.MethodGet)
+	r.HandleFunc("/api/v2/posts/{CATEGORY_NAME:[0-9a-zA-Z_-]+$}", cacheControl(CacheRevalidate, api.Handle(http.StatusOK, rtr.postHandler.GetCategorySummaries))).Methods(http.MethodGet)
+	r.HandleFunc("/api/v2/user/{USER_LOGIN:[0-9a-zA-Z_-]+$}", cacheControl(CacheRevalidate, api.Handle(http.StatusOK, rtr.postHandler.GetUserSummaries))).Methods(http.MethodGet)
+	r.HandleFunc("/api/v2/post/{POST_ID:[0-9a-fA-F-]+$}", cacheControl(CacheRevalidate, api.Handle(http.StatusOK, rtr.postHandler.GetPostDetails))).Methods(http.MethodGet)
+
+	if rtr.options.Admin != nil {
+		admin := r.PathPrefix("/api/admin").Subrouter()
+		admin.Use(rtr.options.Admin.Middleware(api))
+		admin.HandleFunc("/users", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.options.Admin.GetUsers))).Methods(http.MethodGet)
+		admin.HandleFunc("/users", cacheControl(CacheNoStore, api.Handle(http.StatusCreated, rtr.options.Admin.CreateUser))).Methods(http.MethodPost)
+		admin.HandleFunc("/users/{USER_LOGIN:[0-9a-zA-Z_-]+}/role", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.options.Admin.SetRole))).Methods(http.MethodPost)
+		admin.HandleFunc("/users/{USER_LOGIN:[0-9a-zA-Z_-]+}/password", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.options.Admin.ResetPassword))).Methods(http.MethodPost)
+		admin.HandleFunc("/posts", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.options.Admin.GetTopPosts))).Methods(http.MethodGet)
+		admin.HandleFunc("/export", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.options.Admin.Export))).Methods(http.MethodGet)
+		admin.HandleFunc("/import", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.options.Admin.Import))).Methods(http.MethodPost)
+		admin.HandleFunc("/posts/{POST_ID:[0-9a-fA-F-]+}", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.options.Admin.GetPost))).Methods(http.MethodGet)
+		admin.HandleFunc("/posts/{POST_ID:[0-9a-fA-F-]+}", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.options.Admin.DeletePost))).Methods(http.MethodDelete)
+		admin.HandleFunc("/posts/{POST_ID:[0-9a-fA-F-]+}/restore", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.options.Admin.RestorePost))).Methods(http.MethodPost)
+		admin.HandleFunc("/posts/{POST_ID:[0-9a-fA-F-]+}/comments/{COMMENT_ID:[0-9a-fA-F-]+}", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.options.Admin.DeleteComment))).Methods(http.MethodDelete)
+		admin.HandleFunc("/posts/{POST_ID:[0-9a-fA-F-]+}/comments/{COMMENT_ID:[0-9a-fA-F-]+}/restore", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.options.Admin.RestoreComment))).Methods(http.MethodPost)
+	}
+
+	if rtr.options.OpenAPI != nil {
+		r.HandleFunc("/api/openapi.json", cacheControl(CacheRevalidate, api.Handle(http.StatusOK, rtr.options.OpenAPI.Spec))).Methods(http.MethodGet)
+	}
+
+	if rtr.options.GraphQL != nil {
+		r.HandleFunc("/graphql", cacheControl(CacheNoStore, api.Handle(http.StatusOK, rtr.options.GraphQL.Query))).Methods(http.MethodPost)
+	}
+
+	r.HandleFunc("/", rtr.pageHandler.Category).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/a/{CATEGORY_NAME:[0-9a-zA-Z_-]+}", rtr.pageHandler.Category).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/a/{CATEGORY_NAME:[0-9a-zA-Z_-]+}/{POST_ID:[0-9a-fA-F-]+}", rtr.pageHandler.Post).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/sitemap.xml", rtr.pageHandler.Sitemap).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/feeds/all.{FORMAT:rss|atom}", rtr.feedHandler.Front).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/feeds/a/{CATEGORY_NAME:[0-9a-zA-Z_-]+}.{FORMAT:rss|atom}", rtr.feedHandler.Category).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/feeds/a/{CATEGORY_NAME:[0-9a-zA-Z_-]+}/{POST_ID:[0-9a-fA-F-]+}/comments.{FORMAT:rss|atom}", rtr.feedHandler.Comments).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/feeds/u/{USER_LOGIN:[0-9a-zA-Z_-]+}.{FORMAT:rss|atom}", rtr.feedHandler.User).Methods(http.MethodGet, http.MethodHead)
+	// Everything else that looks like a page belongs to the SPA router
+	r.MatcherFunc(isAppRoute).HandlerFunc(rtr.pageHandler.App).Methods(http.MethodGet, http.MethodHead)
+	return r
 }
@@ -0,0 +1,60 @@
+package rest
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	"github.com/gorilla/mux"
+	"net/http"
+)
+
+// The /api/v2 handlers read the same posts as v1 but project them for the
+// caller: listings carry summaries, and no representation lists the voters.
+
+func (p *PostHandler) GetAllPostSummaries(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	return p.listPosts(r, summaries(w, r), p.service.GetAllPosts)
+}
+
+func (p *PostHandler) GetCategorySummaries(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	postCategory, err := models.StringToPostCategory(mux.Vars(r)["CATEGORY_NAME"])
+	if err != nil {
+		return nil, err
+	}
+	return p.listPosts(r, summaries(w, r), func(ctx context.Context) ([]models.Post, error) {
+		return p.service.GetPostsByCategory(ctx, postCategory)
+	})
+}
+
+func (p *PostHandler) GetUserSummaries(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	return p.listPosts(r, summaries(w, r), func(ctx context.Context) ([]models.Post, error) {
+		return p.service.GetPostsByUser(ctx, models.Username(mux.Vars(r)["USER_LOGIN"]))
+	})
+}
+
+func (p *PostHandler) GetPostDetails(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	postID, err := pathID(r, "POST_ID", models.ErrInvalidPostID)
+	if err != nil {
+		return nil, err
+	}
+	post, err := p.service.GetPostByID(r.Context(), postID)
+	if err != nil {
+		return nil, err
+	}
+	return models.NewPostDetails(post, viewerID(w, r)), nil
+}
+
+func summaries(w http.ResponseWriter, r *http.Request) func([]models.Post, error) (interface{}, error) {
+	return func(posts []models.Post, err error) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		return models.NewPostSummaries(posts, viewerID(w, r)), nil
+	}
+}
+
+// viewerID returns the ID of the authenticated caller, or an empty ID. The
+// response depends on it, so caches are told to key on the token.
+func viewerID(w http.ResponseWriter, r *http.Request) models.ID {
+	w.Header().Add("Vary", "Authorization")
+	return service.ViewerID(r.Context())
+}
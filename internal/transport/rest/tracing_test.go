@@ -0,0 +1,105 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/tracing"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/transport/rest"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestTracingSpans follows requests through the app and checks the spans the
+// memory exporter receives.
+func TestTracingSpans(t *testing.T) {
+	provider, err := tracing.NewProvider(tracing.Config{Exporter: tracing.ExporterMemory, SampleRatio: 1, ServiceName: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+		provider.Shutdown(context.Background()) //nolint:errcheck
+	})
+
+	handler := newTestApp(t).Handler
+
+	serve := func(method, path, token, body string) []byte {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", rest.JSONContentType)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code >= http.StatusBadRequest {
+			t.Fatalf("%s %s = %d: %s", method, path, rec.Code, rec.Body)
+		}
+		return rec.Body.Bytes()
+	}
+	var session struct {
+		Token string `json:"token"`
+	}
+	if err = json.Unmarshal(serve(http.MethodPost, "/api/register", "", `{"username":"alice","password":"password1"}`), &session); err != nil {
+		t.Fatal(err)
+	}
+	token := models.Session{}
+	token.InitWithToken(session.Token)
+	alice, err := token.ValidateToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var post models.Post
+	if err = json.Unmarshal(serve(http.MethodPost, "/api/posts", session.Token, `{"type":"text","title":"Hello","text":"world","category":"music"}`), &post); err != nil {
+		t.Fatal(err)
+	}
+	provider.Memory.Reset()
+	serve(http.MethodPost, "/api/post/"+string(post.ID)+"/upvote", session.Token, "")
+
+	spans := provider.Memory.GetSpans()
+	byName := make(map[string]tracetest.SpanStub, len(spans))
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	route := "/api/post/{POST_ID:[0-9a-fA-F-]+}/upvote"
+	chain := []string{"POST " + route, "service.Upvote", "storage.Upvote"}
+	for i, name := range chain {
+		span, ok := byName[name]
+		if !ok {
+			t.Fatalf("no %q span among %d spans", name, len(spans))
+		}
+		if i > 0 && span.Parent.SpanID() != byName[chain[i-1]].SpanContext.SpanID() {
+			t.Errorf("%q is not a child of %q", name, chain[i-1])
+		}
+		if span.SpanContext.TraceID() != byName[chain[0]].SpanContext.TraceID() {
+			t.Errorf("%q left the trace of the request", name)
+		}
+		want := []attribute.KeyValue{attribute.String("post.id", string(post.ID)), attribute.String("user.id", string(alice.ID))}
+		if i == 0 {
+			want = append(want, attribute.String("http.route", route))
+		}
+		for _, attr := range want {
+			if !hasAttribute(span.Attributes, attr) {
+				t.Errorf("%q has no %s=%s attribute", name, attr.Key, attr.Value.Emit())
+			}
+		}
+	}
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if attr == want {
+			return true
+		}
+	}
+	return false
+}
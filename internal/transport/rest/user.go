@@ -2,12 +2,14 @@ package rest
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
 	"go.uber.org/zap"
-	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type UserAPI interface {
@@ -15,85 +17,117 @@ type UserAPI interface {
 	Authorize(models.AuthUserInfo) (models.TokenPayload, error)
 }
 
+type LoginGuard interface {
+	Check(ctx context.Context, login models.Username, ip string) (time.Duration, error)
+	Fail(ctx context.Context, login models.Username, ip string) ([]models.Lockout, error)
+	Succeed(ctx context.Context, login models.Username, ip string) error
+}
+
 type UserHandler struct {
 	logger  *zap.SugaredLogger
 	service UserAPI
+	guard   LoginGuard
+	decoder *RequestDecoder
 }
 
-func NewUserHandler(u UserAPI, logger *zap.SugaredLogger) *UserHandler {
+func NewUserHandler(u UserAPI, guard LoginGuard, decoder *RequestDecoder, logger *zap.SugaredLogger) *UserHandler {
 	return &UserHandler{
 		logger:  logger,
 		service: u,
+		guard:   guard,
+		decoder: decoder,
 	}
 }
 
-func (h *UserHandler) registerUser(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
+func (h *UserHandler) registerUser(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	credentials := models.AuthUserInfo{}
-	if err = json.Unmarshal(body, &credentials); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
+	if err := h.decoder.Decode(w, r, &credentials); err != nil {
+		return nil, err
 	}
 
 	payload, err := h.service.Register(credentials)
 	if errors.Is(err, models.ErrUserExists) {
-		jsonComplexErr(w, http.StatusUnprocessableEntity, models.NewComplexErr(models.ComplexErr{
+		return nil, models.NewValidationErr(models.ComplexErr{
 			Location: `body`,
 			Param:    `username`,
-			Value:    `1`,
+			Value:    credentials.Login,
 			Msg:      `already exists`,
-		}))
-		return
+		})
 	}
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	newSession(w, r.WithContext(context.WithValue(r.Context(), models.Payload, payload)), http.StatusCreated)
-	h.logger.Infow("New user has registered",
+	sess, err := models.NewSession(payload)
+	if err != nil {
+		return nil, err
+	}
+	mdwr.Logger(r.Context(), h.logger).Infow("New user has registered",
 		"login", credentials.Login,
 		"remote_addr", r.RemoteAddr,
 		"url", r.URL.Path,
 	)
+	return sess, nil
 }
 
-func (h *UserHandler) loginUser(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
+func (h *UserHandler) loginUser(w http.ResponseWriter, r *http.Request) (interface{}, error) {
 	credentials := models.AuthUserInfo{}
-	if err = json.Unmarshal(body, &credentials); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
+	if err := h.decoder.Decode(w, r, &credentials); err != nil {
+		return nil, err
 	}
 
-	payload, err := h.service.Authorize(credentials)
-	if errors.Is(err, models.ErrNoUser) {
-		jsonSimpleErr(w, http.StatusUnauthorized, models.NewSimpleErr(models.ErrNoUser.Error()))
-		return
+	ip := mdwr.ClientIP(r)
+	retryAfter, err := h.guard.Check(r.Context(), credentials.Login, ip)
+	if errors.Is(err, models.ErrTooManyAttempts) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
 	}
-	if errors.Is(err, models.ErrBadPass) {
-		jsonSimpleErr(w, http.StatusUnauthorized, models.NewSimpleErr(models.ErrBadPass.Error()))
-		return
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := h.service.Authorize(credentials)
+	if errors.Is(err, models.ErrNoUser) || errors.Is(err, models.ErrBadPass) {
+		h.registerFailure(r, credentials.Login, ip)
 	}
 	if err != nil {
-		jsonSimpleErr(w, http.StatusInternalServerError, models.NewSimpleErr(models.ErrUnknownError.Error()))
-		return
+		return nil, err
+	}
+	if err = h.guard.Succeed(r.Context(), credentials.Login, ip); err != nil {
+		mdwr.Logger(r.Context(), h.logger).Errorw("Login attempts reset failed",
+			"reason", err.Error(),
+			"login", credentials.Login,
+		)
 	}
 
-	newSession(w, r.WithContext(context.WithValue(r.Context(), models.Payload, payload)), http.StatusOK)
-	h.logger.Infow("New log in",
+	sess, err := models.NewSession(payload)
+	if err != nil {
+		return nil, err
+	}
+	mdwr.Logger(r.Context(), h.logger).Infow("New log in",
 		"login", credentials.Login,
 		"remote_addr", r.RemoteAddr,
 		"url", r.URL.Path,
 	)
+	return sess, nil
+}
+
+func (h *UserHandler) registerFailure(r *http.Request, login models.Username, ip string) {
+	lockouts, err := h.guard.Fail(r.Context(), login, ip)
+	if err != nil {
+		mdwr.Logger(r.Context(), h.logger).Errorw("Login failure registration failed",
+			"reason", err.Error(),
+			"login", login,
+			"remote_addr", r.RemoteAddr,
+		)
+	}
+	for _, lockout := range lockouts {
+		mdwr.Logger(r.Context(), h.logger).Warnw("Login locked out",
+			"key", lockout.Key,
+			"failures", lockout.Failures,
+			"locked_until", lockout.Until,
+			"login", login,
+			"remote_addr", r.RemoteAddr,
+			"url", r.URL.Path,
+		)
+	}
 }
@@ -0,0 +1,103 @@
+package rpc
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/events"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	redditv1 "github.com/Benzogang-Tape/Reddit-clone/pkg/api/reddit/v1"
+)
+
+func toAuthor(author models.TokenPayload) *redditv1.Author {
+	return &redditv1.Author{
+		Id:       string(author.ID),
+		Username: string(author.Login),
+	}
+}
+
+// toPost serializes the post for the caller found in ctx, see
+// service.NewPublicPost.
+func toPost(ctx context.Context, post models.Post) *redditv1.Post {
+	public := service.NewPublicPost(ctx, post)
+	pb := &redditv1.Post{
+		Id:               string(post.ID),
+		Type:             toPostType(post.Type),
+		Title:            post.Title,
+		Url:              post.URL,
+		Text:             post.Text,
+		Category:         post.Category.String(),
+		Author:           toAuthor(post.Author),
+		Score:            int32(post.Score),
+		Views:            uint32(post.Views),
+		UpvotePercentage: int32(post.UpvotePercentage),
+		Created:          post.Created,
+		Upvotes:          int32(public.Upvotes),
+		Downvotes:        int32(public.Downvotes),
+		Votes:            make([]*redditv1.Vote, 0, len(public.Votes)),
+		Comments:         make([]*redditv1.Comment, 0, len(post.Comments)),
+	}
+	for _, vote := range public.Votes {
+		pb.Votes = append(pb.Votes, &redditv1.Vote{
+			UserId: string(vote.UserID),
+			Vote:   int32(vote.Vote),
+		})
+	}
+	for _, comment := range post.Comments {
+		pb.Comments = append(pb.Comments, &redditv1.Comment{
+			Id:      string(comment.ID),
+			Author:  toAuthor(comment.Author),
+			Body:    comment.Body,
+			Created: comment.Created,
+		})
+	}
+	return pb
+}
+
+func toPosts(ctx context.Context, posts []models.Post) *redditv1.ListPostsResponse {
+	resp := &redditv1.ListPostsResponse{Posts: make([]*redditv1.Post, 0, len(posts))}
+	for _, post := range posts {
+		resp.Posts = append(resp.Posts, toPost(ctx, post))
+	}
+	return resp
+}
+
+func toPostType(postType models.PostType) redditv1.PostType {
+	if postType == models.WithLink {
+		return redditv1.PostType_POST_TYPE_LINK
+	}
+	return redditv1.PostType_POST_TYPE_TEXT
+}
+
+// toPostPayload leaves an unspecified type empty, the validation of the
+// service reports it with the other invalid fields.
+func toPostPayload(req *redditv1.CreatePostRequest) models.PostPayload {
+	payload := models.PostPayload{
+		Title:    req.GetTitle(),
+		URL:      req.GetUrl(),
+		Text:     req.GetText(),
+		Category: req.GetCategory(),
+	}
+	switch req.GetType() {
+	case redditv1.PostType_POST_TYPE_LINK:
+		payload.Type = models.WithLink.String()
+	case redditv1.PostType_POST_TYPE_TEXT:
+		payload.Type = models.WithText.String()
+	}
+	return payload
+}
+
+func toPostEvent(ctx context.Context, event events.PostEvent) *redditv1.PostEvent {
+	pb := &redditv1.PostEvent{}
+	switch event.Type {
+	case events.PostCreated:
+		pb.Type = redditv1.PostEvent_TYPE_CREATED
+		pb.Post = toPost(ctx, event.Post)
+	case events.PostUpdated:
+		pb.Type = redditv1.PostEvent_TYPE_UPDATED
+		pb.Post = toPost(ctx, event.Post)
+	case events.PostDeleted:
+		pb.Type = redditv1.PostEvent_TYPE_DELETED
+		pb.Post = &redditv1.Post{Id: string(event.Post.ID)}
+	}
+	return pb
+}
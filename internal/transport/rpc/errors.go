@@ -0,0 +1,70 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type errorMapping struct {
+	target  error
+	code    codes.Code
+	message string
+}
+
+// errorCodes mirrors rest.DefaultErrorRegistry, the first match wins.
+var errorCodes = []errorMapping{
+	{models.ErrInvalidPostID, codes.InvalidArgument, models.ErrInvalidPostID.Error()},
+	{models.ErrInvalidCommentID, codes.InvalidArgument, models.ErrInvalidCommentID.Error()},
+	{models.ErrInvalidCategory, codes.InvalidArgument, models.ErrInvalidCategory.Error()},
+	{models.ErrInvalidPostType, codes.InvalidArgument, models.ErrInvalidPostType.Error()},
+	{models.ErrBadCommentBody, codes.InvalidArgument, models.ErrBadCommentBody.Error()},
+	{models.ErrBadPayload, codes.Unauthenticated, models.ErrBadPayload.Error()},
+	{models.ErrNoUser, codes.Unauthenticated, models.ErrBadCredentials.Error()},
+	{models.ErrBadPass, codes.Unauthenticated, models.ErrBadCredentials.Error()},
+	{models.ErrBadToken, codes.Unauthenticated, models.ErrBadToken.Error()},
+	{models.ErrUserExists, codes.AlreadyExists, models.ErrUserExists.Error()},
+	{models.ErrPostNotFound, codes.NotFound, models.ErrPostNotFound.Error()},
+	{models.ErrCommentNotFound, codes.NotFound, models.ErrCommentNotFound.Error()},
+	{models.ErrVoteNotFound, codes.NotFound, models.ErrVoteNotFound.Error()},
+	{models.ErrTooManyAttempts, codes.ResourceExhausted, models.ErrTooManyAttempts.Error()},
+	{context.Canceled, codes.Canceled, context.Canceled.Error()},
+	{context.DeadlineExceeded, codes.DeadlineExceeded, context.DeadlineExceeded.Error()},
+}
+
+// toStatus converts a service error into a gRPC status. Validation failures
+// carry every invalid field as a BadRequest detail.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var vErr *models.ValidationErr
+	if errors.As(err, &vErr) {
+		st := status.New(codes.InvalidArgument, "validation failed")
+		details := &errdetails.BadRequest{}
+		for _, field := range vErr.ComplexErrArr().Errs {
+			details.FieldViolations = append(details.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       fmt.Sprint(field.Param),
+				Description: fmt.Sprint(field.Msg),
+			})
+		}
+		if withDetails, detailsErr := st.WithDetails(details); detailsErr == nil {
+			st = withDetails
+		}
+		return st.Err()
+	}
+	for _, mapping := range errorCodes {
+		if errors.Is(err, mapping.target) {
+			return status.Error(mapping.code, mapping.message)
+		}
+	}
+	return status.Error(codes.Internal, models.ErrUnknownError.Error())
+}
@@ -0,0 +1,240 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/ratelimit"
+	redditv1 "github.com/Benzogang-Tape/Reddit-clone/pkg/api/reddit/v1"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const requestIDMetadata = "x-request-id"
+
+// authMethods lists the calls that require a token, like the authUrls of
+// middleware.Auth do for the REST routes.
+var authMethods = map[string]bool{
+	redditv1.Reddit_CreatePost_FullMethodName:    true,
+	redditv1.Reddit_DeletePost_FullMethodName:    true,
+	redditv1.Reddit_Vote_FullMethodName:          true,
+	redditv1.Reddit_AddComment_FullMethodName:    true,
+	redditv1.Reddit_DeleteComment_FullMethodName: true,
+}
+
+// methodClasses sorts the calls into the rate-limit classes of the matching
+// REST routes. The calls missing here are reads.
+var methodClasses = map[string]ratelimit.Class{
+	redditv1.Reddit_Register_FullMethodName:      ratelimit.ClassAuth,
+	redditv1.Reddit_Login_FullMethodName:         ratelimit.ClassAuth,
+	redditv1.Reddit_CreatePost_FullMethodName:    ratelimit.ClassWrite,
+	redditv1.Reddit_DeletePost_FullMethodName:    ratelimit.ClassWrite,
+	redditv1.Reddit_Vote_FullMethodName:          ratelimit.ClassVote,
+	redditv1.Reddit_AddComment_FullMethodName:    ratelimit.ClassWrite,
+	redditv1.Reddit_DeleteComment_FullMethodName: ratelimit.ClassWrite,
+}
+
+// NewGRPCServer registers srv on a gRPC server whose interceptors mirror the
+// HTTP chain: request ID and access log, then panic recovery, then auth, then
+// the rate limiter unless limiter is nil.
+func NewGRPCServer(srv *Server, limiter *ratelimit.Limiter, logger *zap.SugaredLogger, opts ...grpc.ServerOption) *grpc.Server {
+	unary := []grpc.UnaryServerInterceptor{accessLogUnary(logger), recoverUnary(logger), authUnary(logger)}
+	stream := []grpc.StreamServerInterceptor{accessLogStream(logger), recoverStream(logger), authStream(logger)}
+	if limiter != nil {
+		unary = append(unary, rateLimitUnary(limiter))
+		stream = append(stream, rateLimitStream(limiter))
+	}
+	opts = append(opts, grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...))
+	s := grpc.NewServer(opts...)
+	redditv1.RegisterRedditServer(s, srv)
+	return s
+}
+
+// serverStream overrides the context of a stream so that interceptors can
+// pass values down to the handler.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func startCall(ctx context.Context) context.Context {
+	var requestID string
+	if values := metadata.ValueFromIncomingContext(ctx, requestIDMetadata); len(values) > 0 {
+		requestID = values[0]
+	}
+	ctx, requestID = mdwr.WithRequestID(ctx, requestID)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, requestID))
+	return ctx
+}
+
+func logCall(ctx context.Context, logger *zap.SugaredLogger, method string, start time.Time, err error) {
+	mdwr.Logger(ctx, logger).Infow("New request",
+		"method", method,
+		"remote_addr", peerIP(ctx),
+		"code", status.Code(err).String(),
+		"time", time.Since(start),
+	)
+}
+
+func accessLogUnary(logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		ctx = startCall(ctx)
+		resp, err := handler(ctx, req)
+		logCall(ctx, logger, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+func accessLogStream(logger *zap.SugaredLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx := startCall(ss.Context())
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+		logCall(ctx, logger, info.FullMethod, start, err)
+		return err
+	}
+}
+
+func recovered(ctx context.Context, logger *zap.SugaredLogger, method string, p interface{}) error {
+	mdwr.Logger(ctx, logger).Errorw("panicInterceptor",
+		"panic", fmt.Sprint(p),
+		"method", method,
+		"remote_addr", peerIP(ctx),
+	)
+	return status.Error(codes.Internal, models.ErrInternalServerError.Error())
+}
+
+func recoverUnary(logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(ctx, logger, info.FullMethod, p)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+func recoverStream(logger *zap.SugaredLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recovered(ss.Context(), logger, info.FullMethod, p)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// authenticate checks the token of the calls in authMethods. The other calls
+// serve anonymous callers too, their token is only checked when one is sent.
+func authenticate(ctx context.Context, logger *zap.SugaredLogger, method string) (context.Context, error) {
+	var authorization string
+	if values := metadata.ValueFromIncomingContext(ctx, "authorization"); len(values) > 0 {
+		authorization = values[0]
+	}
+	token, found := strings.CutPrefix(authorization, "Bearer ")
+	if !found && !authMethods[method] {
+		return ctx, nil
+	}
+	if !found {
+		return nil, status.Error(codes.Unauthenticated, models.ErrBadToken.Error())
+	}
+
+	authToken := models.Session{}
+	authToken.InitWithToken(token)
+	payload, err := authToken.ValidateToken()
+	if err != nil {
+		mdwr.Logger(ctx, logger).Warnw("Authorization failed",
+			"reason", err.Error(),
+			"remote_addr", peerIP(ctx),
+			"method", method,
+		)
+		if !authMethods[method] {
+			return ctx, nil
+		}
+		return nil, status.Error(codes.Unauthenticated, models.ErrBadToken.Error())
+	}
+	mdwr.AnnotateLog(ctx, "user_id", payload.ID, "user_login", payload.Login)
+	return context.WithValue(ctx, models.Payload, payload), nil
+}
+
+func authUnary(logger *zap.SugaredLogger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, logger, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func authStream(logger *zap.SugaredLogger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), logger, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// rateLimit charges the call to the same buckets as the REST routes of its
+// class. A rejected call fails with ResourceExhausted and a retry-after header.
+func rateLimit(ctx context.Context, limiter *ratelimit.Limiter, method string, setHeader func(metadata.MD) error) error {
+	class, ok := methodClasses[method]
+	if !ok {
+		class = ratelimit.ClassRead
+	}
+	decision, ok := limiter.Take(ctx, class, peerIP(ctx))
+	if !ok || decision.Allowed {
+		return nil
+	}
+	_ = setHeader(metadata.Pairs("retry-after", strconv.Itoa(ratelimit.RetryAfterSeconds(decision))))
+	return status.Error(codes.ResourceExhausted, models.ErrTooManyRequests.Error())
+}
+
+func rateLimitUnary(limiter *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		setHeader := func(md metadata.MD) error { return grpc.SetHeader(ctx, md) }
+		if err := rateLimit(ctx, limiter, info.FullMethod, setHeader); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func rateLimitStream(limiter *ratelimit.Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := rateLimit(ss.Context(), limiter, info.FullMethod, ss.SetHeader); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,38 @@
+package rpc
+
+import (
+	"context"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/ratelimit"
+	redditv1 "github.com/Benzogang-Tape/Reddit-clone/pkg/api/reddit/v1"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestRateLimitUnary(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), map[ratelimit.Class]ratelimit.Policy{
+		ratelimit.ClassWrite: {Rate: 0.001, Burst: 1},
+	}, zap.NewNop().Sugar())
+	interceptor := rateLimitUnary(limiter)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+	tests := []struct {
+		name     string
+		method   string
+		wantCode codes.Code
+	}{
+		{name: "first write", method: redditv1.Reddit_CreatePost_FullMethodName, wantCode: codes.OK},
+		{name: "second write shares the bucket", method: redditv1.Reddit_AddComment_FullMethodName, wantCode: codes.ResourceExhausted},
+		{name: "reads have no policy here", method: redditv1.Reddit_ListPosts_FullMethodName, wantCode: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("interceptor() code = %v, want %v", code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/events"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/service"
+	redditv1 "github.com/Benzogang-Tape/Reddit-clone/pkg/api/reddit/v1"
+	mdwr "github.com/Benzogang-Tape/Reddit-clone/pkg/middleware"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"time"
+	"unicode/utf8"
+)
+
+const watchBuffer = 64
+
+type PostAPI interface {
+	service.PostStorage
+	service.PostActions
+}
+
+type UserAPI interface {
+	Register(models.AuthUserInfo) (models.TokenPayload, error)
+	Authorize(models.AuthUserInfo) (models.TokenPayload, error)
+}
+
+type LoginGuard interface {
+	Check(ctx context.Context, login models.Username, ip string) (time.Duration, error)
+	Fail(ctx context.Context, login models.Username, ip string) ([]models.Lockout, error)
+	Succeed(ctx context.Context, login models.Username, ip string) error
+}
+
+// Server implements the Reddit gRPC service on top of the same service layer
+// as the REST handlers.
+type Server struct {
+	redditv1.UnimplementedRedditServer
+	logger *zap.SugaredLogger
+	posts  PostAPI
+	users  UserAPI
+	guard  LoginGuard
+	events *events.Broker
+}
+
+func NewServer(posts PostAPI, users UserAPI, guard LoginGuard, broker *events.Broker, logger *zap.SugaredLogger) *Server {
+	return &Server{
+		logger: logger,
+		posts:  posts,
+		users:  users,
+		guard:  guard,
+		events: broker,
+	}
+}
+
+func (s *Server) Register(ctx context.Context, req *redditv1.Credentials) (*redditv1.Session, error) {
+	payload, err := s.users.Register(credentials(req))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	mdwr.Logger(ctx, s.logger).Infow("New user has registered", "login", req.GetUsername())
+	return newSession(payload)
+}
+
+func (s *Server) Login(ctx context.Context, req *redditv1.Credentials) (*redditv1.Session, error) {
+	login, ip := models.Username(req.GetUsername()), peerIP(ctx)
+	if _, err := s.guard.Check(ctx, login, ip); err != nil {
+		return nil, toStatus(err)
+	}
+
+	payload, err := s.users.Authorize(credentials(req))
+	if errors.Is(err, models.ErrNoUser) || errors.Is(err, models.ErrBadPass) {
+		s.registerFailure(ctx, login, ip)
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if err = s.guard.Succeed(ctx, login, ip); err != nil {
+		mdwr.Logger(ctx, s.logger).Errorw("Login attempts reset failed", "reason", err.Error(), "login", login)
+	}
+	mdwr.Logger(ctx, s.logger).Infow("New log in", "login", login)
+	return newSession(payload)
+}
+
+func (s *Server) registerFailure(ctx context.Context, login models.Username, ip string) {
+	lockouts, err := s.guard.Fail(ctx, login, ip)
+	if err != nil {
+		mdwr.Logger(ctx, s.logger).Errorw("Login failure registration failed", "reason", err.Error(), "login", login, "remote_addr", ip)
+	}
+	for _, lockout := range lockouts {
+		mdwr.Logger(ctx, s.logger).Warnw("Login locked out",
+			"key", lockout.Key,
+			"failures", lockout.Failures,
+			"locked_until", lockout.Until,
+			"login", login,
+			"remote_addr", ip,
+		)
+	}
+}
+
+func (s *Server) ListPosts(ctx context.Context, req *redditv1.ListPostsRequest) (*redditv1.ListPostsResponse, error) {
+	var posts []models.Post
+	var err error
+	switch {
+	case req.GetCategory() != "" && req.GetAuthor() != "":
+		return nil, status.Error(codes.InvalidArgument, "category and author filters are exclusive")
+	case req.GetCategory() != "":
+		var category models.PostCategory
+		if category, err = models.StringToPostCategory(req.GetCategory()); err != nil {
+			return nil, toStatus(err)
+		}
+		posts, err = s.posts.GetPostsByCategory(ctx, category)
+	case req.GetAuthor() != "":
+		posts, err = s.posts.GetPostsByUser(ctx, models.Username(req.GetAuthor()))
+	default:
+		posts, err = s.posts.GetAllPosts(ctx)
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return toPosts(ctx, posts), nil
+}
+
+func (s *Server) GetPost(ctx context.Context, req *redditv1.GetPostRequest) (*redditv1.Post, error) {
+	postID, err := parseID(req.GetId(), models.ErrInvalidPostID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return postResponse(ctx)(s.posts.GetPostByID(ctx, postID))
+}
+
+func (s *Server) CreatePost(ctx context.Context, req *redditv1.CreatePostRequest) (*redditv1.Post, error) {
+	return postResponse(ctx)(s.posts.CreatePost(ctx, toPostPayload(req)))
+}
+
+func (s *Server) DeletePost(ctx context.Context, req *redditv1.DeletePostRequest) (*redditv1.DeletePostResponse, error) {
+	postID, err := parseID(req.GetId(), models.ErrInvalidPostID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	if err = s.posts.DeletePost(ctx, postID); err != nil {
+		return nil, toStatus(err)
+	}
+	return &redditv1.DeletePostResponse{}, nil
+}
+
+func (s *Server) Vote(ctx context.Context, req *redditv1.VoteRequest) (*redditv1.Post, error) {
+	postID, err := parseID(req.GetPostId(), models.ErrInvalidPostID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	switch req.GetDirection() {
+	case redditv1.VoteDirection_VOTE_DIRECTION_UP:
+		return postResponse(ctx)(s.posts.Upvote(ctx, postID))
+	case redditv1.VoteDirection_VOTE_DIRECTION_DOWN:
+		return postResponse(ctx)(s.posts.Downvote(ctx, postID))
+	case redditv1.VoteDirection_VOTE_DIRECTION_NONE:
+		return postResponse(ctx)(s.posts.Unvote(ctx, postID))
+	default:
+		return nil, status.Error(codes.InvalidArgument, "vote direction is required")
+	}
+}
+
+func (s *Server) AddComment(ctx context.Context, req *redditv1.AddCommentRequest) (*redditv1.Post, error) {
+	postID, err := parseID(req.GetPostId(), models.ErrInvalidPostID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return postResponse(ctx)(s.posts.AddComment(ctx, postID, models.Comment{Body: req.GetBody()}))
+}
+
+func (s *Server) DeleteComment(ctx context.Context, req *redditv1.DeleteCommentRequest) (*redditv1.Post, error) {
+	postID, err := parseID(req.GetPostId(), models.ErrInvalidPostID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	commentID, err := parseID(req.GetCommentId(), models.ErrInvalidCommentID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return postResponse(ctx)(s.posts.DeleteComment(ctx, postID, commentID))
+}
+
+func (s *Server) WatchPosts(req *redditv1.WatchPostsRequest, stream redditv1.Reddit_WatchPostsServer) error {
+	category := req.GetCategory()
+	if category != "" {
+		if _, err := models.StringToPostCategory(category); err != nil {
+			return toStatus(err)
+		}
+	}
+
+	for event := range s.events.Subscribe(stream.Context(), watchBuffer) {
+		if category != "" && event.Type != events.PostDeleted && event.Post.Category.String() != category {
+			continue
+		}
+		if err := stream.Send(toPostEvent(stream.Context(), event)); err != nil {
+			return err
+		}
+	}
+	if err := stream.Context().Err(); err != nil {
+		return toStatus(err)
+	}
+	// Either the server is shutting down or the client could not keep up
+	return status.Error(codes.Unavailable, "stream closed, reconnect to resume")
+}
+
+func credentials(req *redditv1.Credentials) models.AuthUserInfo {
+	return models.AuthUserInfo{
+		Login:    models.Username(req.GetUsername()),
+		Password: req.GetPassword(),
+	}
+}
+
+func newSession(payload models.TokenPayload) (*redditv1.Session, error) {
+	sess, err := models.NewSession(payload)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &redditv1.Session{Token: sess.Token}, nil
+}
+
+func postResponse(ctx context.Context) func(models.Post, error) (*redditv1.Post, error) {
+	return func(post models.Post, err error) (*redditv1.Post, error) {
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		return toPost(ctx, post), nil
+	}
+}
+
+func parseID(id string, errInvalid error) (models.ID, error) {
+	if utf8.RuneCountInString(id) != models.UUIDLength {
+		return "", errInvalid
+	}
+	return models.ID(id), nil
+}
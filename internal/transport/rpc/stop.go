@@ -0,0 +1,24 @@
+package rpc
+
+import (
+	"context"
+	"google.golang.org/grpc"
+)
+
+// Stop waits for the in-flight calls to finish and cancels the remaining ones
+// once ctx is done. Streams are not waited for: WatchPosts ends as soon as the
+// events broker is closed.
+func Stop(ctx context.Context, s *grpc.Server) error {
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,5 @@
+// Package redditv1 holds the gRPC client and server stubs generated from
+// api/reddit/v1/reddit.proto.
+package redditv1
+
+//go:generate protoc -I ../../../../api --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative reddit/v1/reddit.proto
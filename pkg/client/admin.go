@@ -0,0 +1,232 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// The admin calls need the token of an administrator, they fail with
+// ErrForbidden otherwise.
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+type UserInfo struct {
+	Username string `json:"username"`
+	ID       string `json:"id"`
+	Role     string `json:"role"`
+}
+
+// PostSummary is the listing representation of a post, with counters instead
+// of the comments and the votes.
+type PostSummary struct {
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	Category     string `json:"category"`
+	Title        string `json:"title"`
+	URL          string `json:"url,omitempty"`
+	Author       Author `json:"author"`
+	Score        int    `json:"score"`
+	Upvotes      int    `json:"upvotes"`
+	Downvotes    int    `json:"downvotes"`
+	Views        uint   `json:"views"`
+	CommentCount int    `json:"commentCount"`
+	Created      string `json:"created"`
+}
+
+type PostDetails struct {
+	PostSummary
+	Text             string    `json:"text,omitempty"`
+	UpvotePercentage int       `json:"upvotePercentage"`
+	Comments         []Comment `json:"comments"`
+}
+
+// ImportOptions are left empty for the defaults of the server: a merge that
+// fails on conflicts.
+type ImportOptions struct {
+	// Mode is "merge" or "replace"
+	Mode string
+	// OnConflict is "fail", "skip" or "overwrite"
+	OnConflict string
+	DryRun     bool
+}
+
+type ImportReport struct {
+	Mode       string           `json:"mode"`
+	OnConflict string           `json:"onConflict"`
+	DryRun     bool             `json:"dryRun"`
+	Applied    bool             `json:"applied"`
+	Records    RecordCounts     `json:"records"`
+	Users      ImportChanges    `json:"users"`
+	Posts      ImportChanges    `json:"posts"`
+	Conflicts  []ImportConflict `json:"conflicts"`
+}
+
+type RecordCounts struct {
+	Users    int `json:"users"`
+	Posts    int `json:"posts"`
+	Comments int `json:"comments"`
+	Votes    int `json:"votes"`
+}
+
+type ImportChanges struct {
+	Added       int `json:"added"`
+	Overwritten int `json:"overwritten"`
+	Unchanged   int `json:"unchanged"`
+	Skipped     int `json:"skipped"`
+	Removed     int `json:"removed"`
+}
+
+type ImportConflict struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+func (c *Client) AdminUsers(ctx context.Context) ([]UserInfo, error) {
+	var users []UserInfo
+	if err := c.do(ctx, http.MethodGet, "/api/admin/users", nil, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// AdminCreateUser creates an account without logging the client in with it.
+func (c *Client) AdminCreateUser(ctx context.Context, username, password, role string) (*UserInfo, error) {
+	return c.user(ctx, "/api/admin/users", struct {
+		credentials
+		Role string `json:"role,omitempty"`
+	}{credentials: credentials{Username: username, Password: password}, Role: role})
+}
+
+func (c *Client) AdminSetRole(ctx context.Context, username, role string) (*UserInfo, error) {
+	return c.user(ctx, "/api/admin/users/"+url.PathEscape(username)+"/role", struct {
+		Role string `json:"role"`
+	}{Role: role})
+}
+
+func (c *Client) AdminResetPassword(ctx context.Context, username, password string) (*UserInfo, error) {
+	return c.user(ctx, "/api/admin/users/"+url.PathEscape(username)+"/password", struct {
+		Password string `json:"password"`
+	}{Password: password})
+}
+
+func (c *Client) user(ctx context.Context, path string, body interface{}) (*UserInfo, error) {
+	user := &UserInfo{}
+	if err := c.do(ctx, http.MethodPost, path, body, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// AdminTopPosts lists the most popular posts without counting views. An empty
+// category lists every category and a limit below 1 lists every post.
+func (c *Client) AdminTopPosts(ctx context.Context, category string, limit int) ([]PostSummary, error) {
+	query := url.Values{}
+	if category != "" {
+		query.Set("category", category)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	path := "/api/admin/posts"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var posts []PostSummary
+	if err := c.do(ctx, http.MethodGet, path, nil, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// AdminPost fetches a post without counting a view.
+func (c *Client) AdminPost(ctx context.Context, postID string) (*PostDetails, error) {
+	return c.postDetails(ctx, http.MethodGet, "/api/admin/posts/"+url.PathEscape(postID))
+}
+
+// AdminDeletePost deletes any post, AdminRestorePost brings it back.
+func (c *Client) AdminDeletePost(ctx context.Context, postID string) error {
+	return c.do(ctx, http.MethodDelete, "/api/admin/posts/"+url.PathEscape(postID), nil, nil)
+}
+
+func (c *Client) AdminRestorePost(ctx context.Context, postID string) (*PostDetails, error) {
+	return c.postDetails(ctx, http.MethodPost, "/api/admin/posts/"+url.PathEscape(postID)+"/restore")
+}
+
+func (c *Client) AdminDeleteComment(ctx context.Context, postID, commentID string) (*PostDetails, error) {
+	return c.postDetails(ctx, http.MethodDelete, "/api/admin/posts/"+url.PathEscape(postID)+"/comments/"+url.PathEscape(commentID))
+}
+
+func (c *Client) AdminRestoreComment(ctx context.Context, postID, commentID string) (*PostDetails, error) {
+	return c.postDetails(ctx, http.MethodPost, "/api/admin/posts/"+url.PathEscape(postID)+"/comments/"+url.PathEscape(commentID)+"/restore")
+}
+
+// AdminExport copies the export, which contains the passwords of the users,
+// to w as it is received.
+func (c *Client) AdminExport(ctx context.Context, w io.Writer) error {
+	resp, err := c.exchange(ctx, http.MethodGet, "/api/admin/export", "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err = io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("client: read export: %w", err)
+	}
+	return nil
+}
+
+// AdminImport uploads the export read from r. When conflicts stop a merge,
+// the report that lists them is returned with an error wrapping
+// ErrImportConflict.
+func (c *Client) AdminImport(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("client: read export: %w", err)
+	}
+	query := url.Values{}
+	if opts.Mode != "" {
+		query.Set("mode", opts.Mode)
+	}
+	if opts.OnConflict != "" {
+		query.Set("onConflict", opts.OnConflict)
+	}
+	if opts.DryRun {
+		query.Set("dryRun", "true")
+	}
+	path := "/api/admin/import"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	report := &ImportReport{}
+	resp, err := c.exchange(ctx, http.MethodPost, path, ndjsonContentType, data)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict && json.Unmarshal(apiErr.body, report) == nil {
+		return report, apiErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err = json.NewDecoder(resp.Body).Decode(report); err != nil {
+		return nil, fmt.Errorf("client: decode response: %w", err)
+	}
+	return report, nil
+}
+
+func (c *Client) postDetails(ctx context.Context, method, path string) (*PostDetails, error) {
+	post := &PostDetails{}
+	if err := c.do(ctx, method, path, nil, post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
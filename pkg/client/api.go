@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+type Author struct {
+	Username string `json:"username"`
+	ID       string `json:"id"`
+}
+
+type Vote struct {
+	UserID string `json:"user"`
+	Vote   int    `json:"vote"`
+}
+
+type Comment struct {
+	ID      string `json:"id"`
+	Author  Author `json:"author"`
+	Body    string `json:"body"`
+	Created string `json:"created"`
+}
+
+type Post struct {
+	ID               string    `json:"id"`
+	Type             string    `json:"type"`
+	Title            string    `json:"title"`
+	URL              string    `json:"url,omitempty"`
+	Text             string    `json:"text,omitempty"`
+	Category         string    `json:"category"`
+	Author           Author    `json:"author"`
+	Score            int       `json:"score"`
+	Upvotes          int       `json:"upvotes"`
+	Downvotes        int       `json:"downvotes"`
+	Views            uint      `json:"views"`
+	UpvotePercentage int       `json:"upvotePercentage"`
+	Created          string    `json:"created"`
+	Votes            []Vote    `json:"votes"`
+	Comments         []Comment `json:"comments"`
+}
+
+// OwnVote returns the vote of the authenticated caller, zero when they have
+// not voted.
+func (p *Post) OwnVote() int {
+	if len(p.Votes) == 0 {
+		return 0
+	}
+	return p.Votes[0].Vote
+}
+
+// NewPost describes a post to submit: set URL for link posts and Text for
+// text posts.
+type NewPost struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	URL      string `json:"url,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Category string `json:"category"`
+}
+
+const (
+	PostTypeLink = "link"
+	PostTypeText = "text"
+)
+
+type credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type session struct {
+	Token string `json:"token"`
+}
+
+// Register creates an account and logs the client in with it.
+func (c *Client) Register(ctx context.Context, username, password string) error {
+	return c.authenticate(ctx, "/api/register", username, password)
+}
+
+// Login logs the client in, the token is sent with every later request.
+func (c *Client) Login(ctx context.Context, username, password string) error {
+	return c.authenticate(ctx, "/api/login", username, password)
+}
+
+func (c *Client) authenticate(ctx context.Context, path, username, password string) error {
+	var sess session
+	if err := c.do(ctx, http.MethodPost, path, credentials{Username: username, Password: password}, &sess); err != nil {
+		return err
+	}
+	c.SetToken(sess.Token)
+	return nil
+}
+
+// Posts lists every post, most popular first.
+func (c *Client) Posts(ctx context.Context) ([]Post, error) {
+	return c.posts(ctx, "/api/posts/")
+}
+
+func (c *Client) PostsByCategory(ctx context.Context, category string) ([]Post, error) {
+	return c.posts(ctx, "/api/posts/"+url.PathEscape(category))
+}
+
+func (c *Client) PostsByUser(ctx context.Context, username string) ([]Post, error) {
+	return c.posts(ctx, "/api/user/"+url.PathEscape(username))
+}
+
+func (c *Client) posts(ctx context.Context, path string) ([]Post, error) {
+	var posts []Post
+	if err := c.do(ctx, http.MethodGet, path, nil, &posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// Post fetches a single post, which counts as a view.
+func (c *Client) Post(ctx context.Context, postID string) (*Post, error) {
+	return c.post(ctx, http.MethodGet, "/api/post/"+url.PathEscape(postID), nil)
+}
+
+func (c *Client) CreatePost(ctx context.Context, post NewPost) (*Post, error) {
+	return c.post(ctx, http.MethodPost, "/api/posts", post)
+}
+
+func (c *Client) DeletePost(ctx context.Context, postID string) error {
+	return c.do(ctx, http.MethodDelete, "/api/post/"+url.PathEscape(postID), nil, nil)
+}
+
+func (c *Client) Upvote(ctx context.Context, postID string) (*Post, error) {
+	return c.post(ctx, http.MethodPost, "/api/post/"+url.PathEscape(postID)+"/upvote", nil)
+}
+
+func (c *Client) Downvote(ctx context.Context, postID string) (*Post, error) {
+	return c.post(ctx, http.MethodPost, "/api/post/"+url.PathEscape(postID)+"/downvote", nil)
+}
+
+// Unvote takes the caller's vote back, it fails with ErrVoteNotFound when
+// there is none.
+func (c *Client) Unvote(ctx context.Context, postID string) (*Post, error) {
+	return c.post(ctx, http.MethodPost, "/api/post/"+url.PathEscape(postID)+"/unvote", nil)
+}
+
+func (c *Client) AddComment(ctx context.Context, postID, body string) (*Post, error) {
+	return c.post(ctx, http.MethodPost, "/api/post/"+url.PathEscape(postID), struct {
+		Body string `json:"comment"`
+	}{Body: body})
+}
+
+func (c *Client) DeleteComment(ctx context.Context, postID, commentID string) (*Post, error) {
+	return c.post(ctx, http.MethodDelete, "/api/post/"+url.PathEscape(postID)+"/"+url.PathEscape(commentID), nil)
+}
+
+func (c *Client) post(ctx context.Context, method, path string, body interface{}) (*Post, error) {
+	post := &Post{}
+	if err := c.do(ctx, method, path, body, post); err != nil {
+		return nil, err
+	}
+	return post, nil
+}
@@ -0,0 +1,238 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/app"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/config"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/storage"
+	"github.com/Benzogang-Tape/Reddit-clone/pkg/client"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+const missingPostID = "00000000-0000-0000-0000-000000000000"
+
+// newRouter builds the app the way cmd/redditclone does, in memory.
+func newRouter(t *testing.T) http.Handler {
+	t.Helper()
+	models.ConfigureSessions([]byte("client-test-secret"), nil, time.Hour)
+	reddit, err := app.New(config.Default(), storage.NewUserRepo(), storage.NewPostRepo(), zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reddit.Handler
+}
+
+func newClient(t *testing.T, baseURL string, opts ...client.Option) *client.Client {
+	t.Helper()
+	c, err := client.New(baseURL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientToken(t *testing.T) {
+	srv := httptest.NewServer(newRouter(t))
+	defer srv.Close()
+	ctx := context.Background()
+
+	alice := newClient(t, srv.URL)
+	if err := alice.Register(ctx, "alice", "password1"); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	if alice.Token() == "" {
+		t.Fatal("Register() kept no token")
+	}
+	post, err := alice.CreatePost(ctx, client.NewPost{Type: client.PostTypeText, Title: "Hello", Text: "world", Category: "music"})
+	if err != nil {
+		t.Fatalf("CreatePost() = %v", err)
+	}
+	if post.Author.Username != "alice" {
+		t.Errorf("CreatePost() author = %q, want alice", post.Author.Username)
+	}
+
+	again := newClient(t, srv.URL)
+	if err = again.Login(ctx, "alice", "password1"); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	reused := newClient(t, srv.URL, client.WithToken(again.Token()))
+	voted, err := reused.Upvote(ctx, post.ID)
+	if err != nil {
+		t.Fatalf("Upvote() with a reused token = %v", err)
+	}
+	if got := voted.OwnVote(); got != 1 || voted.Upvotes != 1 {
+		t.Errorf("OwnVote() after Upvote() = %d with %d upvotes, want 1 and 1", got, voted.Upvotes)
+	}
+
+	anonymous, err := newClient(t, srv.URL).Post(ctx, post.ID)
+	if err != nil {
+		t.Fatalf("Post() = %v", err)
+	}
+	if len(anonymous.Votes) != 0 || anonymous.Upvotes != 1 {
+		t.Errorf("anonymous Post() votes = %+v with %d upvotes, want no votes and 1 upvote", anonymous.Votes, anonymous.Upvotes)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	srv := httptest.NewServer(newRouter(t))
+	defer srv.Close()
+	ctx := context.Background()
+
+	c := newClient(t, srv.URL)
+	if err := c.Register(ctx, "bob", "password1"); err != nil {
+		t.Fatalf("Register() = %v", err)
+	}
+	tests := []struct {
+		name       string
+		call       func(c *client.Client) error
+		token      string
+		wantStatus int
+		wantErr    error
+		wantFields bool
+	}{
+		{
+			name: "unknown post",
+			call: func(c *client.Client) error {
+				_, err := c.Post(ctx, missingPostID)
+				return err
+			},
+			wantStatus: http.StatusNotFound,
+			wantErr:    client.ErrPostNotFound,
+		},
+		{
+			name: "wrong password",
+			call: func(c *client.Client) error {
+				return c.Login(ctx, "bob", "password2")
+			},
+			wantStatus: http.StatusUnauthorized,
+			wantErr:    client.ErrBadCredentials,
+		},
+		{
+			name: "invalid token",
+			call: func(c *client.Client) error {
+				_, err := c.CreatePost(ctx, client.NewPost{Type: client.PostTypeText, Title: "Hello", Text: "world", Category: "music"})
+				return err
+			},
+			token:      "not-a-token",
+			wantStatus: http.StatusUnauthorized,
+			wantErr:    client.ErrBadToken,
+		},
+		{
+			name: "invalid post",
+			call: func(c *client.Client) error {
+				_, err := c.CreatePost(ctx, client.NewPost{Title: "Hello"})
+				return err
+			},
+			token:      c.Token(),
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErr:    client.ErrValidation,
+			wantFields: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(newClient(t, srv.URL, client.WithToken(tt.token)))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			var apiErr *client.APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %T, want *client.APIError", err)
+			}
+			if tt.wantStatus != 0 && apiErr.StatusCode != tt.wantStatus {
+				t.Errorf("StatusCode = %d, want %d", apiErr.StatusCode, tt.wantStatus)
+			}
+			if tt.wantFields && len(apiErr.Errors) == 0 {
+				t.Error("Errors is empty, want the invalid fields")
+			}
+		})
+	}
+}
+
+// flaky answers the first failures requests with status and passes the rest
+// on to the app.
+type flaky struct {
+	next       http.Handler
+	status     int
+	retryAfter string
+
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (h *flaky) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.attempts++
+	fail := h.attempts <= h.failures
+	h.mu.Unlock()
+	if !fail {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	if h.retryAfter != "" {
+		w.Header().Set("Retry-After", h.retryAfter)
+	}
+	http.Error(w, http.StatusText(h.status), h.status)
+}
+
+func TestClientRetries(t *testing.T) {
+	ctx := context.Background()
+	listPosts := func(c *client.Client) error {
+		_, err := c.Posts(ctx)
+		return err
+	}
+	register := func(c *client.Client) error {
+		return c.Register(ctx, "carol", "password1")
+	}
+	tests := []struct {
+		name         string
+		status       int
+		failures     int
+		retryAfter   string
+		call         func(c *client.Client) error
+		wantAttempts int
+		wantStatus   int
+	}{
+		{name: "429 on a POST", status: http.StatusTooManyRequests, failures: 2, call: register, wantAttempts: 3},
+		{name: "503 on a POST", status: http.StatusServiceUnavailable, failures: 1, call: register, wantAttempts: 1, wantStatus: http.StatusServiceUnavailable},
+		{name: "503 on a GET", status: http.StatusServiceUnavailable, failures: 1, call: listPosts, wantAttempts: 2},
+		{name: "500 on a GET", status: http.StatusInternalServerError, failures: 2, call: listPosts, wantAttempts: 3},
+		{name: "502 on a GET", status: http.StatusBadGateway, failures: 1, call: listPosts, wantAttempts: 2},
+		{name: "500 on a POST", status: http.StatusInternalServerError, failures: 1, call: register, wantAttempts: 1, wantStatus: http.StatusInternalServerError},
+		{name: "retries run out", status: http.StatusServiceUnavailable, failures: 10, call: listPosts, wantAttempts: 4, wantStatus: http.StatusServiceUnavailable},
+		{name: "Retry-After beyond the backoff", status: http.StatusTooManyRequests, failures: 1, retryAfter: "60", call: listPosts, wantAttempts: 1, wantStatus: http.StatusTooManyRequests},
+		{name: "client errors", status: http.StatusBadRequest, failures: 1, call: listPosts, wantAttempts: 1, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &flaky{next: newRouter(t), status: tt.status, failures: tt.failures, retryAfter: tt.retryAfter}
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			c := newClient(t, srv.URL, client.WithRetries(3, time.Millisecond, 10*time.Millisecond))
+			err := tt.call(c)
+			var apiErr *client.APIError
+			switch {
+			case tt.wantStatus == 0 && err != nil:
+				t.Errorf("err = %v, want the retries to succeed", err)
+			case tt.wantStatus != 0 && !errors.As(err, &apiErr):
+				t.Errorf("err = %v, want an *client.APIError", err)
+			case tt.wantStatus != 0 && apiErr.StatusCode != tt.wantStatus:
+				t.Errorf("StatusCode = %d, want %d", apiErr.StatusCode, tt.wantStatus)
+			}
+			handler.mu.Lock()
+			defer handler.mu.Unlock()
+			if handler.attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", handler.attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
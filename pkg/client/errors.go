@@ -0,0 +1,137 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Benzogang-Tape/Reddit-clone/internal/models"
+	"net/http"
+	"strings"
+)
+
+// The errors an APIError unwraps to, so that callers can use errors.Is
+// without importing the server packages.
+var (
+	ErrBadCredentials   = models.ErrBadCredentials
+	ErrBadToken         = models.ErrBadToken
+	ErrBadPayload       = models.ErrBadPayload
+	ErrInvalidPostID    = models.ErrInvalidPostID
+	ErrInvalidCommentID = models.ErrInvalidCommentID
+	ErrInvalidCategory  = models.ErrInvalidCategory
+	ErrPostNotFound     = models.ErrPostNotFound
+	ErrCommentNotFound  = models.ErrCommentNotFound
+	ErrVoteNotFound     = models.ErrVoteNotFound
+	ErrBadCommentBody   = models.ErrBadCommentBody
+	ErrBodyTooLarge     = models.ErrBodyTooLarge
+	ErrUnknownPayload   = models.ErrUnknownPayload
+	ErrTooManyAttempts  = models.ErrTooManyAttempts
+	ErrTooManyRequests  = models.ErrTooManyRequests
+	ErrForbidden        = models.ErrForbidden
+	ErrUnknownUser      = models.ErrUnknownUser
+	ErrInvalidExport    = models.ErrInvalidExport
+	ErrImportConflict   = models.ErrImportConflict
+	ErrUnknownError     = models.ErrUnknownError
+	ErrValidation       = errors.New("validation failed")
+)
+
+// problemTypes mirrors the problem types of rest.DefaultErrorRegistry.
+var problemTypes = map[string]error{
+	"invalid-post-id":        models.ErrInvalidPostID,
+	"invalid-comment-id":     models.ErrInvalidCommentID,
+	"invalid-category":       models.ErrInvalidCategory,
+	"bad-payload":            models.ErrBadPayload,
+	"invalid-credentials":    models.ErrBadCredentials,
+	"bad-token":              models.ErrBadToken,
+	"forbidden":              models.ErrForbidden,
+	"user-not-found":         models.ErrUnknownUser,
+	"post-not-found":         models.ErrPostNotFound,
+	"comment-not-found":      models.ErrCommentNotFound,
+	"vote-not-found":         models.ErrVoteNotFound,
+	"body-too-large":         models.ErrBodyTooLarge,
+	"unsupported-media-type": models.ErrUnknownPayload,
+	"invalid-export":         models.ErrInvalidExport,
+	"import-conflict":        models.ErrImportConflict,
+	"bad-comment-body":       models.ErrBadCommentBody,
+	"too-many-attempts":      models.ErrTooManyAttempts,
+	"too-many-requests":      models.ErrTooManyRequests,
+	"validation-error":       ErrValidation,
+}
+
+// statusErrs covers the responses without a known problem type, such as
+// those of a proxy in front of the server.
+var statusErrs = map[int]error{
+	http.StatusBadRequest:            models.ErrBadPayload,
+	http.StatusUnauthorized:          models.ErrBadToken,
+	http.StatusForbidden:             models.ErrForbidden,
+	http.StatusConflict:              models.ErrImportConflict,
+	http.StatusRequestEntityTooLarge: models.ErrBodyTooLarge,
+	http.StatusUnsupportedMediaType:  models.ErrUnknownPayload,
+	http.StatusUnprocessableEntity:   ErrValidation,
+	http.StatusTooManyRequests:       models.ErrTooManyRequests,
+}
+
+type FieldError struct {
+	Location string `json:"location"`
+	Param    string `json:"param"`
+	Msg      string `json:"msg"`
+}
+
+// APIError is returned for every response with an error status code.
+type APIError struct {
+	StatusCode int
+	// Type is the problem type without the /problems/ prefix
+	Type    string
+	Message string
+	Errors  []FieldError
+	err     error
+	body    []byte
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("api error %d: %s", e.StatusCode, e.Message)
+	for _, field := range e.Errors {
+		msg += fmt.Sprintf("; %s %s", field.Param, field.Msg)
+	}
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	return e.err
+}
+
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	var problem struct {
+		Type    string       `json:"type"`
+		Title   string       `json:"title"`
+		Detail  string       `json:"detail"`
+		Message string       `json:"message"`
+		Errors  []FieldError `json:"errors"`
+	}
+	_ = json.Unmarshal(body, &problem)
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Type:       strings.TrimPrefix(problem.Type, "/problems/"),
+		Errors:     problem.Errors,
+		body:       body,
+	}
+	var (
+		ok        bool
+		errorText string
+	)
+	if apiErr.err, ok = problemTypes[apiErr.Type]; !ok {
+		apiErr.err, ok = statusErrs[resp.StatusCode]
+	}
+	if ok {
+		errorText = apiErr.err.Error()
+	} else {
+		apiErr.err = models.ErrUnknownError
+	}
+	for _, msg := range []string{problem.Detail, problem.Title, problem.Message, errorText, http.StatusText(resp.StatusCode)} {
+		if msg != "" {
+			apiErr.Message = msg
+			break
+		}
+	}
+	return apiErr
+}
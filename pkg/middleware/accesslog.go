@@ -2,18 +2,57 @@ package middleware
 
 import (
 	"go.uber.org/zap"
+	"math/rand"
 	"net/http"
+	"strings"
 	"time"
 )
 
-func AccessLog(logger *zap.SugaredLogger, next http.Handler) http.Handler {
+// Sampler decides whether a finished request is written to the access log.
+type Sampler interface {
+	Sample(r *http.Request, status int) bool
+}
+
+// PrefixSampler logs the given fraction of the requests whose path starts with
+// a configured prefix; the longest matching prefix wins. Error responses and
+// requests to other paths are always logged.
+type PrefixSampler struct {
+	rates map[string]float64
+}
+
+func NewPrefixSampler(rates map[string]float64) *PrefixSampler {
+	return &PrefixSampler{
+		rates: rates,
+	}
+}
+
+func (s *PrefixSampler) Sample(r *http.Request, status int) bool {
+	if status >= http.StatusBadRequest {
+		return true
+	}
+	rate, matched := 1.0, ""
+	for prefix, prefixRate := range s.rates {
+		if strings.HasPrefix(r.URL.Path, prefix) && len(prefix) > len(matched) {
+			rate, matched = prefixRate, prefix
+		}
+	}
+	return rand.Float64() < rate
+}
+
+func AccessLog(logger *zap.SugaredLogger, sampler Sampler, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
-		logger.Infow("New request",
+		rec := NewResponseRecorder(w)
+		next.ServeHTTP(rec, r)
+		if sampler != nil && !sampler.Sample(r, rec.Status()) {
+			return
+		}
+		Logger(r.Context(), logger).Infow("New request",
 			"method", r.Method,
 			"remote_addr", r.RemoteAddr,
 			"url", r.URL.Path,
+			"status", rec.Status(),
+			"bytes", rec.BytesWritten(),
 			"time", time.Since(start),
 		)
 	})
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	clientIPKey        = ctxKey("client_ip")
+	forwardedForHeader = "X-Forwarded-For"
+)
+
+type IPResolver struct {
+	trusted []*net.IPNet
+}
+
+func NewIPResolver(trustedProxies []string) (*IPResolver, error) {
+	trusted := make([]*net.IPNet, 0, len(trustedProxies))
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, err
+		}
+		trusted = append(trusted, network)
+	}
+	return &IPResolver{
+		trusted: trusted,
+	}, nil
+}
+
+// ClientIP returns the address of the client that sent the request. The
+// X-Forwarded-For chain is only honoured while the hops are trusted proxies:
+// it is walked from the right and the first untrusted address wins, so a
+// client cannot spoof its address by sending the header itself.
+func (res *IPResolver) ClientIP(r *http.Request) string {
+	ip := remoteIP(r.RemoteAddr)
+	if !res.isTrusted(ip) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values(forwardedForHeader), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !res.isTrusted(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+func (res *IPResolver) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range res.trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (res *IPResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey, res.ClientIP(r))))
+	})
+}
+
+// ClientIP returns the address stored by IPResolver.Middleware, falling back
+// to the peer address of the connection.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey).(string); ok {
+		return ip
+	}
+	return remoteIP(r.RemoteAddr)
+}
+
+func remoteIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
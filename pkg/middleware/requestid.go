@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"github.com/hashicorp/go-uuid"
+	"go.uber.org/zap"
+	"net/http"
+	"regexp"
+	"sync"
+)
+
+type ctxKey string
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	requestIDKey    = ctxKey("request_id")
+	logFieldsKey    = ctxKey("log_fields")
+)
+
+var (
+	requestIDTemplate = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,128}$`)
+)
+
+type logFields struct {
+	mu     sync.Mutex
+	fields []interface{}
+}
+
+// RequestID takes the request ID from the X-Request-ID header, or generates one
+// if the header is missing or malformed, and echoes it in the response.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, requestID := WithRequestID(r.Context(), r.Header.Get(RequestIDHeader))
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// WithRequestID starts the log context of a request outside of the RequestID
+// middleware, such as a gRPC call. A missing or malformed requestID is
+// replaced with a generated one, which is returned.
+func WithRequestID(ctx context.Context, requestID string) (context.Context, string) {
+	if !requestIDTemplate.MatchString(requestID) {
+		generated, err := uuid.GenerateUUID()
+		if err != nil {
+			generated = "unknown"
+		}
+		requestID = generated
+	}
+	ctx = context.WithValue(ctx, requestIDKey, requestID)
+	return context.WithValue(ctx, logFieldsKey, &logFields{}), requestID
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// AnnotateLog attaches fields to every log line written for the request from
+// now on, including the access log line written by outer middlewares.
+func AnnotateLog(ctx context.Context, keysAndValues ...interface{}) {
+	fields, ok := ctx.Value(logFieldsKey).(*logFields)
+	if !ok {
+		return
+	}
+	fields.mu.Lock()
+	defer fields.mu.Unlock()
+	fields.fields = append(fields.fields, keysAndValues...)
+}
+
+// Logger returns logger enriched with the request ID and the fields attached
+// with AnnotateLog.
+func Logger(ctx context.Context, logger *zap.SugaredLogger) *zap.SugaredLogger {
+	requestID := RequestIDFromContext(ctx)
+	if requestID == "" {
+		return logger
+	}
+	logger = logger.With("request_id", requestID)
+	if fields, ok := ctx.Value(logFieldsKey).(*logFields); ok {
+		fields.mu.Lock()
+		defer fields.mu.Unlock()
+		logger = logger.With(fields.fields...)
+	}
+	return logger
+}
@@ -0,0 +1,10 @@
+// Package static embeds the prebuilt frontend so that the server binary does
+// not depend on its working directory.
+package static
+
+import "embed"
+
+//go:generate go run ../cmd/precompress js css
+
+//go:embed html css js
+var FS embed.FS